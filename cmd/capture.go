@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"base-linux-setup/internal/capture"
+	"base-linux-setup/internal/detector"
+	"base-linux-setup/internal/presets"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func NewCaptureCommand() *cobra.Command {
+	var (
+		name     string
+		sections []string
+		format   string
+		output   string
+		force    bool
+	)
+
+	command := &cobra.Command{
+		Use:   "capture",
+		Short: "Generate a preset reproducing this machine",
+		Long: `Inspect this machine and generate a preset that would reproduce it: manually
+installed packages, services enabled against their vendor preset, configuration
+files changed from their package defaults, the groups of the current user and the
+Raspberry Pi boot overlays.
+
+The preset is written to the current directory for review; it is not used until
+you copy it to the user preset directory or run it with --preset-file. Run with
+sudo to include configuration files only root can read. Configuration files are
+copied verbatim, so check them for passwords and keys before sharing the preset.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			var family, environment, match string
+			var architectures []string
+			env, err := detector.DetectEnvironment()
+			if err != nil {
+				color.Yellow("Could not detect the environment, leaving the match rule empty: %v", err)
+				family = familyFromPackageManager()
+			} else {
+				family = presets.Family(env)
+				environment = env.Distribution
+				if env.IsRaspberryPi {
+					environment += " (Raspberry Pi)"
+				}
+				match = presets.DefaultMatch(env)
+				architectures = presets.DefaultArchitectures(env)
+			}
+
+			if name == "" {
+				hostname, _ := os.Hostname()
+				name = "Captured " + hostname
+			}
+
+			color.Cyan("Inspecting this machine...")
+			system, err := capture.Inspect(family, sections)
+			if err != nil {
+				color.Red("Error: %v", err)
+				os.Exit(1)
+			}
+			for _, warning := range system.Warnings {
+				color.Yellow("⚠ %s", warning)
+			}
+
+			preset, err := system.Preset(name, environment, match, architectures)
+			if err != nil {
+				color.Red("Error creating preset: %v", err)
+				os.Exit(1)
+			}
+			data, err := presets.EncodePreset(preset, format)
+			if err != nil {
+				color.Red("Error encoding preset: %v", err)
+				os.Exit(1)
+			}
+
+			if output == "" {
+				output = presets.Slug(name) + "." + format
+			}
+			if _, err := os.Stat(output); err == nil && !force {
+				color.Red("Error: %s already exists; use --force to overwrite it", output)
+				os.Exit(1)
+			}
+			if err := os.WriteFile(output, data, 0644); err != nil {
+				color.Red("Error writing preset: %v", err)
+				os.Exit(1)
+			}
+
+			fmt.Println()
+			color.Green("✓ Captured %s to %s", name, output)
+			for _, line := range system.Summary() {
+				color.White("  - %s", line)
+			}
+
+			fmt.Println()
+			color.Cyan("Next steps:")
+			color.White("  1. Review %s; drop packages, files and services you do not need", output)
+			color.White("  2. Check it: base-linux-setup lint-preset %s", output)
+			color.White("  3. Try it on the new machine: base-linux-setup --allow-unsigned --preset-file %s --dry-run", output)
+			color.White("  4. Sign it and copy it to the user preset directory to use it by default")
+		},
+	}
+
+	command.Flags().StringVar(&name, "name", "", "Preset name (default \"Captured <hostname>\")")
+	command.Flags().StringSliceVar(&sections, "include", nil, "Parts to capture: packages, services, configs, groups, boot (default all)")
+	command.Flags().StringVar(&format, "format", presets.FormatJSON, "File format: json or yaml")
+	command.Flags().StringVarP(&output, "output", "o", "", "File to write (default <name>.<format> in the current directory)")
+	command.Flags().BoolVar(&force, "force", false, "Overwrite an existing file")
+
+	return command
+}
+
+// familyFromPackageManager guesses the package family when detection fails
+func familyFromPackageManager() string {
+	if _, err := exec.LookPath("dpkg-query"); err == nil {
+		return presets.FamilyDebian
+	}
+	if _, err := exec.LookPath("pacman"); err == nil {
+		return presets.FamilyArch
+	}
+	return ""
+}
@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"base-linux-setup/internal/detector"
+	"base-linux-setup/internal/export"
+	"base-linux-setup/internal/presets"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func NewExportCommand() *cobra.Command {
+	var (
+		format    string
+		output    string
+		factsFile string
+		profile   string
+		setValues []string
+		varsFile  string
+		force     bool
+	)
+
+	command := &cobra.Command{
+		Use:   "export [preset]",
+		Short: "Export a preset to run without base-linux-setup",
+		Long: `Render a preset for one machine into a standalone artifact: variables are
+resolved, loops expanded and conditions evaluated against the machine's facts.
+
+The preset is a file path or the name of a built-in or user preset, by default the
+one detected for this machine. Facts come from detecting this machine; export for
+another machine with --facts, a JSON or YAML file such as
+  {"distro": "kali", "arch": "aarch64", "board": {"raspberry_pi": true}}
+
+Secrets are never written: scripts read them from the environment, Ansible
+playbooks and roles take them as variables and cloud-init runs read them from a
+file on the image.
+
+Formats:
+  bash          POSIX shell script with the same task order, logging and error handling
+  ansible       Ansible playbook using the command, shell, copy and systemd modules
+  ansible-role  Ansible role directory (tasks, handlers and metadata), written to --output
+  cloud-init    #cloud-config user-data with packages, write_files, users/groups and runcmd
+  nocloud       NoCloud seed directory (user-data and meta-data), written to --output`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			plan, err := resolveExportPlan(args, factsFile, profile, setValues, varsFile)
+			if err != nil {
+				color.Red("Error: %v", err)
+				os.Exit(1)
+			}
+			for _, warning := range plan.Warnings {
+				color.Yellow("Warning: %s", warning)
+			}
+
+			files, err := export.Render(plan, format)
+			if err != nil {
+				color.Red("Error exporting preset: %v", err)
+				os.Exit(1)
+			}
+
+			if len(files) == 1 && files[0].Path == "" {
+				if output == "" || output == "-" {
+					os.Stdout.Write(files[0].Data)
+					return
+				}
+				if err := os.WriteFile(output, files[0].Data, files[0].Mode); err != nil {
+					color.Red("Error writing %s: %v", output, err)
+					os.Exit(1)
+				}
+				color.Green("✓ Exported %s to %s", plan.Preset.Name, output)
+				return
+			}
+
+			if output == "" || output == "-" {
+				color.Red("Error: the %s format writes a directory; name it with --output", format)
+				os.Exit(1)
+			}
+			if err := writeExportDir(output, files, force); err != nil {
+				color.Red("Error: %v", err)
+				os.Exit(1)
+			}
+			color.Green("✓ Exported %s to %s", plan.Preset.Name, output)
+			for _, file := range files {
+				color.White("  - %s", filepath.Join(output, file.Path))
+			}
+		},
+	}
+
+	command.Flags().StringVar(&format, "format", "bash", "Export format: "+strings.Join(export.Formats, ", "))
+	command.Flags().StringVarP(&output, "output", "o", "", "Write to this file instead of standard output, or to this directory for directory formats")
+	command.Flags().StringVar(&factsFile, "facts", "", "Facts of the target machine, overriding detected ones (JSON or YAML)")
+	command.Flags().StringVar(&profile, "profile", "", "Use a named profile of the preset")
+	command.Flags().StringArrayVar(&setValues, "set", nil, "Set a preset variable (key=value, repeatable)")
+	command.Flags().StringVar(&varsFile, "vars-file", "", "Read preset variable values from a JSON file")
+	command.Flags().BoolVar(&force, "force", false, "Write into an output directory that is not empty")
+
+	return command
+}
+
+// resolveExportPlan loads the preset to export and resolves it for the target machine
+func resolveExportPlan(args []string, factsFile, profile string, setValues []string, varsFile string) (*export.Plan, error) {
+	facts := make(map[string]interface{})
+	env, detectErr := detector.DetectEnvironment()
+	if detectErr == nil {
+		facts = env.Facts()
+	}
+	if factsFile != "" {
+		fileFacts, err := export.LoadFactsFile(factsFile)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range fileFacts {
+			facts[key] = value
+		}
+	} else if detectErr != nil {
+		return nil, fmt.Errorf("could not detect the environment (%v); describe the target machine with --facts", detectErr)
+	}
+
+	var preset *presets.Preset
+	if len(args) > 0 {
+		var err error
+		if preset, err = loadPresetRef(args[0]); err != nil {
+			return nil, err
+		}
+	} else if detectErr != nil {
+		return nil, fmt.Errorf("name the preset to export, as detection failed: %v", detectErr)
+	} else {
+		var loadErrs []error
+		preset, loadErrs = presets.GetPreset(env)
+		for _, err := range loadErrs {
+			color.Yellow("⚠ Skipping user preset: %v", err)
+		}
+		if preset == nil {
+			preset = presets.GetDefaultPreset()
+		}
+	}
+
+	if profile != "" {
+		var warnings []string
+		var err error
+		if preset, warnings, err = preset.ApplyProfile(profile); err != nil {
+			return nil, err
+		}
+		for _, warning := range warnings {
+			color.Yellow("Warning: %s", warning)
+		}
+	}
+
+	values := make(map[string]interface{})
+	if varsFile != "" {
+		fileValues, err := presets.LoadVarsFile(varsFile)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range fileValues {
+			values[key] = value
+		}
+	}
+	setFlagValues, err := presets.ParseSetValues(setValues)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range setFlagValues {
+		values[key] = value
+	}
+
+	return export.Resolve(preset, export.Options{Facts: facts, Values: values})
+}
+
+// writeExportDir writes the files of a directory format, refusing to mix them with
+// existing files unless forced
+func writeExportDir(dir string, files []export.File, force bool) error {
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 && !force {
+		return fmt.Errorf("%s is not empty; use --force to write into it", dir)
+	}
+	for _, file := range files {
+		path := filepath.Join(dir, file.Path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, file.Data, file.Mode); err != nil {
+			return fmt.Errorf("failed to write %s: %v", path, err)
+		}
+	}
+	return nil
+}
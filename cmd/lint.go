@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"base-linux-setup/internal/lint"
+	"base-linux-setup/internal/presets"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func NewLintPresetCommand() *cobra.Command {
+	var (
+		failOn    string
+		listRules bool
+	)
+
+	command := &cobra.Command{
+		Use:   "lint-preset [file...]",
+		Short: "Check presets for risky and deprecated patterns",
+		Long: `Check preset files, or the built-in presets when no file is given, for risky
+and deprecated patterns in commands, scripts, file contents and variable defaults.
+
+Suppress a rule for one script line with a "# lint:ignore BLS005" comment on the
+line or the line above it, or for a task or the whole preset with a lint_ignore
+list. Exits with status 1 when a finding reaches the --fail-on severity.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if listRules {
+				for _, rule := range lint.Rules() {
+					color.White("%s  %-7s  %s", rule.ID, rule.Severity, rule.Summary)
+				}
+				return
+			}
+
+			threshold, err := lint.ParseSeverity(failOn)
+			if err != nil {
+				color.Red("Error: %v", err)
+				os.Exit(1)
+			}
+
+			type target struct {
+				name   string
+				preset *presets.Preset
+			}
+			targets := make([]target, 0)
+			if len(args) == 0 {
+				for _, preset := range presets.GetBuiltinPresets() {
+					targets = append(targets, target{preset.Name, preset})
+				}
+			}
+			failed := false
+			for _, path := range args {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					color.Red("Error reading preset: %v", err)
+					os.Exit(1)
+				}
+				preset, err := presets.DecodePreset(data)
+				if err == nil {
+					err = preset.Validate()
+				}
+				if err != nil {
+					color.Red("✗ %s: invalid preset: %v", path, err)
+					failed = true
+					continue
+				}
+				targets = append(targets, target{path, preset})
+			}
+
+			counts := make(map[lint.Severity]int)
+			for _, t := range targets {
+				findings := lint.Lint(t.preset)
+				if len(findings) == 0 {
+					color.Green("✓ %s", t.name)
+					continue
+				}
+
+				color.Cyan("▶ %s", t.name)
+				for _, finding := range findings {
+					counts[finding.Severity]++
+					message := fmt.Sprintf("  %s %s %s: %s", finding.Severity, finding.Rule, finding.Location, finding.Message)
+					switch finding.Severity {
+					case lint.Error:
+						color.Red(message)
+					case lint.Warning:
+						color.Yellow(message)
+					default:
+						color.White(message)
+					}
+					if finding.Text != "" {
+						color.HiBlack("      %s", finding.Text)
+					}
+				}
+				if lint.Failed(findings, threshold) {
+					failed = true
+				}
+			}
+
+			fmt.Println()
+			color.White("%d errors, %d warnings, %d info", counts[lint.Error], counts[lint.Warning], counts[lint.Info])
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+
+	command.Flags().StringVar(&failOn, "fail-on", "warning", "Exit with an error for findings of this severity or higher: info, warning or error")
+	command.Flags().BoolVar(&listRules, "rules", false, "List the lint rules and exit")
+
+	return command
+}
@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
 
 	"base-linux-setup/internal/presets"
+	"base-linux-setup/internal/ui"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
@@ -14,7 +16,15 @@ func NewListPresetsCommand() *cobra.Command {
 		Short: "List all available presets",
 		Long:  `List all available presets for different environments.`,
 		Run: func(cmd *cobra.Command, args []string) {
-			presetList := presets.GetAllPresets()
+			userPresets, loadErrs := presets.LoadUserPresets()
+			presetList := append(presets.GetBuiltinPresets(), userPresets...)
+
+			for _, err := range loadErrs {
+				color.Yellow("⚠ Skipping user preset: %v", err)
+			}
+			if len(loadErrs) > 0 {
+				fmt.Println()
+			}
 
 			color.Cyan("Available Presets:")
 			fmt.Println()
@@ -23,13 +33,57 @@ func NewListPresetsCommand() *cobra.Command {
 				color.Green("▶ %s", preset.Name)
 				color.White("  Environment: %s", preset.Environment)
 				color.White("  Description: %s", preset.Description)
+				ui.ShowPresetMetadata(preset, "  ")
 				color.HiBlack("  Tasks: %d", len(preset.Tasks))
 				
 				for i, task := range preset.Tasks {
 					color.HiBlack("    %d. %s", i+1, task.Name)
+					if task.When != "" {
+						color.HiBlack("       when: %s", task.When)
+					}
+					if len(task.Tags) > 0 {
+						color.HiBlack("       tags: %s", strings.Join(task.Tags, ", "))
+					}
+					if task.IsBlock() {
+						color.HiBlack("       block: %d tasks, rescue: %d, always: %d", len(task.Block), len(task.Rescue), len(task.Always))
+					}
+					if len(task.Notify) > 0 {
+						color.HiBlack("       notify: %s", strings.Join(task.Notify, ", "))
+					}
+				}
+				if len(preset.Profiles) > 0 {
+					color.HiBlack("  Profiles: %d", len(preset.Profiles))
+					for _, profile := range preset.Profiles {
+						if profile.Description != "" {
+							color.HiBlack("    - %s: %s", profile.Name, profile.Description)
+						} else {
+							color.HiBlack("    - %s", profile.Name)
+						}
+					}
+				}
+				if len(preset.Handlers) > 0 {
+					color.HiBlack("  Handlers: %d", len(preset.Handlers))
+					for _, handler := range preset.Handlers {
+						color.HiBlack("    - %s", handler.Name)
+					}
 				}
 				fmt.Println()
 			}
+
+			color.Cyan("Add-on Modules (use --with):")
+			fmt.Println()
+			for _, module := range presets.GetAllModules() {
+				families := make([]string, 0, len(module.Implementations))
+				for _, family := range []string{presets.FamilyDebian, presets.FamilyArch} {
+					if module.Supports(family) {
+						families = append(families, family)
+					}
+				}
+				color.Green("▶ %s (%s)", module.Name, module.ID)
+				color.White("  %s", module.Description)
+				color.HiBlack("  Families: %s", strings.Join(families, ", "))
+			}
+			fmt.Println()
 		},
 	}
 } 
\ No newline at end of file
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"base-linux-setup/internal/presets"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func NewMigratePresetCommand() *cobra.Command {
+	var (
+		write  bool
+		output string
+		format string
+	)
+
+	command := &cobra.Command{
+		Use:   "migrate-preset <file>",
+		Short: "Rewrite a preset file to the current schema version",
+		Long: `Rewrite a JSON or YAML preset to the current schema version, applying every
+migration between the preset's schema_version and the one this binary uses.
+Comments in YAML presets are preserved.
+
+The migrated preset is printed to stdout unless --write or --output is given.
+Use --format to convert between JSON and YAML.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			input := args[0]
+			if write {
+				output = input
+			}
+			if format == "" {
+				format = presets.FormatForPath(input)
+				if output != "" {
+					format = presets.FormatForPath(output)
+				}
+			}
+
+			data, err := os.ReadFile(input)
+			if err != nil {
+				color.Red("Error reading preset: %v", err)
+				os.Exit(1)
+			}
+
+			migrated, applied, err := presets.MigratePreset(data, format)
+			if err != nil {
+				color.Red("Error migrating preset: %v", err)
+				os.Exit(1)
+			}
+
+			// Make sure the result loads before replacing anything
+			preset, err := presets.DecodePreset(migrated)
+			if err == nil {
+				err = preset.Validate()
+			}
+			if err != nil {
+				color.Red("Migrated preset is invalid: %v", err)
+				os.Exit(1)
+			}
+
+			// Report on stderr so stdout carries only the preset
+			report := color.New(color.FgCyan)
+			if len(applied) == 0 {
+				report.Fprintf(os.Stderr, "%s already uses schema version %d\n", input, presets.CurrentSchemaVersion)
+			}
+			for _, step := range applied {
+				report.Fprintf(os.Stderr, "Applied %s\n", step)
+			}
+
+			if output == "" {
+				fmt.Print(string(migrated))
+				return
+			}
+			if err := os.WriteFile(output, migrated, 0644); err != nil {
+				color.Red("Error writing preset: %v", err)
+				os.Exit(1)
+			}
+			color.New(color.FgGreen).Fprintf(os.Stderr, "✓ Wrote %s\n", output)
+		},
+	}
+
+	command.Flags().BoolVarP(&write, "write", "w", false, "Rewrite the preset file in place")
+	command.Flags().StringVarP(&output, "output", "o", "", "Write the migrated preset to this file")
+	command.Flags().StringVar(&format, "format", "", "Output format: json or yaml (default from the file extension)")
+
+	return command
+}
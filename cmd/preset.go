@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"crypto/ed25519"
+	"os"
+	"strings"
+
+	"base-linux-setup/internal/presets"
+	"base-linux-setup/internal/sources"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func NewPresetCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "preset",
+		Short: "Manage user presets and remote preset sources",
+		Long: `Manage presets stored in the user preset directory, including presets fetched
+from git repositories and HTTPS URLs.`,
+	}
+
+	command.AddCommand(newPresetNewCommand())
+	command.AddCommand(newPresetDiffCommand())
+	command.AddCommand(newPresetAddCommand())
+	command.AddCommand(newPresetUpdateCommand())
+	command.AddCommand(newPresetRemoveCommand())
+	command.AddCommand(newPresetSignCommand())
+	command.AddCommand(newPresetTrustCommand())
+
+	return command
+}
+
+func newPresetAddCommand() *cobra.Command {
+	var opts sources.AddOptions
+
+	command := &cobra.Command{
+		Use:   "add <url>",
+		Short: "Fetch presets from a git repository or HTTPS URL",
+		Long: `Fetch presets from a git repository (preset files at its root or in presets/)
+or a single preset file over HTTPS, and pin the source to the commit or content
+digest fetched. With --commit or --sha256 the source is locked to that version.
+Plain http URLs are refused.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			provenance, err := sources.Add(args[0], opts)
+			if err != nil {
+				color.Red("Error adding source: %v", err)
+				os.Exit(1)
+			}
+
+			color.Green("✓ Added source %s", provenance.Source)
+			color.White("  URL: %s", provenance.URL)
+			color.White("  Pinned to: %s", provenance.Pin)
+			for name := range provenance.Files {
+				color.HiBlack("  - %s", name)
+			}
+		},
+	}
+
+	command.Flags().StringVar(&opts.Name, "name", "", "Name of the source (default from the URL)")
+	command.Flags().StringVar(&opts.Ref, "ref", "", "Git branch or tag to follow")
+	command.Flags().StringVar(&opts.Commit, "commit", "", "Lock a git source to this commit")
+	command.Flags().StringVar(&opts.SHA256, "sha256", "", "Lock an HTTPS source to this content digest")
+
+	return command
+}
+
+func newPresetUpdateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "update [source...]",
+		Short: "Fetch the latest version of preset sources",
+		Long: `Fetch preset sources again, moving each pin to the latest commit or content.
+Locked sources are verified against their pin instead. All sources are updated
+when none are named. When a source cannot be reached its cached copy is kept.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			names := args
+			if len(names) == 0 {
+				list, err := sources.List()
+				if err != nil {
+					color.Red("Error listing sources: %v", err)
+					os.Exit(1)
+				}
+				for _, provenance := range list {
+					names = append(names, provenance.Source)
+				}
+				if len(names) == 0 {
+					color.Yellow("No preset sources installed. Add one with 'preset add <url>'.")
+					return
+				}
+			}
+
+			failed := false
+			for _, name := range names {
+				before, after, err := sources.Update(name)
+				switch {
+				case err != nil:
+					color.Red("✗ %s: %v", name, err)
+					failed = true
+				case before.Pin == after.Pin:
+					color.Green("✓ %s is up to date (%s)", name, after.Pin)
+				default:
+					color.Green("✓ %s updated: %s → %s", name, before.Pin, after.Pin)
+				}
+			}
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+func newPresetRemoveCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <source>",
+		Short: "Remove a preset source and its cached presets",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := sources.Remove(args[0]); err != nil {
+				color.Red("Error removing source: %v", err)
+				os.Exit(1)
+			}
+			color.Green("✓ Removed source %s", args[0])
+		},
+	}
+}
+
+func newPresetSignCommand() *cobra.Command {
+	var keyFile string
+
+	command := &cobra.Command{
+		Use:   "sign <file...>",
+		Short: "Sign preset files with your local key",
+		Long: `Write a detached signature next to each preset file (<file>.sig). A signing key
+is generated on first use and its public key added to your trusted keys; share
+the public key so others can trust your presets with 'preset trust'.
+
+Sign a preset again after every change, including migrate-preset rewrites.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			key, err := loadSigningKey(keyFile)
+			if err != nil {
+				color.Red("Error: %v", err)
+				os.Exit(1)
+			}
+			for _, path := range args {
+				if err := signPresetFile(key, path); err != nil {
+					color.Red("Error: %v", err)
+					os.Exit(1)
+				}
+			}
+		},
+	}
+
+	command.Flags().StringVar(&keyFile, "key", "", "Signing key file (default in the configuration directory)")
+
+	return command
+}
+
+func newPresetTrustCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "trust [public-key [comment...]]",
+		Short: "Trust presets signed by a public key, or list trusted keys",
+		Args:  cobra.ArbitraryArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				keys, err := presets.LoadTrustedKeys()
+				if err != nil {
+					color.Red("Error reading trusted keys: %v", err)
+					os.Exit(1)
+				}
+				if len(keys) == 0 {
+					color.Yellow("No trusted keys. Sign a preset with 'preset sign' or add a key with 'preset trust <public-key>'.")
+					return
+				}
+				color.Cyan("Trusted Keys:")
+				for _, key := range keys {
+					color.White("  %s  %s", key.ID(), key.Comment)
+					color.HiBlack("    %s", presets.EncodePublicKey(key.Key))
+				}
+				return
+			}
+
+			key, err := presets.ParsePublicKey(args[0])
+			if err != nil {
+				color.Red("Error: %v", err)
+				os.Exit(1)
+			}
+			if err := presets.TrustKey(key, strings.Join(args[1:], " ")); err != nil {
+				color.Red("Error trusting key: %v", err)
+				os.Exit(1)
+			}
+			color.Green("✓ Trusting presets signed by %s", presets.KeyID(key))
+		},
+	}
+}
+
+// loadSigningKey loads the local signing key, announcing it when it was just
+// generated. An empty path selects the default key file.
+func loadSigningKey(keyFile string) (ed25519.PrivateKey, error) {
+	key, generated, err := presets.LocalSigningKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if generated {
+		color.Green("✓ Generated signing key")
+		color.White("  Public key: %s", presets.EncodePublicKey(key.Public().(ed25519.PublicKey)))
+	}
+	return key, nil
+}
+
+// signPresetFile signs a preset file and reports it
+func signPresetFile(key ed25519.PrivateKey, path string) error {
+	if err := presets.SignPresetFile(key, path); err != nil {
+		return err
+	}
+	color.Green("✓ Signed %s with key %s", path, presets.KeyID(key.Public().(ed25519.PublicKey)))
+	return nil
+}
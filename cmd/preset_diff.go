@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"base-linux-setup/internal/diff"
+	"base-linux-setup/internal/presets"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func newPresetDiffCommand() *cobra.Command {
+	var context int
+
+	command := &cobra.Command{
+		Use:   "diff <a> <b>",
+		Short: "Show how two presets differ",
+		Long: `Compare two presets task by task: tasks added, removed or moved, changed fields,
+and unified diffs of commands, scripts and file contents. Variables, profiles,
+handlers and metadata are compared too.
+
+Each preset is a file path or the name of a built-in or user preset, e.g.
+base-linux-setup preset diff "Kali Linux - Raspberry Pi" ~/.config/base-linux-setup/presets/my-pi.json
+Names are looked up among built-in presets first. Signatures are not checked as
+nothing is run.`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			a, err := loadPresetRef(args[0])
+			if err != nil {
+				color.Red("Error: %v", err)
+				os.Exit(1)
+			}
+			b, err := loadPresetRef(args[1])
+			if err != nil {
+				color.Red("Error: %v", err)
+				os.Exit(1)
+			}
+
+			result, err := diff.Presets(a, b, context)
+			if err != nil {
+				color.Red("Error comparing presets: %v", err)
+				os.Exit(1)
+			}
+
+			color.Cyan("--- %s", args[0])
+			color.Cyan("+++ %s", args[1])
+			if result.IsEmpty() {
+				color.Green("✓ The presets are equivalent")
+				return
+			}
+			printDiff(result)
+		},
+	}
+
+	command.Flags().IntVarP(&context, "context", "U", 3, "Unchanged lines shown around changes in commands, scripts and contents")
+
+	return command
+}
+
+// loadPresetRef loads a preset from a file path, or by name from the built-in
+// and user presets
+func loadPresetRef(ref string) (*presets.Preset, error) {
+	if _, err := os.Stat(ref); err == nil {
+		data, err := os.ReadFile(ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read preset: %v", err)
+		}
+		preset, err := presets.DecodePreset(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid preset %s: %v", ref, err)
+		}
+		return preset, nil
+	}
+
+	userPresets, _ := presets.LoadUserPresets()
+	for _, preset := range append(presets.GetBuiltinPresets(), userPresets...) {
+		if strings.EqualFold(preset.Name, ref) || presets.Slug(preset.Name) == presets.Slug(ref) {
+			return preset, nil
+		}
+	}
+	return nil, fmt.Errorf("%s is neither a preset file nor the name of a preset (see list-presets)", ref)
+}
+
+// printDiff prints preset differences grouped by section
+func printDiff(result *diff.Result) {
+	if len(result.Metadata) > 0 {
+		fmt.Println()
+		color.Cyan("Metadata:")
+		for _, field := range result.Metadata {
+			color.Yellow("  ~ %s", field)
+		}
+	}
+
+	section := ""
+	for _, change := range result.Changes {
+		if change.Section != section {
+			section = change.Section
+			fmt.Println()
+			color.Cyan("%s:", strings.ToUpper(section[:1])+section[1:])
+		}
+
+		switch change.Kind {
+		case diff.Added:
+			color.Green("  + %s", change.Name)
+		case diff.Removed:
+			color.Red("  - %s", change.Name)
+		case diff.Moved:
+			color.Blue("  ↕ %s", change.Name)
+		default:
+			color.Yellow("  ~ %s", change.Name)
+		}
+		for _, field := range change.Fields {
+			color.White("      %s", field)
+		}
+		for _, text := range change.Diffs {
+			color.White("      %s:", text.Field)
+			for _, line := range text.Lines {
+				switch {
+				case strings.HasPrefix(line, "@@"):
+					color.Cyan("        %s", line)
+				case strings.HasPrefix(line, "+"):
+					color.Green("        %s", line)
+				case strings.HasPrefix(line, "-"):
+					color.Red("        %s", line)
+				default:
+					color.HiBlack("        %s", line)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"base-linux-setup/internal/detector"
+	"base-linux-setup/internal/presets"
+	"base-linux-setup/internal/ui"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func newPresetNewCommand() *cobra.Command {
+	var (
+		opts   presets.ScaffoldOptions
+		format string
+		output string
+		force  bool
+		sign   bool
+	)
+
+	command := &cobra.Command{
+		Use:   "new",
+		Short: "Create a preset skeleton for this machine",
+		Long: `Create a new preset with example tasks of each type, its match rule pre-filled
+from the detected environment so detection picks it on similar machines.
+
+Without --name the details are asked interactively. The preset is written to the
+user preset directory unless --output is given.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			interactive := opts.Name == ""
+
+			env, err := detector.DetectEnvironment()
+			if err != nil {
+				color.Yellow("Could not detect the environment, leaving the match rule empty: %v", err)
+			} else {
+				if !cmd.Flags().Changed("match") {
+					opts.Match = presets.DefaultMatch(env)
+				}
+				if opts.Environment == "" {
+					opts.Environment = env.Distribution
+					if env.IsRaspberryPi {
+						opts.Environment += " (Raspberry Pi)"
+					}
+				}
+				opts.Family = presets.Family(env)
+				opts.Architectures = presets.DefaultArchitectures(env)
+			}
+
+			if interactive {
+				if err := promptScaffoldOptions(&opts); err != nil {
+					color.Red("Error: %v", err)
+					os.Exit(1)
+				}
+			}
+
+			preset, err := presets.Scaffold(opts)
+			if err != nil {
+				color.Red("Error creating preset: %v", err)
+				os.Exit(1)
+			}
+
+			data, err := presets.EncodePreset(preset, format)
+			if err != nil {
+				color.Red("Error encoding preset: %v", err)
+				os.Exit(1)
+			}
+
+			if output == "" {
+				if output, err = presets.UserPresetPath(opts.Name, format); err != nil {
+					color.Red("Error: %v", err)
+					os.Exit(1)
+				}
+			}
+			if _, err := os.Stat(output); err == nil && !force {
+				if !interactive || !ui.Confirm(fmt.Sprintf("%s exists. Overwrite it?", output)) {
+					color.Red("Error: %s already exists; use --force to overwrite it", output)
+					os.Exit(1)
+				}
+			}
+
+			if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+				color.Red("Error creating preset directory: %v", err)
+				os.Exit(1)
+			}
+			if err := os.WriteFile(output, data, 0644); err != nil {
+				color.Red("Error writing preset: %v", err)
+				os.Exit(1)
+			}
+			color.Green("✓ Created preset %s", output)
+			if opts.Match != "" {
+				color.White("  Match: %s", opts.Match)
+			}
+
+			if sign || (interactive && ui.Confirm("Sign it with your local key?")) {
+				key, err := loadSigningKey("")
+				if err == nil {
+					err = signPresetFile(key, output)
+				}
+				if err != nil {
+					color.Red("Error: %v", err)
+					os.Exit(1)
+				}
+			}
+
+			fmt.Println()
+			color.Cyan("Next steps:")
+			color.White("  1. Replace the example tasks in %s", output)
+			color.White("  2. Check it: base-linux-setup lint-preset %s", output)
+			color.White("  3. Sign it after each change: base-linux-setup preset sign %s", output)
+			color.White("  4. Try it: base-linux-setup --dry-run")
+		},
+	}
+
+	command.Flags().StringVar(&opts.Name, "name", "", "Preset name (asked interactively when empty)")
+	command.Flags().StringVar(&opts.Description, "description", "", "Preset description")
+	command.Flags().StringVar(&opts.Environment, "environment", "", "Environment the preset targets (default from detection)")
+	command.Flags().StringVar(&opts.Match, "match", "", "Detection condition (default from the detected environment)")
+	command.Flags().StringSliceVar(&opts.TaskTypes, "types", nil, "Example task types to include: command, script, file, service (default all)")
+	command.Flags().StringVar(&format, "format", presets.FormatJSON, "File format: json or yaml")
+	command.Flags().StringVarP(&output, "output", "o", "", "Write the preset to this file instead of the user preset directory")
+	command.Flags().BoolVar(&force, "force", false, "Overwrite an existing file")
+	command.Flags().BoolVar(&sign, "sign", false, "Sign the new preset with your local key")
+
+	return command
+}
+
+// promptScaffoldOptions asks for the details of a new preset, offering the
+// detected values as defaults
+func promptScaffoldOptions(opts *presets.ScaffoldOptions) error {
+	validName := func(input string) error {
+		if presets.Slug(input) == "" {
+			return fmt.Errorf("enter a name with letters or digits")
+		}
+		return nil
+	}
+
+	var err error
+	if opts.Name, err = ui.PromptText("Preset name", opts.Name, validName); err != nil {
+		return err
+	}
+	if opts.Description, err = ui.PromptText("Description", opts.Description, nil); err != nil {
+		return err
+	}
+	if opts.Environment, err = ui.PromptText("Environment", opts.Environment, nil); err != nil {
+		return err
+	}
+	if opts.Match, err = ui.PromptText("Match rule (empty to never select it automatically)", opts.Match, nil); err != nil {
+		return err
+	}
+
+	if opts.TaskTypes, err = ui.SelectFromList("Example tasks to include (none selected: all)", presets.ScaffoldTaskTypes); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,366 @@
+// Package analysis infers what a task needs from what its commands and scripts
+// actually do: root privileges, network access, writes to system paths and reboots.
+package analysis
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"base-linux-setup/internal/presets"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Requirements is what a task was found to need
+type Requirements struct {
+	Sudo    bool    // runs something through sudo
+	Network bool    // downloads or talks to remote hosts
+	Reboot  bool    // reboots the machine
+	Writes  []Write // writes to system paths
+}
+
+// Write is a write to a system path
+type Write struct {
+	Path       string
+	Line       int  // line of the script or command, 0 for file tasks
+	Privileged bool // performed through sudo or by an elevated file task
+}
+
+// Unprivileged returns the system writes made without sudo
+func (r *Requirements) Unprivileged() []Write {
+	writes := make([]Write, 0)
+	for _, write := range r.Writes {
+		if !write.Privileged {
+			writes = append(writes, write)
+		}
+	}
+	return writes
+}
+
+// Summary lists the requirements for display, e.g. "sudo", "network", "writes /etc/hosts"
+func (r *Requirements) Summary() []string {
+	summary := make([]string, 0)
+	if r.Sudo {
+		summary = append(summary, "sudo")
+	}
+	if r.Network {
+		summary = append(summary, "network")
+	}
+	seen := make(map[string]bool)
+	for _, write := range r.Writes {
+		if !seen[write.Path] {
+			seen[write.Path] = true
+			summary = append(summary, "writes "+write.Path)
+		}
+	}
+	if r.Reboot {
+		summary = append(summary, "reboot")
+	}
+	return summary
+}
+
+// templatePattern matches template actions, replaced by a placeholder before parsing
+var templatePattern = regexp.MustCompile(`\{\{.*?\}\}`)
+
+// systemPrefixes are the directories only root may write to
+var systemPrefixes = []string{"/etc", "/usr", "/boot", "/opt", "/var", "/lib", "/bin", "/sbin", "/srv", "/root"}
+
+// networkCommands maps programs that use the network to the subcommands that do,
+// or to nil when every invocation does
+var networkCommands = map[string][]string{
+	"curl":       nil,
+	"wget":       nil,
+	"ping":       nil,
+	"ssh":        nil,
+	"scp":        nil,
+	"rpi-update": nil,
+	"git":        {"clone", "fetch", "pull", "ls-remote", "submodule"},
+	"apt":        {"update", "install", "upgrade", "dist-upgrade", "full-upgrade", "build-dep", "source"},
+	"apt-get":    {"update", "install", "upgrade", "dist-upgrade", "full-upgrade", "build-dep", "source"},
+	"dnf":        {"install", "update", "upgrade"},
+	"yum":        {"install", "update", "upgrade"},
+	"snap":       {"install", "refresh"},
+	"flatpak":    {"install", "update"},
+	"pip":        {"install", "download"},
+	"pip3":       {"install", "download"},
+	"npm":        {"install", "i", "ci"},
+	"go":         {"install", "get", "download"},
+	"docker":     {"pull", "push", "login"},
+}
+
+// writeCommands are programs that write to the paths they are given
+var writeCommands = map[string]bool{
+	"cp": true, "mv": true, "install": true, "tee": true, "mkdir": true, "rm": true,
+	"rmdir": true, "touch": true, "ln": true, "chmod": true, "chown": true, "chgrp": true,
+	"sed": true, "tar": true, "dd": true, "truncate": true, "unzip": true,
+}
+
+// Analyze inspects a task's commands, script or file path. Scripts that do not
+// parse are reported as an error.
+func Analyze(task presets.Task) (*Requirements, error) {
+	a := &analyzer{req: &Requirements{}}
+
+	switch task.Type {
+	case "command":
+		// Commands are split on whitespace and run without a shell
+		for i, command := range task.Commands {
+			a.call(strings.Fields(templatePattern.ReplaceAllString(command, "TEMPLATE")), i+1, false)
+		}
+	case "script":
+		if err := a.script(task.Script, 0, false); err != nil {
+			return a.req, err
+		}
+	case "file":
+		if filePath, _, _ := task.FileSpec(); isSystemPath(filePath) {
+			a.req.Writes = append(a.req.Writes, Write{Path: filePath, Privileged: task.Elevated})
+		}
+	}
+	return a.req, nil
+}
+
+type analyzer struct {
+	req *Requirements
+}
+
+// script parses a shell script and inspects every command in it. Line numbers are
+// offset for scripts nested in "bash -c".
+func (a *analyzer) script(source string, offset int, root bool) error {
+	parser := syntax.NewParser(syntax.KeepComments(false), syntax.Variant(syntax.LangBash))
+	file, err := parser.Parse(strings.NewReader(templatePattern.ReplaceAllString(source, "TEMPLATE")), "")
+	if err != nil {
+		return fmt.Errorf("failed to parse script: %v", err)
+	}
+
+	syntax.Walk(file, func(node syntax.Node) bool {
+		stmt, ok := node.(*syntax.Stmt)
+		if !ok {
+			return true
+		}
+		line := offset + int(stmt.Pos().Line())
+
+		// Redirections are performed by the calling shell, even for "sudo cmd > file"
+		for _, redirect := range stmt.Redirs {
+			switch redirect.Op {
+			case syntax.RdrOut, syntax.AppOut, syntax.RdrAll, syntax.AppAll, syntax.ClbOut:
+				if target := wordText(redirect.Word); isSystemPath(target) {
+					a.req.Writes = append(a.req.Writes, Write{Path: target, Line: line, Privileged: root})
+				}
+			}
+		}
+
+		if call, ok := stmt.Cmd.(*syntax.CallExpr); ok {
+			args := make([]string, len(call.Args))
+			for i, word := range call.Args {
+				args[i] = wordText(word)
+			}
+			a.call(args, line, root)
+		}
+		return true
+	})
+	return nil
+}
+
+// call inspects one command invocation; root is set under sudo
+func (a *analyzer) call(args []string, line int, root bool) {
+	if len(args) == 0 {
+		return
+	}
+	name := path.Base(args[0])
+
+	switch name {
+	case "sudo", "doas", "pkexec":
+		a.req.Sudo = true
+		rest := args[1:]
+		// Skip options, including those taking a value
+		for len(rest) > 0 && strings.HasPrefix(rest[0], "-") {
+			option := rest[0]
+			rest = rest[1:]
+			if (option == "-u" || option == "-g" || option == "-C") && len(rest) > 0 {
+				rest = rest[1:]
+			}
+		}
+		a.call(rest, line, true)
+		return
+	case "env", "nohup", "time", "command", "exec":
+		rest := args[1:]
+		for len(rest) > 0 && (strings.HasPrefix(rest[0], "-") || strings.Contains(rest[0], "=")) {
+			rest = rest[1:]
+		}
+		a.call(rest, line, root)
+		return
+	case "bash", "sh", "dash", "zsh":
+		for i := 1; i+1 < len(args); i++ {
+			if args[i] == "-c" {
+				// Errors in nested scripts are left to the shell that runs them
+				_ = a.script(args[i+1], line-1, root)
+				return
+			}
+		}
+	case "reboot":
+		a.req.Reboot = true
+	case "shutdown":
+		if contains(args[1:], "-r") || contains(args[1:], "--reboot") {
+			a.req.Reboot = true
+		}
+	case "systemctl":
+		if contains(args[1:], "reboot") || contains(args[1:], "kexec") {
+			a.req.Reboot = true
+		}
+	case "init":
+		if contains(args[1:], "6") {
+			a.req.Reboot = true
+		}
+	}
+
+	if subcommands, ok := networkCommands[name]; ok {
+		if subcommands == nil || containsAny(args[1:], subcommands) {
+			a.req.Network = true
+		}
+	}
+	if name == "pacman" {
+		for _, arg := range args[1:] {
+			if strings.HasPrefix(arg, "-S") && !strings.Contains(arg, "s") && !strings.Contains(arg, "i") {
+				a.req.Network = true
+			}
+		}
+	}
+
+	if writeCommands[name] {
+		for _, target := range writeTargets(name, args[1:]) {
+			if isSystemPath(target) {
+				a.req.Writes = append(a.req.Writes, Write{Path: target, Line: line, Privileged: root})
+			}
+		}
+	}
+}
+
+// writeTargets returns the paths a write command modifies
+func writeTargets(name string, args []string) []string {
+	operands := make([]string, 0, len(args))
+	inPlace := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case name == "sed" && sedInPlace(arg):
+			inPlace = true
+			continue
+		case name == "tar" && (arg == "-C" || arg == "--directory") && i+1 < len(args):
+			return []string{args[i+1]}
+		case name == "dd" && strings.HasPrefix(arg, "of="):
+			return []string{strings.TrimPrefix(arg, "of=")}
+		case name == "unzip" && arg == "-d" && i+1 < len(args):
+			return []string{args[i+1]}
+		case strings.HasPrefix(arg, "-"):
+			continue
+		}
+		operands = append(operands, arg)
+	}
+
+	switch name {
+	case "tar", "dd", "unzip":
+		return nil
+	case "sed":
+		// sed only writes to the files it edits in place, the last one given
+		if inPlace && len(operands) > 0 {
+			return operands[len(operands)-1:]
+		}
+		return nil
+	case "cp", "mv", "install", "ln":
+		// The destination comes last
+		if len(operands) > 0 {
+			return operands[len(operands)-1:]
+		}
+		return nil
+	case "chmod", "chown", "chgrp":
+		// The first operand is the mode or owner
+		if len(operands) > 1 {
+			return operands[1:]
+		}
+		return nil
+	default:
+		return operands
+	}
+}
+
+// sedInPlace reports whether a sed option edits files in place: "-i", "-i.bak",
+// "--in-place[=suffix]" or a cluster such as "-ni", but not "-e" or "-f" whose
+// argument happens to hold an "i"
+func sedInPlace(arg string) bool {
+	if arg == "--in-place" || strings.HasPrefix(arg, "--in-place=") {
+		return true
+	}
+	if !strings.HasPrefix(arg, "-") || strings.HasPrefix(arg, "--") {
+		return false
+	}
+	for _, option := range arg[1:] {
+		switch option {
+		case 'i':
+			return true
+		case 'e', 'f', 'l':
+			return false
+		}
+	}
+	return false
+}
+
+// wordText renders a shell word, keeping literal and quoted text and writing
+// parameter expansions as $name
+func wordText(word *syntax.Word) string {
+	if word == nil {
+		return ""
+	}
+	var text strings.Builder
+	var parts func([]syntax.WordPart)
+	parts = func(list []syntax.WordPart) {
+		for _, part := range list {
+			switch p := part.(type) {
+			case *syntax.Lit:
+				text.WriteString(p.Value)
+			case *syntax.SglQuoted:
+				text.WriteString(p.Value)
+			case *syntax.DblQuoted:
+				parts(p.Parts)
+			case *syntax.ParamExp:
+				if p.Param != nil {
+					text.WriteString("$" + p.Param.Value)
+				}
+			}
+		}
+	}
+	parts(word.Parts)
+	return text.String()
+}
+
+// isSystemPath reports whether a path is under a directory only root may write to
+func isSystemPath(target string) bool {
+	if !strings.HasPrefix(target, "/") {
+		return false
+	}
+	cleaned := path.Clean(target)
+	for _, prefix := range systemPrefixes {
+		if cleaned == prefix || strings.HasPrefix(cleaned, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(list, values []string) bool {
+	for _, value := range values {
+		if contains(list, value) {
+			return true
+		}
+	}
+	return false
+}
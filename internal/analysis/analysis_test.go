@@ -0,0 +1,121 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"base-linux-setup/internal/presets"
+)
+
+// writes renders the system writes as "path@line" with a "!" for unprivileged ones
+func writes(req *Requirements) string {
+	parts := make([]string, len(req.Writes))
+	for i, write := range req.Writes {
+		parts[i] = fmt.Sprintf("%s@%d", write.Path, write.Line)
+		if !write.Privileged {
+			parts[i] += "!"
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestAnalyzeScripts(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		sudo    bool
+		network bool
+		reboot  bool
+		writes  string
+	}{
+		{name: "plain command", script: "echo hi"},
+		{name: "sudo", script: "sudo systemctl restart ssh", sudo: true},
+		{name: "sudo with options", script: "sudo -u root -E apt-get update", sudo: true, network: true},
+		{name: "download", script: "curl -fsSLO https://example.com/x", network: true},
+		{name: "git clone but not status", script: "git status\ngit clone https://example.com/r.git", network: true},
+		{name: "local git only", script: "git status"},
+		{name: "pacman sync", script: "sudo pacman -Syu --noconfirm", sudo: true, network: true},
+		{name: "pacman search", script: "pacman -Ss vim"},
+		{name: "reboot", script: "sudo reboot", sudo: true, reboot: true},
+		{name: "shutdown -r", script: "sudo shutdown -r now", sudo: true, reboot: true},
+		{name: "shutdown -h", script: "sudo shutdown -h now", sudo: true},
+		{name: "redirect as the user", script: "echo x > /etc/motd", writes: "/etc/motd@1!"},
+		{name: "redirect after sudo is unprivileged", script: "sudo echo x >> /etc/motd", sudo: true, writes: "/etc/motd@1!"},
+		{name: "tee under sudo", script: "echo x | sudo tee -a /etc/motd", sudo: true, writes: "/etc/motd@1"},
+		{name: "redirect to home", script: "echo x > ~/.motd"},
+		{name: "cp destination", script: "sudo cp /tmp/a /etc/a", sudo: true, writes: "/etc/a@1"},
+		{name: "chmod skips the mode", script: "chmod 0644 /etc/a", writes: "/etc/a@1!"},
+		{name: "tar -C", script: "sudo tar -C /usr/local -xzf go.tgz", sudo: true, writes: "/usr/local@1"},
+		{name: "dd of=", script: "sudo dd if=img of=/boot/img", sudo: true, writes: "/boot/img@1"},
+		{name: "sed -i", script: "sudo sed -i 's/a/b/' /etc/a", sudo: true, writes: "/etc/a@1"},
+		{name: "sed -i.bak", script: "sed -i.bak -e 's/a/b/' /etc/a", writes: "/etc/a@1!"},
+		{name: "sed --in-place", script: "sed --in-place=.orig 's/a/b/' /etc/a", writes: "/etc/a@1!"},
+		{name: "sed -ni", script: "sed -ni '/a/p' /etc/a", writes: "/etc/a@1!"},
+		{name: "sed reading a system file", script: "sed 's/a/b/' /etc/a > /tmp/a"},
+		{name: "sed -e holding an i", script: "sed -e 's/i/j/' /etc/a"},
+		{name: "sed -n", script: "sed -n '/a/p' /etc/a"},
+		{name: "line numbers", script: "#!/bin/bash\nset -e\n\necho x > /etc/motd", writes: "/etc/motd@4!"},
+		{name: "bash -c", script: "echo\nsudo bash -c 'echo x > /etc/motd'", sudo: true, writes: "/etc/motd@2"},
+		{name: "env prefix", script: "env DEBIAN_FRONTEND=noninteractive apt-get install -y x", network: true},
+		{name: "template placeholder", script: "sudo cp a {{ .dest }}", sudo: true},
+	}
+
+	for _, tt := range tests {
+		req, err := Analyze(presets.Task{Type: "script", Script: tt.script})
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if req.Sudo != tt.sudo || req.Network != tt.network || req.Reboot != tt.reboot {
+			t.Errorf("%s: sudo=%v network=%v reboot=%v, want %v %v %v", tt.name, req.Sudo, req.Network, req.Reboot, tt.sudo, tt.network, tt.reboot)
+		}
+		if got := writes(req); got != tt.writes {
+			t.Errorf("%s: writes = %q, want %q", tt.name, got, tt.writes)
+		}
+	}
+}
+
+func TestAnalyzeCommands(t *testing.T) {
+	req, err := Analyze(presets.Task{Type: "command", Commands: []string{
+		"sudo apt-get update",
+		"sed -i s/a/b/ /etc/a",
+		"sed s/a/b/ /etc/b",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !req.Sudo || !req.Network || writes(req) != "/etc/a@2!" {
+		t.Errorf("requirements = %+v", req)
+	}
+}
+
+func TestAnalyzeFiles(t *testing.T) {
+	tests := []struct {
+		task presets.Task
+		want string
+	}{
+		{presets.Task{Type: "file", Path: "/etc/motd"}, "/etc/motd@0!"},
+		{presets.Task{Type: "file", Path: "/etc/motd", Elevated: true}, "/etc/motd@0"},
+		{presets.Task{Type: "file", Path: "/home/pi/.motd"}, ""},
+	}
+	for _, tt := range tests {
+		req, err := Analyze(tt.task)
+		if err != nil || writes(req) != tt.want {
+			t.Errorf("%s: writes = %q, %v; want %q", tt.task.Path, writes(req), err, tt.want)
+		}
+	}
+}
+
+func TestAnalyzeParseError(t *testing.T) {
+	if _, err := Analyze(presets.Task{Type: "script", Script: "if true; then\necho"}); err == nil {
+		t.Error("expected an error for an unterminated if")
+	}
+}
+
+func TestSummary(t *testing.T) {
+	req := &Requirements{Sudo: true, Reboot: true, Writes: []Write{{Path: "/etc/a"}, {Path: "/etc/a", Line: 2}}}
+	if got := strings.Join(req.Summary(), ", "); got != "sudo, writes /etc/a, reboot" {
+		t.Errorf("Summary() = %q", got)
+	}
+}
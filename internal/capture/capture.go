@@ -0,0 +1,460 @@
+// Package capture inspects the running system and builds a preset that would
+// reproduce it: manually installed packages, enabled services, changed
+// configuration files, user groups and Raspberry Pi boot overlays.
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unicode/utf8"
+
+	"base-linux-setup/internal/presets"
+)
+
+// Sections are the parts of the system that can be captured
+var Sections = []string{"packages", "services", "configs", "groups", "boot"}
+
+// maxConfigSize is the largest configuration file copied into a preset
+const maxConfigSize = 64 * 1024
+
+// bootConfigFiles are the Raspberry Pi firmware configuration files, newest location first
+var bootConfigFiles = []string{"/boot/firmware/config.txt", "/boot/config.txt"}
+
+// System is what was found on the running system
+type System struct {
+	Family      string // package family, see presets.Family
+	Packages    []string
+	Services    []string
+	ConfigFiles []ConfigFile
+	User        string
+	Groups      []string
+	BootConfig  string   // path of the firmware configuration file
+	BootLines   []string // dtoverlay and dtparam lines of the firmware configuration
+	Warnings    []string // things that could not be captured
+}
+
+// ConfigFile is a configuration file changed from its package default
+type ConfigFile struct {
+	Path    string
+	Mode    string
+	Owner   string
+	Group   string
+	Content string
+}
+
+// Inspect captures the requested sections, all when empty, of a system of the
+// given package family. Sections that cannot be read add a warning.
+func Inspect(family string, sections []string) (*System, error) {
+	if len(sections) == 0 {
+		sections = Sections
+	}
+	s := &System{Family: family}
+
+	for _, section := range sections {
+		var err error
+		switch section {
+		case "packages":
+			err = s.inspectPackages()
+		case "services":
+			err = s.inspectServices()
+		case "configs":
+			err = s.inspectConfigFiles()
+		case "groups":
+			err = s.inspectGroups()
+		case "boot":
+			err = s.inspectBoot()
+		default:
+			return nil, fmt.Errorf("unknown section %q (expected one of %s)", section, strings.Join(Sections, ", "))
+		}
+		if err != nil {
+			s.Warnings = append(s.Warnings, fmt.Sprintf("%s: %v", section, err))
+		}
+	}
+	return s, nil
+}
+
+// inspectPackages lists the packages installed explicitly rather than as dependencies
+func (s *System) inspectPackages() error {
+	var output []byte
+	var err error
+	switch s.Family {
+	case presets.FamilyDebian:
+		output, err = exec.Command("apt-mark", "showmanual").Output()
+	case presets.FamilyArch:
+		output, err = exec.Command("pacman", "-Qqe").Output()
+	default:
+		return fmt.Errorf("unsupported package manager")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list packages: %v", err)
+	}
+	s.Packages = strings.Fields(string(output))
+	sort.Strings(s.Packages)
+	return nil
+}
+
+// inspectServices lists the services enabled against their vendor preset
+func (s *System) inspectServices() error {
+	output, err := exec.Command("systemctl", "list-unit-files", "--type=service", "--state=enabled", "--no-legend", "--no-pager").Output()
+	if err != nil {
+		return fmt.Errorf("failed to list services: %v", err)
+	}
+
+	withoutPreset := false
+	for _, line := range strings.Split(string(output), "\n") {
+		// UNIT FILE, STATE and, on newer systemd, VENDOR PRESET
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[1] != "enabled" || strings.HasSuffix(fields[0], "@.service") {
+			continue
+		}
+		if len(fields) < 3 {
+			withoutPreset = true
+		} else if fields[2] == "enabled" {
+			continue
+		}
+		s.Services = append(s.Services, strings.TrimSuffix(fields[0], ".service"))
+	}
+	if withoutPreset {
+		s.Warnings = append(s.Warnings, "services: systemd does not report vendor presets, so every enabled service was captured")
+	}
+	return nil
+}
+
+// inspectConfigFiles finds the configuration files changed since their package installed them
+func (s *System) inspectConfigFiles() error {
+	var paths []string
+	var err error
+	switch s.Family {
+	case presets.FamilyDebian:
+		paths, err = changedConffiles()
+	case presets.FamilyArch:
+		paths, err = modifiedBackupFiles()
+	default:
+		return fmt.Errorf("unsupported package manager")
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		file, err := readConfigFile(path)
+		if err != nil {
+			s.Warnings = append(s.Warnings, fmt.Sprintf("configs: skipping %s: %v", path, err))
+			continue
+		}
+		s.ConfigFiles = append(s.ConfigFiles, *file)
+	}
+	return nil
+}
+
+// changedConffiles compares dpkg conffiles to the checksums recorded at installation
+func changedConffiles() ([]string, error) {
+	output, err := exec.Command("dpkg-query", "-W", "-f", "${Conffiles}\n").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conffiles: %v", err)
+	}
+
+	paths := make([]string, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		// " /etc/path md5sum [obsolete]"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || len(fields) > 2 && fields[2] == "obsolete" {
+			continue
+		}
+		data, err := os.ReadFile(fields[0])
+		if err != nil {
+			// Removed or unreadable files are reported when copying them
+			if !os.IsNotExist(err) {
+				paths = append(paths, fields[0])
+			}
+			continue
+		}
+		sum := md5.Sum(data)
+		if hex.EncodeToString(sum[:]) != fields[1] {
+			paths = append(paths, fields[0])
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// modifiedBackupFiles lists the pacman backup files marked as modified
+func modifiedBackupFiles() ([]string, error) {
+	output, err := exec.Command("pacman", "-Qii").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backup files: %v", err)
+	}
+
+	paths := make([]string, 0)
+	for _, line := range strings.Split(string(output), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "MODIFIED" {
+			paths = append(paths, fields[1])
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// readConfigFile reads a text configuration file with its permissions and ownership
+func readConfigFile(path string) (*ConfigFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxConfigSize {
+		return nil, fmt.Errorf("larger than %d KiB", maxConfigSize/1024)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsPermission(err) {
+			return nil, fmt.Errorf("permission denied; run capture with sudo to include it")
+		}
+		return nil, err
+	}
+	if !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+		return nil, fmt.Errorf("not a text file")
+	}
+
+	file := &ConfigFile{
+		Path:    path,
+		Mode:    fmt.Sprintf("%04o", info.Mode().Perm()),
+		Content: string(data),
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		file.Owner = lookupUser(stat.Uid)
+		file.Group = lookupGroup(stat.Gid)
+	}
+	return file, nil
+}
+
+// inspectGroups lists the supplementary groups of the user running the capture,
+// or of the user who invoked sudo
+func (s *System) inspectGroups() error {
+	name := os.Getenv("SUDO_USER")
+	if name == "" {
+		current, err := user.Current()
+		if err != nil {
+			return fmt.Errorf("failed to look up the current user: %v", err)
+		}
+		name = current.Username
+	}
+	account, err := user.Lookup(name)
+	if err != nil {
+		return fmt.Errorf("failed to look up user %s: %v", name, err)
+	}
+	ids, err := account.GroupIds()
+	if err != nil {
+		return fmt.Errorf("failed to list the groups of %s: %v", name, err)
+	}
+
+	s.User = name
+	for _, id := range ids {
+		if id == account.Gid {
+			continue
+		}
+		if group, err := user.LookupGroupId(id); err == nil {
+			s.Groups = append(s.Groups, group.Name)
+		}
+	}
+	sort.Strings(s.Groups)
+	return nil
+}
+
+// inspectBoot reads the overlays and parameters of the Raspberry Pi firmware configuration
+func (s *System) inspectBoot() error {
+	for _, path := range bootConfigFiles {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", path, err)
+		}
+
+		s.BootConfig = path
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "dtoverlay=") || strings.HasPrefix(line, "dtparam=") {
+				s.BootLines = append(s.BootLines, line)
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+// Preset builds a preset reproducing the captured system. Config file contents are
+// copied verbatim, so the preset should be reviewed before it is shared.
+func (s *System) Preset(name, environment, match string, architectures []string) (*presets.Preset, error) {
+	preset := &presets.Preset{
+		SchemaVersion: presets.CurrentSchemaVersion,
+		Name:          name,
+		Environment:   environment,
+		Description:   "Captured from a configured system; review before use",
+		Match:         match,
+		Version:       "0.1.0",
+		Architectures: architectures,
+	}
+	if preset.Environment == "" {
+		preset.Environment = name
+	}
+
+	if len(s.Packages) > 0 {
+		packages := make([]interface{}, len(s.Packages))
+		for i, pkg := range s.Packages {
+			packages[i] = pkg
+		}
+		preset.Variables = append(preset.Variables, presets.Variable{
+			Name:        "packages",
+			Description: "Packages to install",
+			Type:        "list",
+			Default:     packages,
+		})
+		preset.Tasks = append(preset.Tasks, presets.PackageTasks(s.Family)...)
+	}
+
+	for _, file := range s.ConfigFiles {
+		preset.Tasks = append(preset.Tasks, presets.Task{
+			ID:          "config-" + presets.Slug(file.Path),
+			Name:        "Configure " + file.Path,
+			Description: "Restore the captured contents of " + file.Path,
+			Type:        "file",
+			Path:        file.Path,
+			Mode:        file.Mode,
+			Owner:       file.Owner,
+			Group:       file.Group,
+			Content:     presets.EscapeTemplate(file.Content),
+			Elevated:    true,
+			Tags:        []string{"config"},
+		})
+	}
+
+	enabled := true
+	for _, service := range s.Services {
+		preset.Tasks = append(preset.Tasks, presets.Task{
+			ID:          "service-" + presets.Slug(service),
+			Name:        "Enable " + service,
+			Description: "Start " + service + " now and on boot",
+			Type:        "service",
+			Service:     service,
+			State:       "started",
+			Enabled:     &enabled,
+			Elevated:    true,
+			Optional:    true,
+			Tags:        []string{"services"},
+		})
+	}
+
+	if len(s.Groups) > 0 {
+		groups := make([]interface{}, len(s.Groups))
+		for i, group := range s.Groups {
+			groups[i] = group
+		}
+		preset.Variables = append(preset.Variables,
+			presets.Variable{Name: "user", Description: "User added to the groups", Type: "string", Default: s.User},
+			presets.Variable{Name: "groups", Description: "Supplementary groups of the user", Type: "list", Default: groups},
+		)
+		preset.Tasks = append(preset.Tasks, presets.Task{
+			ID:          "user-groups",
+			Name:        "Add User to Groups",
+			Description: "Add the user to the captured supplementary groups",
+			Type:        "command",
+			Commands:    []string{`sudo usermod -aG {{ join "," .groups }} {{ .user }}`},
+			Elevated:    true,
+			Tags:        []string{"users"},
+		})
+	}
+
+	if len(s.BootLines) > 0 {
+		preset.Tasks = append(preset.Tasks, presets.Task{
+			ID:          "boot-overlays",
+			Name:        "Configure Boot Overlays",
+			Description: "Add the captured dtoverlay and dtparam lines to the firmware configuration",
+			Type:        "script",
+			Script:      bootScript(s.BootLines),
+			Elevated:    true,
+			Tags:        []string{"boot"},
+		})
+		preset.RebootRequired = true
+	}
+
+	if len(preset.Tasks) == 0 {
+		return nil, fmt.Errorf("nothing was captured")
+	}
+	if err := preset.Validate(); err != nil {
+		return nil, fmt.Errorf("captured preset is invalid: %v", err)
+	}
+	return preset, nil
+}
+
+// bootScript returns a script adding each line to the firmware configuration once
+func bootScript(lines []string) string {
+	var script strings.Builder
+	script.WriteString("#!/bin/bash\nset -e\n\n")
+	fmt.Fprintf(&script, "CONFIG=%s\n", bootConfigFiles[0])
+	fmt.Fprintf(&script, "[ -f \"$CONFIG\" ] || CONFIG=%s\n\n", bootConfigFiles[1])
+	script.WriteString("for line in \\\n")
+	for _, line := range lines {
+		fmt.Fprintf(&script, "    %s \\\n", shellQuote(line))
+	}
+	script.WriteString("; do\n")
+	script.WriteString("    grep -qxF \"$line\" \"$CONFIG\" || echo \"$line\" | sudo tee -a \"$CONFIG\" > /dev/null\n")
+	script.WriteString("done")
+	return script.String()
+}
+
+func shellQuote(text string) string {
+	return "'" + strings.ReplaceAll(text, "'", `'\''`) + "'"
+}
+
+func lookupUser(uid uint32) string {
+	id := strconv.FormatUint(uint64(uid), 10)
+	if account, err := user.LookupId(id); err == nil {
+		return account.Username
+	}
+	return id
+}
+
+func lookupGroup(gid uint32) string {
+	id := strconv.FormatUint(uint64(gid), 10)
+	if group, err := user.LookupGroupId(id); err == nil {
+		return group.Name
+	}
+	return id
+}
+
+// Summary describes what was captured, one line per section
+func (s *System) Summary() []string {
+	summary := make([]string, 0)
+	if len(s.Packages) > 0 {
+		summary = append(summary, fmt.Sprintf("%d manually installed packages", len(s.Packages)))
+	}
+	if len(s.Services) > 0 {
+		summary = append(summary, fmt.Sprintf("%d enabled services: %s", len(s.Services), strings.Join(s.Services, ", ")))
+	}
+	if len(s.ConfigFiles) > 0 {
+		paths := make([]string, len(s.ConfigFiles))
+		for i, file := range s.ConfigFiles {
+			paths[i] = file.Path
+		}
+		summary = append(summary, fmt.Sprintf("%d changed config files: %s", len(paths), strings.Join(paths, ", ")))
+	}
+	if len(s.Groups) > 0 {
+		summary = append(summary, fmt.Sprintf("groups of %s: %s", s.User, strings.Join(s.Groups, ", ")))
+	}
+	if len(s.BootLines) > 0 {
+		summary = append(summary, fmt.Sprintf("%d boot overlay lines from %s", len(s.BootLines), s.BootConfig))
+	}
+	return summary
+}
@@ -0,0 +1,149 @@
+package capture
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"base-linux-setup/internal/lint"
+	"base-linux-setup/internal/presets"
+)
+
+func testSystem() *System {
+	return &System{
+		Family:   presets.FamilyDebian,
+		Packages: []string{"git", "vim"},
+		Services: []string{"ssh"},
+		ConfigFiles: []ConfigFile{
+			{Path: "/etc/motd", Mode: "0644", Owner: "root", Group: "root", Content: "Hello {{ world }}\n"},
+		},
+		User:       "pi",
+		Groups:     []string{"i2c", "gpio"},
+		BootConfig: "/boot/firmware/config.txt",
+		BootLines:  []string{"dtparam=i2c_arm=on", "dtoverlay=it's-quoted"},
+	}
+}
+
+func TestPreset(t *testing.T) {
+	preset, err := testSystem().Preset("Lab Pi", "", "board.raspberry_pi", []string{"aarch64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make([]string, 0, len(preset.Tasks))
+	for _, task := range preset.Tasks {
+		ids = append(ids, task.ID)
+	}
+	want := "config-etc-motd,service-ssh,user-groups,boot-overlays"
+	if got := strings.Join(ids, ","); !strings.HasSuffix(got, want) {
+		t.Errorf("task IDs = %s, want them to end with %s", got, want)
+	}
+	if preset.Environment != "Lab Pi" || !preset.RebootRequired || preset.SchemaVersion != presets.CurrentSchemaVersion {
+		t.Errorf("preset = %+v", preset)
+	}
+
+	var names []string
+	for _, variable := range preset.Variables {
+		names = append(names, variable.Name)
+	}
+	if strings.Join(names, ",") != "packages,user,groups" {
+		t.Errorf("variables = %v", names)
+	}
+
+	// File contents are copied verbatim, so template actions in them are escaped
+	for _, task := range preset.Tasks {
+		if task.ID != "config-etc-motd" {
+			continue
+		}
+		rendered, err := presets.RenderTask(task, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, content := rendered.FileSpec(); content != "Hello {{ world }}\n" {
+			t.Errorf("rendered content = %q, want the captured content", content)
+		}
+	}
+}
+
+func TestPresetRoundTrips(t *testing.T) {
+	preset, err := testSystem().Preset("Lab Pi", "", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := presets.EncodePreset(preset, presets.FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := presets.DecodePreset(data)
+	if err != nil {
+		t.Fatalf("captured preset does not load: %v\n%s", err, data)
+	}
+	if len(decoded.Tasks) != len(preset.Tasks) {
+		t.Errorf("decoded %d tasks, want %d", len(decoded.Tasks), len(preset.Tasks))
+	}
+	if findings := lint.Lint(decoded); lint.Failed(findings, lint.Error) {
+		t.Errorf("captured preset has lint errors: %v", findings)
+	}
+}
+
+func TestPresetNothingCaptured(t *testing.T) {
+	if _, err := (&System{Family: presets.FamilyDebian}).Preset("Empty", "", "", nil); err == nil {
+		t.Error("expected an error for an empty capture")
+	}
+}
+
+func TestBootScript(t *testing.T) {
+	script := bootScript([]string{"dtparam=i2c_arm=on", "dtoverlay=it's-quoted"})
+	if !strings.Contains(script, `'dtoverlay=it'\''s-quoted'`) {
+		t.Errorf("lines are not quoted:\n%s", script)
+	}
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not found")
+	}
+	cmd := exec.Command("bash", "-n")
+	cmd.Stdin = bytes.NewReader([]byte(script))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("bash -n: %v\n%s\n%s", err, output, script)
+	}
+}
+
+func TestReadConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0640); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	file, err := readConfigFile(write("text.conf", []byte("key=value\n")))
+	if err != nil || file.Mode != "0640" || file.Content != "key=value\n" || file.Owner == "" {
+		t.Errorf("readConfigFile = %+v, %v", file, err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"binary.conf", []byte("a\x00b"), "not a text file"},
+		{"latin1.conf", []byte("caf\xe9"), "not a text file"},
+		{"large.conf", bytes.Repeat([]byte("x"), maxConfigSize+1), "larger than"},
+	}
+	for _, tt := range tests {
+		if _, err := readConfigFile(write(tt.name, tt.data)); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want it to contain %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	summary := testSystem().Summary()
+	if len(summary) != 5 || summary[0] != "2 manually installed packages" || !strings.Contains(summary[4], "/boot/firmware/config.txt") {
+		t.Errorf("Summary() = %q", summary)
+	}
+}
@@ -2,21 +2,27 @@ package detector
 
 import (
 	"fmt"
+	"net"
+	"os"
 	"os/exec"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
 // Environment represents the detected system environment
 type Environment struct {
-	OS           string
-	Distribution string
-	Version      string
-	Architecture string
-	Hardware     string
-	Kernel       string
+	OS            string
+	Distribution  string
+	Version       string
+	Architecture  string
+	Hardware      string
+	Kernel        string
 	IsRaspberryPi bool
-	RawOutput    string
+	Board         string   // board model string, e.g. "Raspberry Pi 4 Model B Rev 1.4"
+	BoardModel    int      // Raspberry Pi generation parsed from Board, 0 if unknown
+	Interfaces    []string // non-loopback network interface names
+	RawOutput     string
 }
 
 // DetectEnvironment detects the current environment using neofetch
@@ -82,6 +88,9 @@ func DetectEnvironment() (*Environment, error) {
 
 	// Detect hardware
 	env.Hardware = detectHardware()
+	env.Board = detectBoard()
+	env.BoardModel = parseBoardModel(env.Board)
+	env.Interfaces = detectInterfaces()
 
 	return env, nil
 }
@@ -164,4 +173,43 @@ func detectHardware() string {
 	}
 
 	return "Generic"
-} 
\ No newline at end of file
+} 
+
+// detectBoard reads the board model from the device tree
+func detectBoard() string {
+	data, err := os.ReadFile("/proc/device-tree/model")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(data), "\x00"))
+}
+
+// parseBoardModel extracts the Raspberry Pi generation from a board model string
+func parseBoardModel(board string) int {
+	matches := regexp.MustCompile(`Raspberry Pi (?:Compute Module )?(\d+)`).FindStringSubmatch(board)
+	if len(matches) < 2 {
+		return 0
+	}
+	model, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return 0
+	}
+	return model
+}
+
+// detectInterfaces lists the non-loopback network interfaces
+func detectInterfaces() []string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(ifaces))
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		names = append(names, iface.Name)
+	}
+	return names
+}
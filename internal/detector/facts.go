@@ -0,0 +1,30 @@
+package detector
+
+import "strings"
+
+// FactNames lists the top-level names that Facts exposes to presets
+var FactNames = []string{"os", "distro", "version", "arch", "kernel", "hardware", "board", "interfaces"}
+
+// Facts returns the detected environment as template and expression data.
+// Keys are lowercase so presets can reference them as {{ .arch }} or board.model.
+func (e *Environment) Facts() map[string]interface{} {
+	interfaces := make([]interface{}, 0, len(e.Interfaces))
+	for _, name := range e.Interfaces {
+		interfaces = append(interfaces, name)
+	}
+
+	return map[string]interface{}{
+		"os":       e.OS,
+		"distro":   strings.ToLower(e.Distribution),
+		"version":  e.Version,
+		"arch":     e.Architecture,
+		"kernel":   e.Kernel,
+		"hardware": e.Hardware,
+		"board": map[string]interface{}{
+			"name":         e.Board,
+			"model":        e.BoardModel,
+			"raspberry_pi": e.IsRaspberryPi,
+		},
+		"interfaces": interfaces,
+	}
+}
@@ -0,0 +1,412 @@
+// Package diff compares presets by meaning rather than by text: tasks added,
+// removed or moved, changed fields, and line diffs of commands, scripts and file
+// contents.
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"base-linux-setup/internal/presets"
+)
+
+// Kind is how an item changed between two presets
+type Kind string
+
+const (
+	Added    Kind = "added"
+	Removed  Kind = "removed"
+	Modified Kind = "modified"
+	Moved    Kind = "moved"
+)
+
+// Change is a task, handler, variable or profile that differs
+type Change struct {
+	Kind    Kind
+	Section string   // "tasks", "handlers", "variables" or "profiles"
+	Name    string   // display name, with its parent block for nested tasks
+	Fields  []string // changed fields, e.g. "elevated: false → true"
+	Diffs   []Text   // line diffs of commands, scripts and contents
+}
+
+// Text is the unified diff of one multi-line field
+type Text struct {
+	Field string
+	Lines []string
+}
+
+// Result is everything that differs between two presets
+type Result struct {
+	Metadata []string // changed top-level fields
+	Changes  []Change
+}
+
+// IsEmpty reports whether the presets are equivalent
+func (r *Result) IsEmpty() bool {
+	return len(r.Metadata) == 0 && len(r.Changes) == 0
+}
+
+// textFields are task fields compared line by line rather than as values
+var textFields = map[string]bool{"commands": true, "script": true, "content": true}
+
+// nestedFields are the task lists of block tasks, compared task by task
+var nestedFields = []string{"block", "rescue", "always"}
+
+// presetSections are the top-level fields compared item by item rather than as values
+var presetSections = map[string]bool{"tasks": true, "handlers": true, "variables": true, "profiles": true}
+
+// Presets compares preset a to preset b. Context is the number of unchanged lines
+// shown around each change in line diffs.
+func Presets(a, b *presets.Preset, context int) (*Result, error) {
+	result := &Result{}
+
+	metaA, err := fields(a)
+	if err != nil {
+		return nil, err
+	}
+	metaB, err := fields(b)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range unionKeys(metaA, metaB) {
+		if presetSections[key] || key == "schema_version" {
+			continue
+		}
+		if change := fieldChange(key, metaA[key], metaB[key]); change != "" {
+			result.Metadata = append(result.Metadata, change)
+		}
+	}
+
+	d := &differ{context: context, result: result}
+	if err := d.tasks("tasks", "", a.Tasks, b.Tasks); err != nil {
+		return nil, err
+	}
+	if err := d.tasks("handlers", "", a.Handlers, b.Handlers); err != nil {
+		return nil, err
+	}
+	if err := d.items("variables", variableItems(a.Variables), variableItems(b.Variables)); err != nil {
+		return nil, err
+	}
+	if err := d.items("profiles", profileItems(a.Profiles), profileItems(b.Profiles)); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+type differ struct {
+	context int
+	result  *Result
+}
+
+// item is a named entry of a preset section
+type item struct {
+	key   string // identity used to pair entries of both presets
+	name  string
+	value interface{}
+}
+
+// tasks compares two task lists, pairing tasks by ID, or by name for tasks without one
+func (d *differ) tasks(section, parent string, a, b []presets.Task) error {
+	itemsA, itemsB := taskItems(a), taskItems(b)
+	if err := d.items(section, withParent(parent, itemsA), withParent(parent, itemsB)); err != nil {
+		return err
+	}
+
+	// Compare the nested tasks of blocks present in both lists
+	indexB := make(map[string]presets.Task)
+	for i, it := range itemsB {
+		indexB[it.key] = b[i]
+	}
+	for i, it := range itemsA {
+		taskB, ok := indexB[it.key]
+		if !ok {
+			continue
+		}
+		for _, field := range nestedFields {
+			listA, listB := nested(a[i], field), nested(taskB, field)
+			label := it.name
+			if field != "block" {
+				label += " (" + field + ")"
+			}
+			if err := d.tasks(section, label, listA, listB); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// items reports entries added to, removed from, changed in or moved within a section
+func (d *differ) items(section string, a, b []item) error {
+	indexA := make(map[string]item)
+	for _, it := range a {
+		indexA[it.key] = it
+	}
+	indexB := make(map[string]item)
+	for _, it := range b {
+		indexB[it.key] = it
+	}
+
+	for _, it := range a {
+		if _, ok := indexB[it.key]; !ok {
+			d.result.Changes = append(d.result.Changes, Change{Kind: Removed, Section: section, Name: it.name})
+		}
+	}
+
+	// Entries kept in both lists but outside their longest common order were moved
+	commonA, commonB := make([]string, 0), make([]string, 0)
+	for _, it := range a {
+		if _, ok := indexB[it.key]; ok {
+			commonA = append(commonA, it.key)
+		}
+	}
+	for _, it := range b {
+		if _, ok := indexA[it.key]; ok {
+			commonB = append(commonB, it.key)
+		}
+	}
+	moved := make(map[string]bool)
+	for _, e := range editScript(commonA, commonB) {
+		if e.kind == '+' {
+			moved[e.text] = true
+		}
+	}
+
+	for position, it := range b {
+		old, ok := indexA[it.key]
+		if !ok {
+			d.result.Changes = append(d.result.Changes, Change{Kind: Added, Section: section, Name: it.name})
+			continue
+		}
+
+		change, err := d.compare(section, old.value, it.value)
+		if err != nil {
+			return err
+		}
+		change.Name = it.name
+		if moved[it.key] {
+			change.Fields = append([]string{fmt.Sprintf("position: %d → %d", indexOf(a, it.key)+1, position+1)}, change.Fields...)
+		}
+		if len(change.Fields) > 0 || len(change.Diffs) > 0 {
+			change.Kind = Modified
+			if moved[it.key] && len(change.Fields) == 1 && len(change.Diffs) == 0 {
+				change.Kind = Moved
+			}
+			d.result.Changes = append(d.result.Changes, change)
+		}
+	}
+	return nil
+}
+
+// compare lists the fields that differ between two versions of an entry. Nested
+// task lists are left to tasks.
+func (d *differ) compare(section string, a, b interface{}) (Change, error) {
+	change := Change{Section: section}
+	fieldsA, err := fields(a)
+	if err != nil {
+		return change, err
+	}
+	fieldsB, err := fields(b)
+	if err != nil {
+		return change, err
+	}
+
+	for _, key := range unionKeys(fieldsA, fieldsB) {
+		switch {
+		case contains(nestedFields, key):
+			continue
+		case textFields[key]:
+			if lines := Unified(text(fieldsA[key]), text(fieldsB[key]), d.context); len(lines) > 0 {
+				change.Diffs = append(change.Diffs, Text{Field: key, Lines: lines})
+			}
+		default:
+			if field := fieldChange(key, fieldsA[key], fieldsB[key]); field != "" {
+				change.Fields = append(change.Fields, field)
+			}
+		}
+	}
+	return change, nil
+}
+
+// taskItems keys tasks by ID, or by name for tasks without one, numbering repeats
+func taskItems(tasks []presets.Task) []item {
+	items := make([]item, len(tasks))
+	seen := make(map[string]int)
+	for i, task := range tasks {
+		key := "name:" + task.Name
+		if task.ID != "" {
+			key = "id:" + task.ID
+		}
+		seen[key]++
+		if seen[key] > 1 {
+			key = fmt.Sprintf("%s#%d", key, seen[key])
+		}
+		name := task.Name
+		if name == "" {
+			name = task.ID
+		}
+		items[i] = item{key: key, name: name, value: task}
+	}
+	return items
+}
+
+func variableItems(variables []presets.Variable) []item {
+	items := make([]item, len(variables))
+	for i, variable := range variables {
+		items[i] = item{key: variable.Name, name: variable.Name, value: variable}
+	}
+	return items
+}
+
+func profileItems(profiles []presets.Profile) []item {
+	items := make([]item, len(profiles))
+	for i, profile := range profiles {
+		items[i] = item{key: profile.Name, name: profile.Name, value: profile}
+	}
+	return items
+}
+
+// withParent prefixes the names of nested tasks with their block
+func withParent(parent string, items []item) []item {
+	if parent == "" {
+		return items
+	}
+	for i := range items {
+		items[i].name = parent + " › " + items[i].name
+	}
+	return items
+}
+
+func nested(task presets.Task, field string) []presets.Task {
+	switch field {
+	case "rescue":
+		return task.Rescue
+	case "always":
+		return task.Always
+	default:
+		return task.Block
+	}
+}
+
+func indexOf(items []item, key string) int {
+	for i, it := range items {
+		if it.key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// fields returns the fields of a value as they appear in a preset file
+func fields(value interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode preset: %v", err)
+	}
+	result := make(map[string]interface{})
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode preset: %v", err)
+	}
+	return result, nil
+}
+
+// unionKeys returns the keys of both maps, sorted
+func unionKeys(a, b map[string]interface{}) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// fieldChange describes how a field changed, or returns "" when it did not. Lists
+// of strings are shown as the items added and removed.
+func fieldChange(key string, a, b interface{}) string {
+	if reflect.DeepEqual(a, b) {
+		return ""
+	}
+	listA, okA := stringList(a)
+	listB, okB := stringList(b)
+	if okA && okB {
+		changes := make([]string, 0)
+		for _, value := range listB {
+			if !contains(listA, value) {
+				changes = append(changes, "+"+value)
+			}
+		}
+		for _, value := range listA {
+			if !contains(listB, value) {
+				changes = append(changes, "-"+value)
+			}
+		}
+		if len(changes) == 0 {
+			changes = append(changes, "reordered")
+		}
+		return fmt.Sprintf("%s: %s", key, strings.Join(changes, " "))
+	}
+	return fmt.Sprintf("%s: %s → %s", key, display(a), display(b))
+}
+
+// stringList returns a list of strings, treating a missing list as empty
+func stringList(value interface{}) ([]string, bool) {
+	if value == nil {
+		return nil, true
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	list := make([]string, len(items))
+	for i, item := range items {
+		text, ok := item.(string)
+		if !ok {
+			return nil, false
+		}
+		list[i] = text
+	}
+	return list, true
+}
+
+// display formats a field value, compactly encoding maps and nested lists
+func display(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "(unset)"
+	case string:
+		return fmt.Sprintf("%q", v)
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// text returns a multi-line field as text, one command per line
+func text(value interface{}) string {
+	if list, ok := stringList(value); ok && value != nil {
+		return strings.Join(list, "\n")
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return ""
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
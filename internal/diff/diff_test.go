@@ -0,0 +1,177 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	"base-linux-setup/internal/presets"
+)
+
+func cmd(id, name string, commands ...string) presets.Task {
+	return presets.Task{ID: id, Name: name, Type: "command", Commands: commands}
+}
+
+// summary renders changes as "kind section name [fields] {diffed fields}" lines
+func summary(result *Result) string {
+	lines := make([]string, 0, len(result.Changes))
+	for _, change := range result.Changes {
+		line := string(change.Kind) + " " + change.Section + " " + change.Name
+		if len(change.Fields) > 0 {
+			line += " [" + strings.Join(change.Fields, "; ") + "]"
+		}
+		if len(change.Diffs) > 0 {
+			diffed := make([]string, len(change.Diffs))
+			for i, text := range change.Diffs {
+				diffed[i] = text.Field
+			}
+			line += " {" + strings.Join(diffed, ",") + "}"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestPresets(t *testing.T) {
+	base := func() *presets.Preset {
+		return &presets.Preset{
+			Name: "p", Description: "d",
+			Variables: []presets.Variable{{Name: "hostname", Type: "hostname", Default: "a"}},
+			Tasks: []presets.Task{
+				cmd("update", "Update", "sudo apt-get update"),
+				cmd("tools", "Tools", "sudo apt-get install -y git"),
+				cmd("", "Unnamed ID", "true"),
+			},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(p *presets.Preset)
+		want   string
+	}{
+		{"identical", func(p *presets.Preset) {}, ""},
+		{
+			name:   "renamed task keeps its ID",
+			change: func(p *presets.Preset) { p.Tasks[0].Name = "Refresh" },
+			want:   `modified tasks Refresh [name: "Update" → "Refresh"]`,
+		},
+		{
+			name:   "task without ID is paired by name",
+			change: func(p *presets.Preset) { p.Tasks[2].Name = "Other" },
+			want:   "removed tasks Unnamed ID\nadded tasks Other",
+		},
+		{
+			name:   "commands are diffed line by line",
+			change: func(p *presets.Preset) { p.Tasks[1].Commands = append(p.Tasks[1].Commands, "git --version") },
+			want:   "modified tasks Tools {commands}",
+		},
+		{
+			name:   "moved task",
+			change: func(p *presets.Preset) { p.Tasks[0], p.Tasks[1] = p.Tasks[1], p.Tasks[0] },
+			want:   "moved tasks Update [position: 1 → 2]",
+		},
+		{
+			name:   "moved and changed",
+			change: func(p *presets.Preset) { p.Tasks[0], p.Tasks[1] = p.Tasks[1], p.Tasks[0]; p.Tasks[1].Elevated = true },
+			want:   "modified tasks Update [position: 1 → 2; elevated: false → true]",
+		},
+		{
+			name:   "list fields show items added and removed",
+			change: func(p *presets.Preset) { p.Tasks[1].Tags = []string{"dev"} },
+			want:   "modified tasks Tools [tags: +dev]",
+		},
+		{
+			name:   "variable default",
+			change: func(p *presets.Preset) { p.Variables[0].Default = "b" },
+			want:   `modified variables hostname [default: "a" → "b"]`,
+		},
+		{
+			name: "nested block tasks",
+			change: func(p *presets.Preset) {
+				p.Tasks = append(p.Tasks, presets.Task{ID: "blk", Name: "Block", Type: "block", Block: []presets.Task{cmd("", "Inner", "true")}})
+			},
+			want: "added tasks Block",
+		},
+		{
+			name:   "handler added",
+			change: func(p *presets.Preset) { p.Handlers = []presets.Task{cmd("", "Reload", "true")} },
+			want:   "added handlers Reload",
+		},
+	}
+
+	for _, tt := range tests {
+		a, b := base(), base()
+		tt.change(b)
+		result, err := Presets(a, b, 3)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if got := summary(result); got != tt.want {
+			t.Errorf("%s: changes =\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+		if result.IsEmpty() != (tt.want == "") {
+			t.Errorf("%s: IsEmpty() = %v", tt.name, result.IsEmpty())
+		}
+	}
+}
+
+func TestPresetsNestedChanges(t *testing.T) {
+	block := func(inner string) *presets.Preset {
+		return &presets.Preset{Name: "p", Tasks: []presets.Task{{
+			ID: "blk", Name: "Block", Type: "block",
+			Block:  []presets.Task{cmd("", "Inner", inner)},
+			Rescue: []presets.Task{cmd("", "Recover", "true")},
+		}}}
+	}
+	result, err := Presets(block("true"), block("false"), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := summary(result); got != "modified tasks Block › Inner {commands}" {
+		t.Errorf("changes = %s", got)
+	}
+}
+
+func TestPresetsMetadata(t *testing.T) {
+	a := &presets.Preset{Name: "p", Version: "1.0.0", SchemaVersion: 1, Architectures: []string{"arm64"}}
+	b := &presets.Preset{Name: "p", Version: "1.1.0", SchemaVersion: 2, Architectures: []string{"arm64", "amd64"}}
+	result, err := Presets(a, b, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(result.Metadata, "; "); got != `architectures: +amd64; version: "1.0.0" → "1.1.0"` {
+		t.Errorf("Metadata = %s", got)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		context int
+		want    string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", 3, ""},
+		{"changed line", "a\nb\nc\n", "a\nx\nc\n", 1, "@@ -1,3 +1,3 @@| a|-b|+x| c"},
+		{"no context", "a\nb\nc\n", "a\nx\nc\n", 0, "@@ -2 +2 @@|-b|+x"},
+		{"added to empty", "", "a\n", 3, "@@ -0,0 +1 @@|+a"},
+		{"removed all", "a\n", "", 3, "@@ -1 +0,0 @@|-a"},
+		{
+			name: "distant changes make two hunks",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n", b: "x\n2\n3\n4\n5\n6\n7\ny\n", context: 1,
+			want: "@@ -1,2 +1,2 @@|-1|+x| 2|@@ -7,2 +7,2 @@| 7|-8|+y",
+		},
+		{
+			name: "close changes share a hunk",
+			a:    "1\n2\n3\n4\n", b: "x\n2\n3\ny\n", context: 1,
+			want: "@@ -1,4 +1,4 @@|-1|+x| 2| 3|-4|+y",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := strings.Join(Unified(tt.a, tt.b, tt.context), "|"); got != tt.want {
+			t.Errorf("%s: diff = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// edit is one line of an edit script: ' ' kept, '-' removed, '+' added
+type edit struct {
+	kind byte
+	text string
+}
+
+// editScript returns the shortest edit script turning a into b, from their
+// longest common subsequence
+func editScript(a, b []string) []edit {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	edits := make([]edit, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, edit{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		edits = append(edits, edit{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		edits = append(edits, edit{'+', b[j]})
+	}
+	return edits
+}
+
+// Unified returns the unified diff of two texts, without file headers, keeping
+// context unchanged lines around each change. It is empty when the texts are equal.
+func Unified(a, b string, context int) []string {
+	if a == b {
+		return nil
+	}
+	edits := editScript(splitLines(a), splitLines(b))
+
+	lines := make([]string, 0)
+	for start := 0; start < len(edits); {
+		// Find the next change and extend the hunk while changes are close together
+		first := start
+		for first < len(edits) && edits[first].kind == ' ' {
+			first++
+		}
+		if first == len(edits) {
+			break
+		}
+		last := first
+		for k := first; k < len(edits); k++ {
+			if edits[k].kind != ' ' {
+				last = k
+			} else if k-last > 2*context {
+				break
+			}
+		}
+
+		from := max(first-context, start)
+		to := min(last+context+1, len(edits))
+
+		// Line numbers of the hunk in both texts are the lines consumed before it
+		oldLine, newLine := 1, 1
+		for _, e := range edits[:from] {
+			if e.kind != '+' {
+				oldLine++
+			}
+			if e.kind != '-' {
+				newLine++
+			}
+		}
+		oldCount, newCount := 0, 0
+		body := make([]string, 0, to-from)
+		for _, e := range edits[from:to] {
+			if e.kind != '+' {
+				oldCount++
+			}
+			if e.kind != '-' {
+				newCount++
+			}
+			body = append(body, string(e.kind)+e.text)
+		}
+
+		lines = append(lines, fmt.Sprintf("@@ -%s +%s @@", hunkRange(oldLine, oldCount), hunkRange(newLine, newCount)))
+		lines = append(lines, body...)
+		start = to
+	}
+	return lines
+}
+
+// hunkRange formats the start and length of a hunk side as unified diffs do
+func hunkRange(line, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", line-1)
+	}
+	if count == 1 {
+		return fmt.Sprint(line)
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
+
+// splitLines splits a text into lines, ignoring a final newline
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
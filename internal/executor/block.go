@@ -0,0 +1,77 @@
+package executor
+
+import (
+	"fmt"
+
+	"base-linux-setup/internal/presets"
+
+	"github.com/fatih/color"
+)
+
+// executeBlock runs a block's tasks in order. When one fails the rescue tasks run
+// with the failure exposed as failed_task; the block succeeds if the rescue does.
+// The always tasks run last whatever happened, and their failure fails the block.
+func (e *Executor) executeBlock(task presets.Task) error {
+	err := e.runNested(task.Block)
+
+	if err != nil && len(task.Rescue) > 0 {
+		color.Yellow("  Block failed, running rescue tasks: %v", err)
+		if e.scope == nil {
+			e.scope = make(map[string]interface{})
+		}
+		// Nested blocks restore the failed_task of the block around them when done
+		previous, hadPrevious := e.scope[presets.FailedTaskVariable]
+		e.scope[presets.FailedTaskVariable] = map[string]interface{}{
+			"name":  e.failed,
+			"error": err.Error(),
+		}
+		err = e.runNested(task.Rescue)
+		if hadPrevious {
+			e.scope[presets.FailedTaskVariable] = previous
+		} else {
+			delete(e.scope, presets.FailedTaskVariable)
+		}
+
+		if err != nil {
+			err = fmt.Errorf("rescue failed: %v", err)
+		} else {
+			color.Green("  ✓ Block rescued")
+		}
+	} else if e.dryRun && len(task.Rescue) > 0 {
+		color.HiBlack("  [DRY RUN] Rescue tasks run if the block fails:")
+		for _, rescue := range task.Rescue {
+			color.HiBlack("  [DRY RUN]   %s", rescue.Name)
+		}
+	}
+
+	if len(task.Always) > 0 {
+		color.HiBlack("  Running always tasks")
+		if alwaysErr := e.runNested(task.Always); alwaysErr != nil && err == nil {
+			err = fmt.Errorf("always task failed: %v", alwaysErr)
+		}
+	}
+
+	return err
+}
+
+// runNested runs the tasks of a block section in order, stopping at the first failure
+func (e *Executor) runNested(tasks []presets.Task) error {
+	for _, task := range tasks {
+		color.Cyan("  ▸ %s", task.Name)
+
+		run, err := e.ShouldRun(task)
+		if err == nil && !run {
+			color.Yellow("  ↷ Skipped (condition false)")
+			continue
+		}
+		if err == nil {
+			err = e.ExecuteTask(task)
+		}
+		if err != nil {
+			color.Red("  ✗ %s: %v", task.Name, err)
+			e.failed = task.Name
+			return fmt.Errorf("task '%s' failed: %v", task.Name, err)
+		}
+	}
+	return nil
+}
@@ -1,14 +1,19 @@
 package executor
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"os/exec"
+	"os/user"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"base-linux-setup/internal/analysis"
+	"base-linux-setup/internal/expr"
 	"base-linux-setup/internal/presets"
 
 	"github.com/fatih/color"
@@ -16,7 +21,17 @@ import (
 
 // Executor handles the execution of tasks
 type Executor struct {
-	dryRun bool
+	dryRun   bool
+	scope    map[string]interface{}
+	onError  func(task presets.Task, err error) bool
+	capture  *bytes.Buffer // receives command stdout while a registered task runs
+	exitCode int           // exit code of the last command run
+	changed  bool          // whether the last task execution changed the system
+	summary  *Summary      // report of the run in progress
+	handlers []presets.Task
+	notified map[int]bool // indexes of handlers queued to run at the next flush
+	failed   string       // name of the last task that failed inside a block
+	secrets  []string     // secret values masked in logged commands and output
 }
 
 // NewExecutor creates a new executor
@@ -33,8 +48,218 @@ func NewDryRunExecutor() *Executor {
 	}
 }
 
-// ExecuteTask executes a single task
+// Run executes tasks in dependency order. Tasks whose condition is false are skipped,
+// as are tasks depending on a task that was skipped or failed. When a task fails the
+// error handler decides whether to continue; without one the run stops. Notified
+// handlers run at flush_handlers tasks and at the end of the run.
+func (e *Executor) Run(tasks []presets.Task) (*Summary, error) {
+	ordered, err := presets.OrderTasks(tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &Summary{Registered: make(map[string]interface{})}
+	e.summary = summary
+	e.notified = nil
+	incomplete := make(map[string]bool)
+
+	for i, task := range ordered {
+		color.Cyan("Executing task %d/%d: %s", i+1, len(ordered), task.Name)
+
+		if task.Type == "flush_handlers" {
+			if err := e.flushHandlers(summary); err != nil {
+				return summary, err
+			}
+			summary.add(task, StatusCompleted, "")
+			fmt.Println()
+			continue
+		}
+
+		if dep := firstIncompleteDependency(task, incomplete); dep != "" {
+			e.skipTask(task, fmt.Sprintf("dependency %s not completed", dep), summary)
+			incomplete[task.ID] = true
+			fmt.Println()
+			continue
+		}
+
+		run, err := e.ShouldRun(task)
+		if err == nil && !run {
+			e.skipTask(task, "condition false", summary)
+			incomplete[task.ID] = true
+			fmt.Println()
+			continue
+		}
+		if err == nil {
+			err = e.ExecuteTask(task)
+		}
+
+		if err != nil {
+			color.Red("Error executing task '%s': %v", task.Name, err)
+			incomplete[task.ID] = true
+			summary.add(task, StatusFailed, err.Error())
+
+			if e.onError == nil || !e.onError(task, err) {
+				return summary, fmt.Errorf("task '%s' failed", task.Name)
+			}
+		} else {
+			color.Green("✓ Task completed: %s", task.Name)
+			summary.add(task, StatusCompleted, "")
+		}
+		fmt.Println()
+	}
+
+	if err := e.flushHandlers(summary); err != nil {
+		return summary, err
+	}
+	return summary, nil
+}
+
+// firstIncompleteDependency returns the first dependency of task that did not complete
+func firstIncompleteDependency(task presets.Task, incomplete map[string]bool) string {
+	for _, dep := range task.DependsOn {
+		if incomplete[dep] {
+			return dep
+		}
+	}
+	return ""
+}
+
+// skipTask reports and records a skipped task. Registered variables of skipped
+// tasks are still set so later conditions can test them.
+func (e *Executor) skipTask(task presets.Task, reason string, summary *Summary) {
+	if e.dryRun {
+		color.Yellow("[DRY RUN] Task skipped (%s): %s", reason, task.Name)
+	} else {
+		color.Yellow("↷ Task skipped (%s): %s", reason, task.Name)
+	}
+
+	summary.add(task, StatusSkipped, reason)
+	if task.Register != "" {
+		e.register(task.Register, map[string]interface{}{
+			"skipped":      true,
+			"stdout":       "",
+			"stdout_lines": []interface{}{},
+			"rc":           -1,
+			"json":         nil,
+			"failed":       false,
+		})
+	}
+}
+
+// ExecuteTask executes a single task. Handlers named in the task's notify list are
+// queued when the task reports a change.
 func (e *Executor) ExecuteTask(task presets.Task) error {
+	if task.IsBlock() {
+		return e.executeBlock(task)
+	}
+	if !task.Loop.IsEmpty() {
+		return e.executeLoop(task)
+	}
+
+	result, err := e.runOnce(task, e.scope)
+	if task.Register != "" {
+		e.register(task.Register, result)
+	}
+	if changed, _ := result["changed"].(bool); changed {
+		e.notify(task)
+	}
+	return err
+}
+
+// executeLoop runs a task once per loop item, reporting each iteration and
+// attributing failures to the item that caused them
+func (e *Executor) executeLoop(task presets.Task) error {
+	items, err := task.Loop.Resolve(e.scope)
+	if err != nil {
+		return fmt.Errorf("failed to resolve loop items: %v", err)
+	}
+	if len(items) == 0 {
+		color.HiBlack("  No loop items, nothing to do")
+		return nil
+	}
+
+	failed := make([]string, 0)
+	results := make([]interface{}, 0, len(items))
+	anyChanged := false
+	for i, item := range items {
+		color.HiBlack("  Item %d/%d: %s", i+1, len(items), e.redact(item))
+
+		scope := copyScope(e.scope)
+		scope[task.LoopVariable()] = item
+
+		result, err := e.runOnce(task, scope)
+		result["item"] = item
+		results = append(results, result)
+
+		if changed, _ := result["changed"].(bool); changed {
+			anyChanged = true
+		}
+		if err != nil {
+			color.Red("  ✗ Item '%s' failed: %v", e.redact(item), err)
+			failed = append(failed, e.redact(item))
+		}
+	}
+
+	if task.Register != "" {
+		e.register(task.Register, map[string]interface{}{
+			"results": results,
+			"changed": anyChanged,
+			"failed":  len(failed) > 0,
+			"skipped": false,
+		})
+	}
+	if anyChanged {
+		e.notify(task)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d items failed: %s", len(failed), len(items), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// runOnce executes a task against a scope, capturing its result and deciding
+// whether it changed the system, taking changed_when into account
+func (e *Executor) runOnce(task presets.Task, scope map[string]interface{}) (map[string]interface{}, error) {
+	result, err := e.runCaptured(func() error {
+		return e.executeWithScope(task, scope)
+	})
+
+	changed := err == nil && e.changed
+	if err == nil && task.ChangedWhen != "" {
+		conditionScope := copyScope(scope)
+		conditionScope["result"] = result
+		changed, err = expr.EvalBool(task.ChangedWhen, conditionScope)
+		if err != nil {
+			err = fmt.Errorf("failed to evaluate changed_when %q: %v", task.ChangedWhen, err)
+		}
+	}
+
+	result["changed"] = changed
+	if changed {
+		color.Yellow("    ↻ Changed")
+	}
+	return result, err
+}
+
+// copyScope returns a shallow copy of a template scope
+func copyScope(scope map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(scope)+1)
+	for key, value := range scope {
+		copied[key] = value
+	}
+	return copied
+}
+
+// executeWithScope renders a task against the given scope and runs it
+func (e *Executor) executeWithScope(task presets.Task, scope map[string]interface{}) error {
+	task, err := presets.RenderTask(task, scope)
+	if err != nil {
+		return fmt.Errorf("failed to render task: %v", err)
+	}
+
+	// Dry runs assume every task changes something so notified handlers are shown
+	e.changed = e.dryRun
 	if e.dryRun {
 		return e.dryRunTask(task)
 	}
@@ -53,17 +278,31 @@ func (e *Executor) ExecuteTask(task presets.Task) error {
 	}
 }
 
+// ShouldRun evaluates the task's when condition against the executor scope
+func (e *Executor) ShouldRun(task presets.Task) (bool, error) {
+	if task.When == "" {
+		return true, nil
+	}
+
+	run, err := expr.EvalBool(task.When, e.scope)
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate condition %q: %v", task.When, err)
+	}
+	return run, nil
+}
+
 // executeCommands executes a list of commands
 func (e *Executor) executeCommands(task presets.Task) error {
 	for i, command := range task.Commands {
 		if len(task.Commands) > 1 {
-			color.HiBlack("  Command %d/%d: %s", i+1, len(task.Commands), command)
+			color.HiBlack("  Command %d/%d: %s", i+1, len(task.Commands), e.redact(command))
 		}
 
 		if err := e.runCommand(command); err != nil {
-			return fmt.Errorf("command failed: %s - %v", command, err)
+			return fmt.Errorf("command failed: %s - %v", e.redact(command), err)
 		}
 	}
+	e.changed = true
 	return nil
 }
 
@@ -88,18 +327,45 @@ func (e *Executor) executeScript(task presets.Task) error {
 	}
 
 	// Execute script
-	return e.runCommand(tmpFile.Name())
+	if err := e.runCommand(tmpFile.Name()); err != nil {
+		return err
+	}
+	e.changed = true
+	return nil
 }
 
 // createFile creates a file with specified content
 func (e *Executor) createFile(task presets.Task) error {
-	// File tasks expect Commands[0] to be the file path and Script to be the content
-	if len(task.Commands) == 0 {
-		return fmt.Errorf("file task requires file path in Commands[0]")
+	filePath, mode, content := task.FileSpec()
+	if filePath == "" {
+		return fmt.Errorf("file task requires a path")
 	}
 
-	filePath := task.Commands[0]
-	content := task.Script
+	// Parse permissions if specified
+	var perm os.FileMode
+	if mode != "" {
+		parsed, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid file mode %q: %v", mode, err)
+		}
+		perm = os.FileMode(parsed)
+	}
+
+	// Leave the file alone when it already has the desired content, mode and ownership
+	if fileUpToDate(filePath, content, perm, task.Owner, task.Group) {
+		color.HiGreen("    ✓ File unchanged: %s", filePath)
+		return nil
+	}
+
+	// Elevated file tasks are written through sudo when not running as root
+	if task.Elevated && os.Geteuid() != 0 {
+		if err := e.installFileWithSudo(filePath, content, perm, task.Owner, task.Group); err != nil {
+			return err
+		}
+		e.changed = true
+		color.HiGreen("    ✓ File written: %s", filePath)
+		return nil
+	}
 
 	// Create directory if it doesn't exist
 	dir := filepath.Dir(filePath)
@@ -119,30 +385,139 @@ func (e *Executor) createFile(task presets.Task) error {
 		return fmt.Errorf("failed to write content to file %s: %v", filePath, err)
 	}
 
-	// Set file permissions if specified in Commands[1]
-	if len(task.Commands) > 1 {
-		if perm, err := strconv.ParseUint(task.Commands[1], 8, 32); err == nil {
-			if err := os.Chmod(filePath, os.FileMode(perm)); err != nil {
-				color.Yellow("Warning: Failed to set permissions on %s: %v", filePath, err)
+	// Set file permissions if specified
+	if perm != 0 {
+		if err := os.Chmod(filePath, perm); err != nil {
+			color.Yellow("Warning: Failed to set permissions on %s: %v", filePath, err)
+		}
+	}
+
+	// Set ownership if specified
+	if task.Owner != "" || task.Group != "" {
+		uid, gid, err := lookupOwnership(task.Owner, task.Group)
+		if err != nil {
+			return err
+		}
+		if err := os.Chown(filePath, uid, gid); err != nil {
+			return fmt.Errorf("failed to set ownership of %s: %v", filePath, err)
+		}
+	}
+
+	e.changed = true
+	color.HiGreen("    ✓ File written: %s", filePath)
+	return nil
+}
+
+// fileUpToDate reports whether a file exists with the given content and, where set,
+// mode, owner and group
+func fileUpToDate(path, content string, perm os.FileMode, owner, group string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	if perm != 0 && info.Mode().Perm() != perm {
+		return false
+	}
+	if owner != "" || group != "" {
+		uid, gid, err := lookupOwnership(owner, group)
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if err != nil || !ok {
+			return false
+		}
+		if (uid >= 0 && int(stat.Uid) != uid) || (gid >= 0 && int(stat.Gid) != gid) {
+			return false
+		}
+	}
+	existing, err := os.ReadFile(path)
+	return err == nil && string(existing) == content
+}
+
+// lookupOwnership resolves user and group names (or numeric IDs) to IDs, returning
+// -1 for any left empty so os.Chown leaves it unchanged
+func lookupOwnership(owner, group string) (int, int, error) {
+	uid, gid := -1, -1
+	if owner != "" {
+		u, err := user.Lookup(owner)
+		if err != nil {
+			if u, err = user.LookupId(owner); err != nil {
+				return -1, -1, fmt.Errorf("unknown user %s", owner)
+			}
+		}
+		uid, _ = strconv.Atoi(u.Uid)
+	}
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			if g, err = user.LookupGroupId(group); err != nil {
+				return -1, -1, fmt.Errorf("unknown group %s", group)
 			}
 		}
+		gid, _ = strconv.Atoi(g.Gid)
+	}
+	return uid, gid, nil
+}
+
+// installFileWithSudo writes content to a temporary file and installs it with sudo
+func (e *Executor) installFileWithSudo(path, content string, perm os.FileMode, owner, group string) error {
+	tmpFile, err := os.CreateTemp("", "setup-file-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.WriteString(content); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write temp file: %v", err)
+	}
+	tmpFile.Close()
+
+	if perm == 0 {
+		perm = 0644
 	}
 
-	color.HiGreen("    ✓ File created: %s", filePath)
+	args := []string{"install", "-D", "-m", fmt.Sprintf("%o", perm)}
+	if owner != "" {
+		args = append(args, "-o", owner)
+	}
+	if group != "" {
+		args = append(args, "-g", group)
+	}
+	cmd := exec.Command("sudo", append(args, tmpFile.Name(), path)...)
+	cmd.Stdout = e.stdout()
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = os.Stdin
+
+	color.HiBlack("    Running: sudo %s <content> %s", strings.Join(args, " "), e.redact(path))
+	err = cmd.Run()
+	e.recordExit(err)
+	if err != nil {
+		return fmt.Errorf("failed to install file %s: %v", path, err)
+	}
 	return nil
 }
 
-// manageService manages system services
+// manageService manages system services, running one systemctl action for each
+// of the task's enabled and state settings
 func (e *Executor) manageService(task presets.Task) error {
-	// Service tasks expect Commands to contain systemctl operations
-	// Format: ["service_name", "action"] where action is start/stop/enable/disable/restart
-	if len(task.Commands) < 2 {
-		return fmt.Errorf("service task requires service name and action in Commands")
+	serviceName, actions := task.ServiceSpec()
+	if serviceName == "" || len(actions) == 0 {
+		return fmt.Errorf("service task requires a service and a state or enabled")
 	}
-	
-	serviceName := task.Commands[0]
-	action := task.Commands[1]
-	
+
+	changed := false
+	for _, action := range actions {
+		if err := e.runServiceAction(serviceName, action); err != nil {
+			e.changed = false
+			return err
+		}
+		changed = changed || e.changed
+	}
+	e.changed = changed
+	return nil
+}
+
+// runServiceAction runs a single systemctl action on a service
+func (e *Executor) runServiceAction(serviceName, action string) error {
 	// Validate action
 	validActions := []string{"start", "stop", "enable", "disable", "restart", "reload", "status"}
 	isValidAction := false
@@ -156,7 +531,10 @@ func (e *Executor) manageService(task presets.Task) error {
 	if !isValidAction {
 		return fmt.Errorf("invalid service action: %s. Valid actions: %v", action, validActions)
 	}
-	
+
+	// Determine whether the action will change the service state
+	e.changed = serviceActionChanges(serviceName, action)
+
 	// Build systemctl command
 	var cmd *exec.Cmd
 	if action == "status" {
@@ -168,7 +546,7 @@ func (e *Executor) manageService(task presets.Task) error {
 	}
 	
 	// Set up command execution
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = e.stdout()
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = os.Stdin
 	
@@ -177,8 +555,10 @@ func (e *Executor) manageService(task presets.Task) error {
 	startTime := time.Now()
 	err := cmd.Run()
 	duration := time.Since(startTime)
-	
+	e.recordExit(err)
+
 	if err != nil {
+		e.changed = false
 		color.Red("    ✗ Service operation failed in %v", duration)
 		return fmt.Errorf("systemctl %s %s failed: %v", action, serviceName, err)
 	}
@@ -200,6 +580,28 @@ func (e *Executor) manageService(task presets.Task) error {
 	return nil
 }
 
+// serviceActionChanges reports whether a systemctl action would change the service state
+func serviceActionChanges(serviceName, action string) bool {
+	check := func(query string) bool {
+		return exec.Command("systemctl", query, "--quiet", serviceName).Run() == nil
+	}
+
+	switch action {
+	case "start":
+		return !check("is-active")
+	case "stop":
+		return check("is-active")
+	case "enable":
+		return !check("is-enabled")
+	case "disable":
+		return check("is-enabled")
+	case "status":
+		return false
+	default: // restart, reload
+		return true
+	}
+}
+
 // runCommand runs a single command
 func (e *Executor) runCommand(command string) error {
 	// Parse command
@@ -210,7 +612,7 @@ func (e *Executor) runCommand(command string) error {
 
 	// Create command
 	cmd := exec.Command(parts[0], parts[1:]...)
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = e.stdout()
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = os.Stdin
 
@@ -218,11 +620,12 @@ func (e *Executor) runCommand(command string) error {
 	cmd.Env = os.Environ()
 
 	// Run command
-	color.HiBlack("    Running: %s", command)
+	color.HiBlack("    Running: %s", e.redact(command))
 
 	startTime := time.Now()
 	err := cmd.Run()
 	duration := time.Since(startTime)
+	e.recordExit(err)
 
 	if err != nil {
 		color.Red("    ✗ Failed in %v", duration)
@@ -235,12 +638,12 @@ func (e *Executor) runCommand(command string) error {
 
 // dryRunTask simulates task execution without actually running commands
 func (e *Executor) dryRunTask(task presets.Task) error {
-	color.Yellow("[DRY RUN] Would execute task: %s", task.Name)
+	color.Yellow("[DRY RUN] Would execute task: %s", e.redact(task.Name))
 
 	switch task.Type {
 	case "command":
 		for _, command := range task.Commands {
-			color.HiBlack("  [DRY RUN] Command: %s", command)
+			color.HiBlack("  [DRY RUN] Command: %s", e.redact(command))
 		}
 	case "script":
 		color.HiBlack("  [DRY RUN] Script execution")
@@ -252,13 +655,29 @@ func (e *Executor) dryRunTask(task presets.Task) error {
 				break
 			}
 			if strings.TrimSpace(line) != "" {
-				color.HiBlack("  [DRY RUN] %s", line)
+				color.HiBlack("  [DRY RUN] %s", e.redact(line))
 			}
 		}
 	case "file":
-		color.HiBlack("  [DRY RUN] File creation")
+		path, mode, _ := task.FileSpec()
+		color.HiBlack("  [DRY RUN] File creation: %s", path)
+		if mode != "" {
+			color.HiBlack("  [DRY RUN] Mode: %s", mode)
+		}
+		if task.Owner != "" || task.Group != "" {
+			color.HiBlack("  [DRY RUN] Owner: %s:%s", task.Owner, task.Group)
+		}
 	case "service":
-		color.HiBlack("  [DRY RUN] Service management")
+		name, actions := task.ServiceSpec()
+		for _, action := range actions {
+			color.HiBlack("  [DRY RUN] Service: systemctl %s %s", action, name)
+		}
+	}
+
+	if req, err := analysis.Analyze(task); err == nil {
+		if summary := req.Summary(); len(summary) > 0 {
+			color.HiBlack("  [DRY RUN] Requires: %s", strings.Join(summary, ", "))
+		}
 	}
 
 	return nil
@@ -310,6 +729,29 @@ func (e *Executor) SetDryRun(dryRun bool) {
 	e.dryRun = dryRun
 }
 
+// SetScope sets the facts and variables that task templates are rendered against
+func (e *Executor) SetScope(scope map[string]interface{}) {
+	e.scope = scope
+}
+
+// SetSecrets sets the secret values to mask wherever rendered commands are logged
+func (e *Executor) SetSecrets(secrets []string) {
+	e.secrets = secrets
+}
+
+// redact masks secret values in text that is about to be displayed
+func (e *Executor) redact(text string) string {
+	for _, secret := range e.secrets {
+		text = strings.ReplaceAll(text, secret, "********")
+	}
+	return text
+}
+
+// SetErrorHandler sets the function asked whether to continue after a task fails
+func (e *Executor) SetErrorHandler(handler func(task presets.Task, err error) bool) {
+	e.onError = handler
+}
+
 // IsDryRun returns whether executor is in dry-run mode
 func (e *Executor) IsDryRun() bool {
 	return e.dryRun
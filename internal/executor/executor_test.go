@@ -0,0 +1,99 @@
+package executor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"base-linux-setup/internal/presets"
+
+	"github.com/fatih/color"
+)
+
+// captureOutput collects what the executor logs while fn runs
+func captureOutput(t *testing.T, fn func()) string {
+	t.Helper()
+	var buf bytes.Buffer
+	previous, noColor := color.Output, color.NoColor
+	color.Output, color.NoColor = &buf, true
+	defer func() { color.Output, color.NoColor = previous, noColor }()
+	fn()
+	return buf.String()
+}
+
+func TestDryRunRequirements(t *testing.T) {
+	tests := []struct {
+		name string
+		task presets.Task
+		want string // "" when no requirements are reported
+	}{
+		{"plain command", presets.Task{Name: "t", Type: "command", Commands: []string{"echo hi"}}, ""},
+		{"sudo and network", presets.Task{Name: "t", Type: "command", Commands: []string{"sudo apt-get update"}}, "Requires: sudo, network"},
+		{"sed -i", presets.Task{Name: "t", Type: "script", Script: "sudo sed -i 's/a/b/' /etc/hosts"}, "Requires: sudo, writes /etc/hosts"},
+		{"sed reading", presets.Task{Name: "t", Type: "script", Script: "sed 's/a/b/' /etc/hosts > /tmp/hosts"}, ""},
+		{"file task", presets.Task{Name: "t", Type: "file", Path: "/etc/motd", Elevated: true}, "Requires: writes /etc/motd"},
+		{"reboot", presets.Task{Name: "t", Type: "command", Commands: []string{"sudo reboot"}}, "Requires: sudo, reboot"},
+	}
+
+	for _, tt := range tests {
+		output := captureOutput(t, func() {
+			if err := NewDryRunExecutor().ExecuteTask(tt.task); err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.name, err)
+			}
+		})
+		switch {
+		case tt.want == "" && strings.Contains(output, "Requires:"):
+			t.Errorf("%s: output reports requirements:\n%s", tt.name, output)
+		case tt.want != "" && !strings.Contains(output, tt.want):
+			t.Errorf("%s: output =\n%s\nwant it to contain %q", tt.name, output, tt.want)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	tasks := []presets.Task{
+		{ID: "greet", Name: "Greet", Type: "command", Commands: []string{"echo hello"}, Register: "greeting"},
+		{ID: "check", Name: "Check", Type: "command", Commands: []string{"true"}, When: `greeting.stdout == "hello"`},
+		{ID: "never", Name: "Never", Type: "command", Commands: []string{"true"}, When: "greeting.rc != 0"},
+		{ID: "after", Name: "After Never", Type: "command", Commands: []string{"true"}, DependsOn: []string{"never"}},
+	}
+
+	var summary *Summary
+	var err error
+	captureOutput(t, func() { summary, err = NewExecutor().Run(tasks) })
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if summary.Completed != 2 || summary.Skipped != 2 || summary.Failed != 0 {
+		t.Errorf("summary = %+v, want 2 completed and 2 skipped", summary)
+	}
+	greeting, _ := summary.Registered["greeting"].(map[string]interface{})
+	if greeting["stdout"] != "hello" || greeting["rc"] != 0 {
+		t.Errorf("registered greeting = %v", greeting)
+	}
+	if detail := summary.Results[3].Detail; detail != "dependency never not completed" {
+		t.Errorf("skip reason = %q", detail)
+	}
+}
+
+func TestRunStopsAtFailure(t *testing.T) {
+	tasks := []presets.Task{
+		{ID: "fail", Name: "Fail", Type: "command", Commands: []string{"false"}},
+		{ID: "next", Name: "Next", Type: "command", Commands: []string{"true"}},
+		{ID: "dependent", Name: "Dependent", Type: "command", Commands: []string{"true"}, DependsOn: []string{"fail"}},
+	}
+
+	var summary *Summary
+	var err error
+	captureOutput(t, func() { summary, err = NewExecutor().Run(tasks) })
+	if err == nil || summary.Failed != 1 || summary.Completed != 0 {
+		t.Errorf("without an error handler: summary = %+v, err = %v", summary, err)
+	}
+
+	executor := NewExecutor()
+	executor.SetErrorHandler(func(presets.Task, error) bool { return true })
+	captureOutput(t, func() { summary, err = executor.Run(tasks) })
+	if err != nil || summary.Failed != 1 || summary.Completed != 1 || summary.Skipped != 1 {
+		t.Errorf("continuing after failures: summary = %+v, err = %v", summary, err)
+	}
+}
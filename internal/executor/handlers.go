@@ -0,0 +1,91 @@
+package executor
+
+import (
+	"fmt"
+
+	"base-linux-setup/internal/presets"
+
+	"github.com/fatih/color"
+)
+
+// SetHandlers sets the handlers tasks may notify
+func (e *Executor) SetHandlers(handlers []presets.Task) {
+	e.handlers = handlers
+}
+
+// notify queues the handlers named in a task's notify list. Each handler is
+// queued once no matter how many tasks notify it.
+func (e *Executor) notify(task presets.Task) {
+	for _, ref := range task.Notify {
+		index := e.findHandler(ref)
+		if index < 0 {
+			color.Yellow("    Warning: unknown handler '%s'", ref)
+			continue
+		}
+		if e.notified == nil {
+			e.notified = make(map[int]bool)
+		}
+		if !e.notified[index] {
+			color.HiBlack("    Notified handler '%s'", e.handlers[index].Name)
+		}
+		e.notified[index] = true
+	}
+}
+
+// findHandler returns the index of the handler referenced by ID or name, or -1
+func (e *Executor) findHandler(ref string) int {
+	preset := presets.Preset{Handlers: e.handlers}
+	handler, ok := preset.FindHandler(ref)
+	if !ok {
+		return -1
+	}
+	for i := range e.handlers {
+		if e.handlers[i].Name == handler.Name {
+			return i
+		}
+	}
+	return -1
+}
+
+// flushHandlers runs every notified handler once, in the order the handlers are
+// declared, and clears the queue. Handler failures are handled like task failures.
+func (e *Executor) flushHandlers(summary *Summary) error {
+	if len(e.notified) == 0 {
+		return nil
+	}
+
+	pending := e.notified
+	e.notified = nil
+
+	color.Cyan("Running notified handlers")
+	for i, handler := range e.handlers {
+		if !pending[i] {
+			continue
+		}
+		color.Cyan("Running handler: %s", handler.Name)
+
+		run, err := e.ShouldRun(handler)
+		if err == nil && !run {
+			e.skipTask(handler, "condition false", summary)
+			fmt.Println()
+			continue
+		}
+		if err == nil {
+			err = e.ExecuteTask(handler)
+		}
+
+		if err != nil {
+			color.Red("Error executing handler '%s': %v", handler.Name, err)
+			summary.add(handler, StatusFailed, err.Error())
+
+			if e.onError == nil || !e.onError(handler, err) {
+				return fmt.Errorf("handler '%s' failed", handler.Name)
+			}
+		} else {
+			color.Green("✓ Handler completed: %s", handler.Name)
+			summary.add(handler, StatusCompleted, "")
+		}
+		fmt.Println()
+	}
+	return nil
+}
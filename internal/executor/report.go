@@ -0,0 +1,187 @@
+package executor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"base-linux-setup/internal/presets"
+
+	"github.com/fatih/color"
+)
+
+// Task outcome statuses recorded in a run summary
+const (
+	StatusCompleted = "completed"
+	StatusSkipped   = "skipped"
+	StatusFailed    = "failed"
+)
+
+// TaskResult records the outcome of a single task
+type TaskResult struct {
+	Name   string
+	Status string
+	Detail string // skip reason or error message
+}
+
+// Summary is the report of a run: task outcomes and registered variables
+type Summary struct {
+	Completed  int
+	Skipped    int
+	Failed     int
+	Results    []TaskResult
+	Registered map[string]interface{}
+}
+
+// add records a task outcome
+func (s *Summary) add(task presets.Task, status, detail string) {
+	switch status {
+	case StatusCompleted:
+		s.Completed++
+	case StatusSkipped:
+		s.Skipped++
+	case StatusFailed:
+		s.Failed++
+	}
+	s.Results = append(s.Results, TaskResult{Name: task.Name, Status: status, Detail: detail})
+}
+
+// Print writes the run report
+func (s *Summary) Print() {
+	color.Cyan("Run Report:")
+	for _, result := range s.Results {
+		switch result.Status {
+		case StatusCompleted:
+			color.Green("  ✓ %s", result.Name)
+		case StatusSkipped:
+			color.Yellow("  ↷ %s (skipped: %s)", result.Name, result.Detail)
+		case StatusFailed:
+			color.Red("  ✗ %s (failed)", result.Name)
+		}
+	}
+	color.White("  %d completed, %d skipped, %d failed", s.Completed, s.Skipped, s.Failed)
+
+	if len(s.Registered) > 0 {
+		fmt.Println()
+		color.Cyan("Registered Variables:")
+		names := make([]string, 0, len(s.Registered))
+		for name := range s.Registered {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			color.White("  %s: %s", name, describeRegistered(s.Registered[name]))
+		}
+	}
+	fmt.Println()
+}
+
+// describeRegistered summarizes a registered value on one line
+func describeRegistered(value interface{}) string {
+	result, ok := value.(map[string]interface{})
+	if !ok {
+		return fmt.Sprint(value)
+	}
+	if skipped, _ := result["skipped"].(bool); skipped {
+		return "skipped"
+	}
+	if results, ok := result["results"].([]interface{}); ok {
+		return fmt.Sprintf("%d item results, failed=%v", len(results), result["failed"])
+	}
+
+	stdout := strings.ReplaceAll(fmt.Sprint(result["stdout"]), "\n", "\\n")
+	if len(stdout) > 60 {
+		stdout = stdout[:57] + "..."
+	}
+	description := fmt.Sprintf("rc=%v stdout=%q", result["rc"], stdout)
+	if result["json"] != nil {
+		description += " (json)"
+	}
+	return description
+}
+
+// runCaptured runs fn while capturing command output, returning the value to register
+func (e *Executor) runCaptured(fn func() error) (map[string]interface{}, error) {
+	var buf bytes.Buffer
+	e.capture = &buf
+	e.exitCode = 0
+	err := fn()
+	e.capture = nil
+
+	if err != nil && e.exitCode == 0 {
+		e.exitCode = -1
+	}
+
+	stdout := strings.TrimRight(buf.String(), "\n")
+	lines := make([]interface{}, 0)
+	if stdout != "" {
+		for _, line := range strings.Split(stdout, "\n") {
+			lines = append(lines, line)
+		}
+	}
+
+	var parsed interface{}
+	if stdout != "" {
+		if jsonErr := json.Unmarshal([]byte(stdout), &parsed); jsonErr != nil {
+			parsed = nil
+		}
+	}
+
+	return map[string]interface{}{
+		"stdout":       stdout,
+		"stdout_lines": lines,
+		"rc":           e.exitCode,
+		"json":         parsed,
+		"failed":       err != nil,
+		"skipped":      false,
+		"dry_run":      e.dryRun,
+	}, err
+}
+
+// register stores a task result in the scope for later templates and conditions
+func (e *Executor) register(name string, value map[string]interface{}) {
+	if e.scope == nil {
+		e.scope = make(map[string]interface{})
+	}
+	e.scope[name] = value
+	if e.summary != nil {
+		e.summary.Registered[name] = e.redactResult(value)
+	}
+	color.HiBlack("    Registered result as '%s'", name)
+}
+
+// redactResult returns a copy of a registered value with secrets masked in its output
+func (e *Executor) redactResult(value map[string]interface{}) map[string]interface{} {
+	redacted := copyScope(value)
+	if stdout, ok := value["stdout"].(string); ok {
+		redacted["stdout"] = e.redact(stdout)
+	}
+	return redacted
+}
+
+// stdout returns the writer for command output, teeing into the capture buffer when set
+func (e *Executor) stdout() io.Writer {
+	if e.capture != nil {
+		return io.MultiWriter(os.Stdout, e.capture)
+	}
+	return os.Stdout
+}
+
+// recordExit remembers the exit code of the last command
+func (e *Executor) recordExit(err error) {
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		e.exitCode = 0
+	case errors.As(err, &exitErr):
+		e.exitCode = exitErr.ExitCode()
+	default:
+		e.exitCode = -1
+	}
+}
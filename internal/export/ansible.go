@@ -0,0 +1,532 @@
+package export
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"base-linux-setup/internal/presets"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Ansible renders a plan as a playbook running its tasks on all hosts of an inventory
+func Ansible(plan *Plan, toolVersion string) ([]byte, error) {
+	a := &ansibleWriter{plan: plan}
+	tasks, handlers, err := a.tasksAndHandlers()
+	if err != nil {
+		return nil, err
+	}
+
+	play := mappingNode()
+	setKey(play, "name", stringNode(plan.Preset.Name))
+	setKey(play, "hosts", stringNode("all"))
+	setKey(play, "gather_facts", boolNode(false))
+	if len(plan.Secrets) > 0 {
+		prompts := sequenceNode()
+		for _, secret := range plan.Secrets {
+			prompt := mappingNode()
+			setKey(prompt, "name", stringNode(secret.Name))
+			setKey(prompt, "prompt", stringNode(secretPrompt(secret)))
+			setKey(prompt, "private", boolNode(true))
+			prompts.Content = append(prompts.Content, prompt)
+		}
+		setKey(play, "vars_prompt", prompts)
+	}
+	setKey(play, "tasks", tasks)
+	if len(handlers.Content) > 0 {
+		setKey(play, "handlers", handlers)
+	}
+
+	playbook := sequenceNode(play)
+	playbook.HeadComment = a.header(toolVersion, "ansible", "Secrets are prompted for, or passed with -e:")
+	return encodeYAML(playbook)
+}
+
+// AnsibleRole renders a plan as a role with its tasks, handlers and metadata
+func AnsibleRole(plan *Plan, toolVersion string) ([]File, error) {
+	a := &ansibleWriter{plan: plan}
+	tasks, handlers, err := a.tasksAndHandlers()
+	if err != nil {
+		return nil, err
+	}
+	preset := plan.Preset
+
+	tasks.HeadComment = a.header(toolVersion, "ansible-role", "Secrets are required role variables:")
+	tasksData, err := encodeYAML(tasks)
+	if err != nil {
+		return nil, err
+	}
+	files := []File{{Path: "tasks/main.yml", Data: tasksData, Mode: 0644}}
+
+	if len(handlers.Content) > 0 {
+		data, err := encodeYAML(handlers)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{Path: "handlers/main.yml", Data: data, Mode: 0644})
+	}
+
+	info := mappingNode()
+	if len(preset.Authors) > 0 {
+		setKey(info, "author", stringNode(strings.Join(preset.Authors, ", ")))
+	}
+	setKey(info, "description", stringNode(preset.Description))
+	if preset.License != "" {
+		setKey(info, "license", stringNode(preset.License))
+	}
+	// argument_specs needs Ansible 2.11
+	setKey(info, "min_ansible_version", stringNode("2.11"))
+	meta := mappingNode()
+	setKey(meta, "galaxy_info", info)
+	setKey(meta, "dependencies", sequenceNode())
+	if len(plan.Secrets) > 0 {
+		options := mappingNode()
+		for _, secret := range plan.Secrets {
+			option := mappingNode()
+			setKey(option, "type", stringNode("str"))
+			setKey(option, "required", boolNode(true))
+			setKey(option, "no_log", boolNode(true))
+			if secret.Description != "" {
+				setKey(option, "description", stringNode(secret.Description))
+			}
+			setKey(options, secret.Name, option)
+		}
+		spec := mappingNode()
+		setKey(spec, "short_description", stringNode(preset.Name))
+		setKey(spec, "options", options)
+		specs := mappingNode()
+		setKey(specs, "main", spec)
+		setKey(meta, "argument_specs", specs)
+	}
+	data, err := encodeYAML(meta)
+	if err != nil {
+		return nil, err
+	}
+	return append(files, File{Path: "meta/main.yml", Data: data, Mode: 0644}), nil
+}
+
+type ansibleWriter struct {
+	plan *Plan
+}
+
+// tasksAndHandlers converts the steps and handlers of the plan
+func (a *ansibleWriter) tasksAndHandlers() (tasks, handlers *yaml.Node, err error) {
+	if tasks, err = a.tasks(a.plan.Steps); err != nil {
+		return nil, nil, err
+	}
+	if handlers, err = a.tasks(a.plan.Handlers); err != nil {
+		return nil, nil, err
+	}
+	return tasks, handlers, nil
+}
+
+// header returns the comment at the top of the generated tasks
+func (a *ansibleWriter) header(toolVersion, format, secretsTitle string) string {
+	plan := a.plan
+	lines := headerLines(plan, toolVersion, format)
+	if len(plan.Secrets) > 0 {
+		lines = append(lines, "", secretsTitle)
+		for _, secret := range plan.Secrets {
+			lines = append(lines, fmt.Sprintf("  %s  %s", secret.Name, secret.Description))
+		}
+	}
+	lines = append(lines, skippedLines(plan)...)
+	lines = append(lines, "",
+		"Commands starting with sudo and elevated file tasks use become. Scripts run as the",
+		"connecting user and call sudo themselves, which needs passwordless sudo.")
+	return comment(lines)
+}
+
+// tasks converts a list of steps, leaving out skipped ones
+func (a *ansibleWriter) tasks(steps []Step) (*yaml.Node, error) {
+	list := sequenceNode()
+	for _, step := range steps {
+		if step.Skip != "" {
+			continue
+		}
+		nodes, err := a.step(step)
+		if err != nil {
+			return nil, fmt.Errorf("task '%s': %v", step.Task.Name, err)
+		}
+		list.Content = append(list.Content, nodes...)
+	}
+	return list, nil
+}
+
+// step converts a step to Ansible tasks. The last task carries the register,
+// changed_when and notify keywords of the step.
+func (a *ansibleWriter) step(step Step) ([]*yaml.Node, error) {
+	task := step.Task
+	var nodes []*yaml.Node
+
+	switch {
+	case task.Type == "flush_handlers":
+		node := mappingNode()
+		setKey(node, "name", stringNode(jinja(task.Name)))
+		setKey(node, "ansible.builtin.meta", stringNode("flush_handlers"))
+		return []*yaml.Node{node}, nil
+	case task.IsBlock():
+		node := mappingNode()
+		setKey(node, "name", stringNode(jinja(task.Name)))
+		for _, part := range []struct {
+			key   string
+			steps []Step
+		}{{"block", step.Block}, {"rescue", step.Rescue}, {"always", step.Always}} {
+			if part.key != "block" && len(part.steps) == 0 {
+				continue
+			}
+			tasks, err := a.tasks(part.steps)
+			if err != nil {
+				return nil, err
+			}
+			// Blocks have no changed_when: the block changed when any of its tasks did
+			if step.Changed != nil {
+				for _, inner := range tasks.Content {
+					if findKey(inner, "block") == nil && findKey(inner, "changed_when") == nil {
+						setKey(inner, "changed_when", boolNode(*step.Changed))
+					}
+				}
+			}
+			setKey(node, part.key, tasks)
+		}
+		a.notify(node, step)
+		a.tags(node, task)
+		return []*yaml.Node{node}, nil
+	case step.Items != nil && step.Looped == nil:
+		// The item is used in a way Ansible loops cannot express: one task per item
+		block := sequenceNode()
+		for _, item := range step.Items {
+			itemTask := item.Task
+			itemTask.Name = fmt.Sprintf("%s (%s)", itemTask.Name, item.Value)
+			itemNodes, err := a.module(itemTask, false)
+			if err != nil {
+				return nil, err
+			}
+			block.Content = append(block.Content, itemNodes...)
+		}
+		node := mappingNode()
+		setKey(node, "name", stringNode(jinja(task.Name)))
+		setKey(node, "block", block)
+		a.notify(node, step)
+		a.tags(node, task)
+		return []*yaml.Node{node}, nil
+	case step.Items != nil:
+		var err error
+		if nodes, err = a.module(*step.Looped, true); err != nil {
+			return nil, err
+		}
+		items := sequenceNode()
+		for _, item := range step.Items {
+			items.Content = append(items.Content, stringNode(jinja(item.Value)))
+		}
+		for _, node := range nodes {
+			setKey(node, "loop", items)
+			if variable := task.LoopVariable(); variable != "item" {
+				control := mappingNode()
+				setKey(control, "loop_var", stringNode(variable))
+				setKey(node, "loop_control", control)
+			}
+		}
+	default:
+		var err error
+		keyed := task.Register != "" || step.Changed != nil
+		if nodes, err = a.module(task, keyed); err != nil {
+			return nil, err
+		}
+	}
+
+	last := nodes[len(nodes)-1]
+	if task.Register != "" {
+		setKey(last, "register", stringNode(task.Register))
+	}
+	if step.Changed != nil {
+		setKey(last, "changed_when", boolNode(*step.Changed))
+	}
+	a.notify(last, step)
+	for _, node := range nodes {
+		a.tags(node, task)
+	}
+	return nodes, nil
+}
+
+// notify adds the handlers a step notifies, leaving out those skipped for the facts
+func (a *ansibleWriter) notify(node *yaml.Node, step Step) {
+	names := sequenceNode()
+	for _, index := range step.Notify {
+		if handler := a.plan.Handlers[index]; handler.Skip == "" {
+			names.Content = append(names.Content, stringNode(handler.Task.Name))
+		}
+	}
+	if len(names.Content) > 0 {
+		setKey(node, "notify", names)
+	}
+}
+
+func (a *ansibleWriter) tags(node *yaml.Node, task presets.Task) {
+	if len(task.Tags) == 0 {
+		return
+	}
+	tags := sequenceNode()
+	for _, tag := range task.Tags {
+		tags.Content = append(tags.Content, stringNode(tag))
+	}
+	setKey(node, "tags", tags)
+}
+
+// module converts a rendered command, script, file or service task to the tasks of
+// the corresponding Ansible modules. single asks for one task, as loops, register
+// and changed_when cannot apply to blocks.
+func (a *ansibleWriter) module(task presets.Task, single bool) ([]*yaml.Node, error) {
+	named := func(name string) *yaml.Node {
+		node := mappingNode()
+		setKey(node, "name", stringNode(jinja(name)))
+		return node
+	}
+
+	switch task.Type {
+	case "command":
+		if len(task.Commands) == 0 {
+			return nil, fmt.Errorf("empty command")
+		}
+		if len(task.Commands) > 1 && single {
+			// One shell task runs the commands in turn, each word quoted as the
+			// executor splits commands on whitespace without a shell
+			chain := make([]string, 0, len(task.Commands))
+			for _, command := range task.Commands {
+				words := strings.Fields(command)
+				for i, word := range words {
+					words[i] = shellQuote(word)
+				}
+				chain = append(chain, strings.Join(words, " "))
+			}
+			node := named(task.Name)
+			setKey(node, "ansible.builtin.shell", stringNode(jinja(strings.Join(chain, " && "))))
+			return []*yaml.Node{node}, nil
+		}
+
+		commands := make([]*yaml.Node, 0, len(task.Commands))
+		for _, command := range task.Commands {
+			words := strings.Fields(command)
+			if len(words) == 0 {
+				return nil, fmt.Errorf("empty command")
+			}
+			name := task.Name
+			if len(task.Commands) > 1 {
+				name = command
+			}
+			node := named(name)
+			become := len(words) > 1 && words[0] == "sudo" && !strings.HasPrefix(words[1], "-")
+			if become {
+				words = words[1:]
+			}
+			argv := sequenceNode()
+			for _, word := range words {
+				argv.Content = append(argv.Content, stringNode(jinja(word)))
+			}
+			args := mappingNode()
+			setKey(args, "argv", argv)
+			setKey(node, "ansible.builtin.command", args)
+			if become {
+				setKey(node, "become", boolNode(true))
+			}
+			commands = append(commands, node)
+		}
+		if len(commands) == 1 {
+			return commands, nil
+		}
+		block := named(task.Name)
+		setKey(block, "block", sequenceNode(commands...))
+		return []*yaml.Node{block}, nil
+
+	case "script":
+		args := mappingNode()
+		setKey(args, "cmd", stringNode(jinja(task.Script)))
+		if interpreter := scriptInterpreter(task.Script); interpreter != "" && interpreter != "/bin/sh" {
+			setKey(args, "executable", stringNode(interpreter))
+		}
+		node := named(task.Name)
+		setKey(node, "ansible.builtin.shell", args)
+		return []*yaml.Node{node}, nil
+
+	case "file":
+		filePath, mode, content := task.FileSpec()
+		if filePath == "" {
+			return nil, fmt.Errorf("file task requires a path")
+		}
+		// The executor creates missing parent directories, the copy module does not
+		dir := mappingNode()
+		setKey(dir, "path", stringNode(jinja(path.Dir(filePath))))
+		setKey(dir, "state", stringNode("directory"))
+		parent := named(task.Name + ": parent directory")
+		setKey(parent, "ansible.builtin.file", dir)
+
+		args := mappingNode()
+		setKey(args, "dest", stringNode(jinja(filePath)))
+		setKey(args, "content", stringNode(jinja(content)))
+		if mode != "" {
+			setKey(args, "mode", stringNode(jinja(mode)))
+		}
+		if task.Owner != "" {
+			setKey(args, "owner", stringNode(jinja(task.Owner)))
+		}
+		if task.Group != "" {
+			setKey(args, "group", stringNode(jinja(task.Group)))
+		}
+		write := named(task.Name)
+		setKey(write, "ansible.builtin.copy", args)
+		if task.Elevated {
+			setKey(parent, "become", boolNode(true))
+			setKey(write, "become", boolNode(true))
+		}
+		return []*yaml.Node{parent, write}, nil
+
+	case "service":
+		name, actions := task.ServiceSpec()
+		if name == "" {
+			return nil, fmt.Errorf("service task requires a service")
+		}
+		args := mappingNode()
+		setKey(args, "name", stringNode(jinja(name)))
+		status := false
+		for _, action := range actions {
+			switch action {
+			case "enable", "disable":
+				setKey(args, "enabled", boolNode(action == "enable"))
+			case "start", "stop", "restart", "reload":
+				states := map[string]string{"start": "started", "stop": "stopped", "restart": "restarted", "reload": "reloaded"}
+				setKey(args, "state", stringNode(states[action]))
+			case "status":
+				status = true
+			default:
+				return nil, fmt.Errorf("invalid service action: %s", action)
+			}
+		}
+		node := named(task.Name)
+		if status && len(args.Content) == 2 {
+			// Only reports the state of the service, as the executor does
+			argv := sequenceNode(stringNode("systemctl"), stringNode("status"), stringNode(jinja(name)))
+			command := mappingNode()
+			setKey(command, "argv", argv)
+			setKey(node, "ansible.builtin.command", command)
+			setKey(node, "changed_when", boolNode(false))
+			return []*yaml.Node{node}, nil
+		}
+		setKey(node, "ansible.builtin.systemd", args)
+		setKey(node, "become", boolNode(true))
+		return []*yaml.Node{node}, nil
+
+	default:
+		return nil, fmt.Errorf("task type %q cannot be exported", task.Type)
+	}
+}
+
+// scriptInterpreter returns the interpreter named by the first line of a script,
+// "" when it has none
+func scriptInterpreter(script string) string {
+	first, _, _ := strings.Cut(script, "\n")
+	if !strings.HasPrefix(first, "#!") {
+		return ""
+	}
+	fields := strings.Fields(strings.TrimPrefix(first, "#!"))
+	if len(fields) == 0 {
+		return ""
+	}
+	if path.Base(fields[0]) == "env" && len(fields) > 1 {
+		return fields[1]
+	}
+	return fields[0]
+}
+
+// secretPrompt returns the vars_prompt text of a secret variable
+func secretPrompt(secret presets.Variable) string {
+	if secret.Description != "" {
+		return secret.Description
+	}
+	return secret.Name
+}
+
+// jinja converts rendered text to an Ansible template: references become Jinja
+// expressions and literal text that Jinja would interpret is wrapped in raw blocks
+func jinja(text string) string {
+	parts := refPattern.Split(text, -1)
+	refs := refPattern.FindAllString(text, -1)
+	var out strings.Builder
+	for i, part := range parts {
+		if strings.Contains(part, "{{") || strings.Contains(part, "{%") || strings.Contains(part, "{#") {
+			part = "{% raw %}" + part + "{% endraw %}"
+		}
+		out.WriteString(part)
+		if i < len(refs) {
+			out.WriteString(ReplaceRefs(refs[i], func(ref Ref) string {
+				return "{{ " + jinjaExpression(ref) + " }}"
+			}))
+		}
+	}
+	return out.String()
+}
+
+// jinjaExpression returns the Ansible expression of a run-time value
+func jinjaExpression(ref Ref) string {
+	switch ref.Kind {
+	case RefRegistered:
+		return ref.Name + "." + ref.Field
+	case RefFailedTask:
+		if ref.Field == "name" {
+			return "ansible_failed_task.name"
+		}
+		return "ansible_failed_result.msg | default('')"
+	default:
+		return ref.Name
+	}
+}
+
+func mappingNode() *yaml.Node {
+	return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+}
+
+func sequenceNode(items ...*yaml.Node) *yaml.Node {
+	return &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: items}
+}
+
+// stringNode returns a string scalar, as a literal block when it has several lines
+func stringNode(value string) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+	if strings.Contains(value, "\n") {
+		node.Style = yaml.LiteralStyle
+	}
+	return node
+}
+
+func boolNode(value bool) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: fmt.Sprint(value)}
+}
+
+func setKey(mapping *yaml.Node, key string, value *yaml.Node) {
+	mapping.Content = append(mapping.Content, stringNode(key), value)
+}
+
+// findKey returns the value of a key of a mapping, nil when it is not set
+func findKey(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// encodeYAML encodes a YAML document with two-space indentation
+func encodeYAML(node *yaml.Node) ([]byte, error) {
+	var out strings.Builder
+	out.WriteString("---\n")
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return []byte(out.String()), nil
+}
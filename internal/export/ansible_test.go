@@ -0,0 +1,76 @@
+package export
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// shellCommands returns the cmd of every shell module task in a decoded playbook
+func shellCommands(node interface{}) []string {
+	var commands []string
+	switch value := node.(type) {
+	case map[string]interface{}:
+		if shell, ok := value["ansible.builtin.shell"].(map[string]interface{}); ok {
+			if cmd, ok := shell["cmd"].(string); ok {
+				commands = append(commands, cmd)
+			}
+		}
+		for _, child := range value {
+			commands = append(commands, shellCommands(child)...)
+		}
+	case []interface{}:
+		for _, child := range value {
+			commands = append(commands, shellCommands(child)...)
+		}
+	}
+	return commands
+}
+
+// checkAnsibleYAML parses a rendered file and its shell scripts
+func checkAnsibleYAML(t *testing.T, name string, data []byte) {
+	t.Helper()
+	var decoded interface{}
+	if err := yaml.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("%s is not valid YAML: %v", name, err)
+	}
+	for _, cmd := range shellCommands(decoded) {
+		checkShell(t, name, []byte(cmd))
+	}
+}
+
+func TestAnsible(t *testing.T) {
+	playbook, err := Ansible(testPlan(t, nil), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAnsibleYAML(t, "playbook", playbook)
+	golden(t, "ansible.golden", playbook)
+
+	text := string(playbook)
+	for _, want := range []string{"vars_prompt:", "'{{ wifi_password }}'", "'{{ ansible_failed_task.name }}'", "register: kernel"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("playbook does not contain %s", want)
+		}
+	}
+	if strings.Contains(text, "Enable I2C\n") {
+		t.Error("a task skipped for these facts is in the playbook")
+	}
+}
+
+func TestAnsibleRole(t *testing.T) {
+	files, err := AnsibleRole(testPlan(t, nil), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, file.Path)
+		checkAnsibleYAML(t, file.Path, file.Data)
+		golden(t, "ansible-role/"+file.Path, file.Data)
+	}
+	if got := strings.Join(paths, ","); !strings.Contains(got, "tasks/main.yml") || !strings.Contains(got, "handlers/main.yml") {
+		t.Errorf("role files = %s, want tasks and handlers", got)
+	}
+}
@@ -0,0 +1,651 @@
+package export
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"base-linux-setup/internal/presets"
+)
+
+// bashPrelude defines the logging and helper functions of exported scripts. It
+// mirrors the executor: the same messages, sudo only when not running as root,
+// files left alone when already up to date.
+const bashPrelude = `BLS_CONTINUE=${BLS_CONTINUE:-0}
+BLS_TMP=$(mktemp -d) || exit 1
+trap 'rm -rf "$BLS_TMP"' EXIT
+SUDO=
+[ "$(id -u)" -eq 0 ] || SUDO=sudo
+
+completed=0
+skipped=0
+failed=0
+incomplete=" "
+notified=" "
+changed=0
+any_changed=0
+BLS_CAPTURE=
+
+if [ -t 1 ]; then
+    c_cyan='\033[36m' c_green='\033[32m' c_yellow='\033[33m' c_red='\033[31m' c_gray='\033[90m' c_reset='\033[0m'
+else
+    c_cyan= c_green= c_yellow= c_red= c_gray= c_reset=
+fi
+
+# say <color> <message>
+say() {
+    printf '%b%s%b\n' "$1" "$2" "$c_reset"
+}
+
+# run <command...> logs and runs one command, capturing its output for registered results
+run() {
+    say "$c_gray" "    Running: $*"
+    changed=1
+    if [ -n "$BLS_CAPTURE" ]; then
+        "$@" >"$BLS_TMP/output"
+        status=$?
+        cat "$BLS_TMP/output"
+        cat "$BLS_TMP/output" >>"$BLS_CAPTURE"
+    else
+        "$@"
+        status=$?
+    fi
+    if [ "$status" -ne 0 ]; then
+        say "$c_red" "    ✗ Failed with exit code $status"
+        changed=0
+    fi
+    return "$status"
+}
+
+# run_script <file> runs a script with the interpreter named by its first line
+run_script() {
+    chmod +x "$1" && run "$1"
+}
+
+# file_matches <path> <mode> <owner> <group> reports whether a file already has the
+# content of $BLS_TMP/content and, where set, the mode, owner and group
+file_matches() {
+    [ -f "$1" ] && cmp -s "$BLS_TMP/content" "$1" || return 1
+    attrs=$(stat -c '%a %U %G' "$1" 2>/dev/null) || return 1
+    set -- "$(printf '%s' "$2" | sed 's/^0*//')" "$3" "$4" $attrs
+    [ -z "$1" ] || [ "$1" = "$4" ] || return 1
+    [ -z "$2" ] || [ "$2" = "$5" ] || return 1
+    [ -z "$3" ] || [ "$3" = "$6" ]
+}
+
+# write_file <path> <mode> <owner> <group> <elevated> installs $BLS_TMP/content
+write_file() {
+    if file_matches "$1" "$2" "$3" "$4"; then
+        say "$c_green" "    ✓ File unchanged: $1"
+        return 0
+    fi
+    sudo=
+    [ "$5" = 1 ] && sudo=$SUDO
+    say "$c_gray" "    Running: ${sudo:+$sudo }install -D -m ${2:-0644}${3:+ -o $3}${4:+ -g $4} <content> $1"
+    if ! $sudo install -D -m "${2:-0644}" ${3:+-o "$3"} ${4:+-g "$4"} "$BLS_TMP/content" "$1"; then
+        say "$c_red" "    ✗ Failed to install file $1"
+        return 1
+    fi
+    changed=1
+    say "$c_green" "    ✓ File written: $1"
+}
+
+# manage_service <action> <service> runs one systemctl action, recording whether
+# it changes the state of the service
+manage_service() {
+    case "$1" in
+    start) systemctl is-active --quiet "$2" || changed=1 ;;
+    stop) ! systemctl is-active --quiet "$2" || changed=1 ;;
+    enable) systemctl is-enabled --quiet "$2" || changed=1 ;;
+    disable) ! systemctl is-enabled --quiet "$2" || changed=1 ;;
+    restart | reload) changed=1 ;;
+    esac
+    say "$c_gray" "    Running: systemctl $1 $2"
+    sudo=$SUDO
+    [ "$1" = status ] && sudo=
+    if ! $sudo systemctl "$1" "$2"; then
+        say "$c_red" "    ✗ systemctl $1 $2 failed"
+        changed=0
+        return 1
+    fi
+}
+
+# notify_handler <index> queues a handler for the next flush when the task changed
+# something
+notify_handler() {
+    [ "$changed" = 1 ] || return 0
+    case "$notified" in
+    *" $1 "*) ;;
+    *) notified="$notified$1 " ;;
+    esac
+}
+
+# skip <name> <reason> [id] reports a skipped task
+skip() {
+    say "$c_yellow" "↷ Task skipped ($2): $1"
+    skipped=$((skipped + 1))
+    [ -z "${3:-}" ] || incomplete="$incomplete$3 "
+    echo
+}
+
+# step <number> <name> <function> <id> <dependencies> runs a task unless a task it
+# depends on did not complete, stopping the run when it fails
+step() {
+    say "$c_cyan" "Executing task $1/$BLS_TOTAL: $2"
+    for dep in $5; do
+        case "$incomplete" in
+        *" $dep "*)
+            say "$c_yellow" "↷ Task skipped (dependency $dep not completed): $2"
+            skipped=$((skipped + 1))
+            incomplete="$incomplete$4 "
+            echo
+            return 0
+            ;;
+        esac
+    done
+    changed=0
+    any_changed=0
+    if "$3"; then
+        say "$c_green" "✓ Task completed: $2"
+        completed=$((completed + 1))
+    else
+        say "$c_red" "Error executing task '$2'"
+        failed=$((failed + 1))
+        incomplete="$incomplete$4 "
+        [ "$BLS_CONTINUE" = 1 ] || finish "task '$2' failed"
+    fi
+    echo
+}
+
+# handler <name> <function> runs a notified handler
+handler() {
+    say "$c_cyan" "Running handler: $1"
+    changed=0
+    any_changed=0
+    if "$2"; then
+        say "$c_green" "✓ Handler completed: $1"
+        completed=$((completed + 1))
+    else
+        say "$c_red" "Error executing handler '$1'"
+        failed=$((failed + 1))
+        [ "$BLS_CONTINUE" = 1 ] || finish "handler '$1' failed"
+    fi
+    echo
+}
+
+# nested <name> <function> runs a task of a block, recording it when it fails. The
+# block has changed something when any of its tasks has.
+nested() {
+    say "$c_cyan" "  ▸ $1"
+    changed=0
+    "$2"
+    set -- "$1" "$?"
+    [ "$changed" = 0 ] || any_changed=1
+    changed=$any_changed
+    [ "$2" -eq 0 ] && return 0
+    say "$c_red" "  ✗ $1"
+    BLS_FAILED_TASK_NAME=$1
+    BLS_FAILED_TASK_ERROR="task '$1' failed"
+    export BLS_FAILED_TASK_NAME BLS_FAILED_TASK_ERROR
+    return 1
+}
+
+# skip_nested <name> reports a task of a block whose condition is false
+skip_nested() {
+    say "$c_cyan" "  ▸ $1"
+    say "$c_yellow" "  ↷ Skipped (condition false)"
+}
+`
+
+// Bash renders a plan as a standalone POSIX shell script with the same task
+// boundaries, logging and error handling as a non-interactive run
+func Bash(plan *Plan, toolVersion string) ([]byte, error) {
+	b := &bashWriter{plan: plan}
+	preset := plan.Preset
+
+	b.line("#!/bin/sh")
+	b.line("# %s", strings.TrimSpace(preset.Name+" "+preset.Version))
+	if preset.Description != "" {
+		b.line("# %s", preset.Description)
+	}
+	b.line("#")
+	b.line("# Generated by base-linux-setup %s (export --format bash).", toolVersion)
+	if facts := describeFacts(plan.Facts); facts != "" {
+		b.line("# Conditions were evaluated for: %s", facts)
+	}
+	if len(plan.Variables) > 0 {
+		b.line("#")
+		b.line("# Variables:")
+		names := make([]string, 0, len(plan.Variables))
+		for name := range plan.Variables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			b.line("#   %s = %s", name, presets.FormatValue(plan.Variables[name]))
+		}
+	}
+	if len(plan.Secrets) > 0 {
+		b.line("#")
+		b.line("# Secrets are read from BLS_SECRET_<NAME> environment variables:")
+		for _, secret := range plan.Secrets {
+			b.line("#   %s  %s", secretVariable(secret.Name), secret.Description)
+		}
+	}
+	b.line("#")
+	b.line("# Tasks run in dependency order and the script stops at the first failed task.")
+	b.line("# Set BLS_CONTINUE=1 to keep going; tasks depending on a failed task are skipped.")
+	b.line("# Handlers run at the end of the run when a task notifying them changed something.")
+	b.line("")
+	b.line("set -u")
+	b.line("")
+
+	for _, secret := range plan.Secrets {
+		name := secretVariable(secret.Name)
+		b.line(`: "${%s:?set %s to the value of the %s variable}"`, name, name, secret.Name)
+		b.line("export %s", name)
+	}
+	for _, name := range registerNames(append(append([]presets.Task{}, preset.Tasks...), preset.Handlers...)) {
+		// Results of skipped tasks are empty, as in the executor
+		b.line("%s= %s=-1", registeredVariable(name, "stdout"), registeredVariable(name, "rc"))
+		b.line("export %s %s", registeredVariable(name, "stdout"), registeredVariable(name, "rc"))
+	}
+	b.line("BLS_TOTAL=%d", len(plan.Steps))
+	b.text(bashPrelude)
+
+	// finish reports the outcome and exits
+	b.line("")
+	b.line("# finish [error] prints the summary and exits")
+	b.line("finish() {")
+	b.line(`    say "$c_cyan" "Summary: $completed completed, $skipped skipped, $failed failed"`)
+	b.line(`    if [ -n "${1:-}" ]; then`)
+	b.line(`        say "$c_red" "Error: $1"`)
+	b.line(`        say "$c_yellow" "Setup cancelled."`)
+	b.line("        exit 1")
+	b.line("    fi")
+	b.line(`    if [ "$failed" -gt 0 ]; then`)
+	b.line(`        say "$c_yellow" "Setup finished with $failed failed task(s): $completed completed, $skipped skipped."`)
+	b.line("        exit 1")
+	b.line("    fi")
+	b.line(`    say "$c_green" "Setup completed successfully!"`)
+	if preset.RebootRequired {
+		b.line(`    say "$c_yellow" "This preset requires a reboot to finish: sudo reboot"`)
+	}
+	b.line("    exit 0")
+	b.line("}")
+
+	// Handlers and the flush function
+	for i, step := range plan.Handlers {
+		if step.Skip == "" {
+			if err := b.function(fmt.Sprintf("handler_%d", i), "Handler", step); err != nil {
+				return nil, fmt.Errorf("handler '%s': %v", step.Task.Name, err)
+			}
+		}
+	}
+	b.line("")
+	b.line("# flush_handlers runs the notified handlers once, in declaration order")
+	b.line("flush_handlers() {")
+	b.line(`    [ "$notified" = " " ] && return 0`)
+	b.line(`    pending=$notified`)
+	b.line(`    notified=" "`)
+	b.line(`    say "$c_cyan" "Running notified handlers"`)
+	for i, step := range plan.Handlers {
+		b.line(`    case "$pending" in *" %d "*)`, i)
+		if step.Skip != "" {
+			b.line(`        skip %s %s ;;`, b.word(step.Task.Name), shellQuote(step.Skip))
+		} else {
+			b.line(`        handler %s handler_%d ;;`, b.word(step.Task.Name), i)
+		}
+		b.line("    esac")
+	}
+	b.line("}")
+
+	// Task functions, then the run itself
+	for i, step := range plan.Steps {
+		if step.Skip != "" || step.Task.Type == "flush_handlers" {
+			continue
+		}
+		if err := b.function(fmt.Sprintf("task_%d", i+1), fmt.Sprintf("Task %d", i+1), step); err != nil {
+			return nil, fmt.Errorf("task '%s': %v", step.Task.Name, err)
+		}
+	}
+
+	b.line("")
+	b.line("# Run")
+	for i, step := range plan.Steps {
+		number := i + 1
+		name := b.word(step.Task.Name)
+		switch {
+		case step.Skip != "":
+			b.line(`say "$c_cyan" %s`, b.word(fmt.Sprintf("Executing task %d/%d: %s", number, len(plan.Steps), step.Task.Name)))
+			b.line("skip %s %s %s", name, shellQuote(step.Skip), shellQuote(step.Task.ID))
+		case step.Task.Type == "flush_handlers":
+			b.line(`say "$c_cyan" %s`, b.word(fmt.Sprintf("Executing task %d/%d: %s", number, len(plan.Steps), step.Task.Name)))
+			b.line("flush_handlers")
+			b.line("completed=$((completed + 1))")
+			b.line("echo")
+		default:
+			b.line("step %d %s task_%d %s %s", number, name, number, shellQuote(step.Task.ID), shellQuote(strings.Join(step.Task.DependsOn, " ")))
+		}
+	}
+	b.line("flush_handlers")
+	b.line("finish")
+
+	return []byte(b.out.String()), nil
+}
+
+type bashWriter struct {
+	plan *Plan
+	out  strings.Builder
+}
+
+func (b *bashWriter) line(format string, args ...interface{}) {
+	if len(args) == 0 {
+		b.out.WriteString(format)
+	} else {
+		fmt.Fprintf(&b.out, format, args...)
+	}
+	b.out.WriteString("\n")
+}
+
+func (b *bashWriter) text(text string) {
+	b.out.WriteString(text)
+}
+
+// function writes the shell function running a step, preceded by its nested and
+// per-item functions
+func (b *bashWriter) function(fn, label string, step Step) error {
+	task := step.Task
+	body := make([]string, 0)
+
+	switch {
+	case task.IsBlock():
+		lines, err := b.block(fn, step)
+		if err != nil {
+			return err
+		}
+		body = lines
+	case step.Items != nil:
+		if len(step.Items) == 0 {
+			body = append(body, `say "$c_gray" "  No loop items, nothing to do"`)
+			break
+		}
+		failures := "items_" + strings.TrimPrefix(fn, "task_")
+		body = append(body, failures+"=")
+		for k, item := range step.Items {
+			// The loop task registers and notifies for all its items
+			itemTask := item.Task
+			itemTask.Register = ""
+			itemFn := fmt.Sprintf("%s_%d", fn, k+1)
+			if err := b.function(itemFn, fmt.Sprintf("%s, item %d", label, k+1), Step{Task: itemTask}); err != nil {
+				return err
+			}
+			body = append(body,
+				fmt.Sprintf(`say "$c_gray" %s`, b.word(fmt.Sprintf("  Item %d/%d: %s", k+1, len(step.Items), item.Value))),
+				fmt.Sprintf(`%s || { say "$c_red" %s; %s="$%s %s"; }`, itemFn,
+					b.word(fmt.Sprintf("  ✗ Item '%s' failed", item.Value)), failures, failures, shellQuote(item.Value)),
+			)
+		}
+		body = append(body, fmt.Sprintf(`[ -z "$%s" ] || { say "$c_red" "  Items failed:$%s"; return 1; }`, failures, failures))
+		body = append(body, b.notify(step)...)
+	default:
+		lines, err := b.taskBody(task)
+		if err != nil {
+			return err
+		}
+		body = append(lines, b.notify(step)...)
+	}
+
+	// Registered results capture the output of every command of the task
+	if task.Register != "" {
+		inner := fn + "_body"
+		b.write(inner, "", body)
+		stdout, rc := registeredVariable(task.Register, "stdout"), registeredVariable(task.Register, "rc")
+		body = []string{
+			`BLS_CAPTURE="$BLS_TMP/capture"`,
+			`: >"$BLS_CAPTURE"`,
+			inner,
+			"status=$?",
+			fmt.Sprintf(`%s=$(cat "$BLS_CAPTURE")`, stdout),
+			fmt.Sprintf("%s=$status", rc),
+			fmt.Sprintf("export %s %s", stdout, rc),
+			"BLS_CAPTURE=",
+			`return "$status"`,
+		}
+	}
+
+	comment := fmt.Sprintf("%s: %s", label, task.Name)
+	if task.Description != "" {
+		comment += "\n" + task.Description
+	}
+	b.write(fn, comment, body)
+	return nil
+}
+
+// write writes a shell function
+func (b *bashWriter) write(fn, comment string, body []string) {
+	b.line("")
+	if comment != "" {
+		comment = ReplaceRefs(comment, func(ref Ref) string { return "$" + refVariable(ref) })
+		for _, line := range strings.Split(comment, "\n") {
+			b.line("# %s", line)
+		}
+	}
+	b.line("%s() {", fn)
+	if len(body) == 0 {
+		body = []string{":"}
+	}
+	for _, line := range body {
+		// Here-document lines are marked by heredoc and written as they are
+		for _, part := range strings.Split(line, "\n") {
+			if strings.HasPrefix(part, "\x00") {
+				b.line("%s", part[1:])
+			} else {
+				b.line("    %s", part)
+			}
+		}
+	}
+	b.line("}")
+}
+
+// block returns the body of a block task's function
+func (b *bashWriter) block(fn string, step Step) ([]string, error) {
+	status := "status_" + strings.TrimPrefix(fn, "task_")
+	chain := func(steps []Step, prefix string) (string, error) {
+		calls := make([]string, 0, len(steps))
+		for j, nested := range steps {
+			if nested.Skip != "" {
+				calls = append(calls, "skip_nested "+b.word(nested.Task.Name))
+				continue
+			}
+			nestedFn := fmt.Sprintf("%s_%s%d", fn, prefix, j+1)
+			if err := b.function(nestedFn, "Nested task", nested); err != nil {
+				return "", fmt.Errorf("task '%s': %v", nested.Task.Name, err)
+			}
+			calls = append(calls, fmt.Sprintf("nested %s %s", b.word(nested.Task.Name), nestedFn))
+		}
+		if len(calls) == 0 {
+			return ":", nil
+		}
+		return strings.Join(calls, " && "), nil
+	}
+
+	block, err := chain(step.Block, "b")
+	if err != nil {
+		return nil, err
+	}
+	body := []string{status + "=0", fmt.Sprintf("%s || %s=1", block, status)}
+
+	if len(step.Rescue) > 0 {
+		rescue, err := chain(step.Rescue, "r")
+		if err != nil {
+			return nil, err
+		}
+		body = append(body,
+			fmt.Sprintf(`if [ "$%s" -ne 0 ]; then`, status),
+			`    say "$c_yellow" "  Block failed, running rescue tasks"`,
+			fmt.Sprintf("    if %s; then", rescue),
+			`        say "$c_green" "  ✓ Block rescued"`,
+			fmt.Sprintf("        %s=0", status),
+			"    fi",
+			"fi",
+		)
+	}
+	if len(step.Always) > 0 {
+		always, err := chain(step.Always, "a")
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, `say "$c_gray" "  Running always tasks"`, fmt.Sprintf("%s || %s=1", always, status))
+	}
+	if notify := b.notify(step); len(notify) > 0 {
+		body = append(body, fmt.Sprintf(`[ "$%s" -eq 0 ] || return 1`, status))
+		return append(body, notify...), nil
+	}
+	return append(body, fmt.Sprintf(`return "$%s"`, status)), nil
+}
+
+// notify returns the commands run after a step succeeded: its changed_when result
+// and the handlers it notifies
+func (b *bashWriter) notify(step Step) []string {
+	lines := make([]string, 0, len(step.Notify)+1)
+	if step.Changed != nil {
+		changed := 0
+		if *step.Changed {
+			changed = 1
+		}
+		lines = append(lines, fmt.Sprintf("changed=%d", changed))
+	}
+	for _, index := range step.Notify {
+		lines = append(lines, fmt.Sprintf("notify_handler %d", index))
+	}
+	return lines
+}
+
+// taskBody returns the commands running a rendered command, script, file or service task
+func (b *bashWriter) taskBody(task presets.Task) ([]string, error) {
+	body := make([]string, 0)
+	switch task.Type {
+	case "command":
+		for _, command := range task.Commands {
+			// Commands are split on whitespace and run without a shell, as in the executor
+			words := strings.Fields(command)
+			if len(words) == 0 {
+				return nil, fmt.Errorf("empty command")
+			}
+			quoted := make([]string, len(words))
+			for i, word := range words {
+				quoted[i] = b.word(word)
+			}
+			body = append(body, fmt.Sprintf("run %s || return $?", strings.Join(quoted, " ")))
+		}
+	case "script":
+		body = append(body, b.heredoc(`"$BLS_TMP/script"`, task.Script), `run_script "$BLS_TMP/script" || return $?`)
+	case "file":
+		path, mode, content := task.FileSpec()
+		elevated := "0"
+		if task.Elevated {
+			elevated = "1"
+		}
+		if strings.HasSuffix(content, "\n") {
+			body = append(body, b.heredoc(`"$BLS_TMP/content"`, strings.TrimSuffix(content, "\n")))
+		} else {
+			body = append(body, fmt.Sprintf(`printf '%%s' %s >"$BLS_TMP/content"`, b.word(content)))
+		}
+		body = append(body, fmt.Sprintf("write_file %s %s %s %s %s || return $?",
+			b.word(path), shellQuote(mode), b.word(task.Owner), b.word(task.Group), elevated))
+	case "service":
+		name, actions := task.ServiceSpec()
+		for _, action := range actions {
+			body = append(body, fmt.Sprintf("manage_service %s %s || return $?", action, b.word(name)))
+		}
+	default:
+		return nil, fmt.Errorf("task type %q cannot be exported", task.Type)
+	}
+	return body, nil
+}
+
+// heredoc returns a command writing text and a final newline to a file. Text with
+// references is written through an unquoted here-document so they expand.
+func (b *bashWriter) heredoc(target, text string) string {
+	delimiter := "BLS_EOF"
+	for n := 2; containsLine(text, delimiter); n++ {
+		delimiter = fmt.Sprintf("BLS_EOF_%d", n)
+	}
+
+	opening := fmt.Sprintf("cat >%s <<'%s'", target, delimiter)
+	if HasRefs(text) {
+		opening = fmt.Sprintf("cat >%s <<%s", target, delimiter)
+		escaper := strings.NewReplacer(`\`, `\\`, "$", `\$`, "`", "\\`")
+		parts := refPattern.Split(text, -1)
+		refs := refPattern.FindAllString(text, -1)
+		var escaped strings.Builder
+		for i, part := range parts {
+			escaped.WriteString(escaper.Replace(part))
+			if i < len(refs) {
+				escaped.WriteString(ReplaceRefs(refs[i], func(ref Ref) string { return "${" + refVariable(ref) + "}" }))
+			}
+		}
+		text = escaped.String()
+	}
+	// Lines of the here-document are marked so write does not indent them
+	return opening + "\n\x00" + strings.ReplaceAll(text, "\n", "\n\x00") + "\n\x00" + delimiter
+}
+
+// word quotes rendered text as a single shell word, expanding its references
+func (b *bashWriter) word(text string) string {
+	if !HasRefs(text) {
+		return shellQuote(text)
+	}
+	parts := refPattern.Split(text, -1)
+	refs := refPattern.FindAllString(text, -1)
+	var word strings.Builder
+	for i, part := range parts {
+		if part != "" {
+			word.WriteString(shellQuote(part))
+		}
+		if i < len(refs) {
+			word.WriteString(ReplaceRefs(refs[i], func(ref Ref) string { return `"${` + refVariable(ref) + `}"` }))
+		}
+	}
+	return word.String()
+}
+
+// refVariable returns the shell variable holding a run-time value
+func refVariable(ref Ref) string {
+	switch ref.Kind {
+	case RefSecret:
+		return secretVariable(ref.Name)
+	case RefRegistered:
+		return registeredVariable(ref.Name, ref.Field)
+	default:
+		return "BLS_FAILED_TASK_" + strings.ToUpper(ref.Field)
+	}
+}
+
+// secretVariable returns the environment variable a secret is read from. The prefix
+// keeps secrets apart from the script's own BLS_ variables, such as BLS_TMP.
+func secretVariable(name string) string {
+	return "BLS_SECRET_" + strings.ToUpper(name)
+}
+
+func registeredVariable(name, field string) string {
+	return "BLS_REG_" + strings.ToUpper(name) + "_" + strings.ToUpper(field)
+}
+
+// shellQuote quotes text as a single shell word, leaving simple words unquoted
+func shellQuote(text string) string {
+	if text != "" && strings.Trim(text, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=,+@%") == "" {
+		return text
+	}
+	return "'" + strings.ReplaceAll(text, "'", `'\''`) + "'"
+}
+
+func containsLine(text, line string) bool {
+	for _, l := range strings.Split(text, "\n") {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
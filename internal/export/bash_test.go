@@ -0,0 +1,28 @@
+package export
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBash(t *testing.T) {
+	script, err := Bash(testPlan(t, nil), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkShell(t, "bash export", script)
+	golden(t, "bash.golden", script)
+
+	text := string(script)
+	if !strings.Contains(text, "BLS_SECRET_WIFI_PASSWORD") {
+		t.Error("the secret is not read from BLS_SECRET_WIFI_PASSWORD")
+	}
+}
+
+func TestSecretVariableAvoidsScriptState(t *testing.T) {
+	for _, name := range []string{"tmp", "continue", "total", "capture"} {
+		if got := secretVariable(name); got == "BLS_"+strings.ToUpper(name) {
+			t.Errorf("secretVariable(%q) = %s, which the script uses for its own state", name, got)
+		}
+	}
+}
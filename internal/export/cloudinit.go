@@ -0,0 +1,497 @@
+package export
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"base-linux-setup/internal/presets"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Stages of cloud-init a task can be moved to. cloud-init manages users and groups,
+// then packages, then deferred files, and only then runs runcmd, so the leading
+// tasks of a plan become modules as long as their stages do not decrease; the
+// remaining tasks run in order from a script.
+const (
+	stageUsers = iota
+	stagePackages
+	stageFiles
+	stageScript
+)
+
+// CloudConfig renders a plan as #cloud-config user-data
+func CloudConfig(plan *Plan, toolVersion string) ([]byte, error) {
+	return cloudConfig(plan, toolVersion, "cloud-init")
+}
+
+// NoCloud renders a NoCloud seed directory with user-data and meta-data, to copy
+// to an image or pack into a "cidata" volume
+func NoCloud(plan *Plan, toolVersion string) ([]File, error) {
+	userData, err := cloudConfig(plan, toolVersion, "nocloud")
+	if err != nil {
+		return nil, err
+	}
+
+	// A new instance ID makes cloud-init run again when the user-data changes
+	sum := sha256.Sum256(userData)
+	meta := mappingNode()
+	setKey(meta, "instance-id", stringNode(fmt.Sprintf("%s-%x", presets.Slug(plan.Preset.Name), sum[:6])))
+	if hostname, ok := plan.Variables["hostname"].(string); ok && hostname != "" {
+		setKey(meta, "local-hostname", stringNode(hostname))
+	}
+	metaData, err := encodeYAML(meta)
+	if err != nil {
+		return nil, err
+	}
+	metaData = []byte(strings.TrimPrefix(string(metaData), "---\n"))
+
+	return []File{
+		{Path: "user-data", Data: userData, Mode: 0644},
+		{Path: "meta-data", Data: metaData, Mode: 0644},
+	}, nil
+}
+
+// cloudModules collects what the leading tasks of a plan ask of cloud-init modules
+type cloudModules struct {
+	groups   []string            // in order of first use
+	members  map[string][]string // group members
+	users    []*cloudUser
+	update   bool
+	upgrade  bool
+	packages []string
+	files    []*yaml.Node
+}
+
+// cloudUser is a user created by useradd
+type cloudUser struct {
+	name, gecos, shell string
+	groups             []string
+	home               bool
+}
+
+func (u *cloudUser) addGroup(name string) {
+	for _, group := range u.groups {
+		if group == name {
+			return
+		}
+	}
+	u.groups = append(u.groups, name)
+}
+
+func cloudConfig(plan *Plan, toolVersion, format string) ([]byte, error) {
+	modules := &cloudModules{members: make(map[string][]string)}
+
+	// Move the leading tasks to modules, then run the others from a script
+	stage, lifted := stageUsers, 0
+	rest := len(plan.Steps)
+	for i, step := range plan.Steps {
+		if step.Skip != "" {
+			continue
+		}
+		next, apply := modules.stage(step)
+		if next == stageScript || next < stage {
+			rest = i
+			break
+		}
+		apply()
+		stage = next
+		lifted++
+	}
+	var remaining []Step
+	for _, step := range plan.Steps[rest:] {
+		if step.Skip == "" {
+			remaining = plan.Steps[rest:]
+			break
+		}
+	}
+
+	slug := presets.Slug(plan.Preset.Name)
+	scriptPath := "/var/lib/base-linux-setup/" + slug + ".sh"
+	envPath := "/etc/base-linux-setup/" + slug + ".env"
+	var runcmd *yaml.Node
+	if len(remaining) > 0 {
+		script, err := Bash(&Plan{
+			Preset:    plan.Preset,
+			Facts:     plan.Facts,
+			Variables: plan.Variables,
+			Secrets:   plan.Secrets,
+			Steps:     remaining,
+			Handlers:  plan.Handlers,
+		}, toolVersion)
+		if err != nil {
+			return nil, err
+		}
+		modules.files = append(modules.files, writeFile(scriptPath, string(script), "0755", ""))
+
+		command := sequenceNode(stringNode("sh"), stringNode(scriptPath))
+		if len(plan.Secrets) > 0 {
+			command = sequenceNode(stringNode("sh"), stringNode("-c"),
+				stringNode(fmt.Sprintf("set -a && . %s && set +a && exec sh %s", envPath, scriptPath)))
+		}
+		runcmd = sequenceNode(command)
+	}
+
+	// Members are added to groups before users are created, so users created here
+	// join their groups when they are created
+	for _, user := range modules.users {
+		for _, group := range modules.groups {
+			members := modules.members[group]
+			for i := 0; i < len(members); i++ {
+				if members[i] == user.name {
+					user.addGroup(group)
+					members = append(members[:i], members[i+1:]...)
+					i--
+				}
+			}
+			modules.members[group] = members
+		}
+	}
+
+	config := mappingNode()
+	if len(modules.groups) > 0 {
+		groups := sequenceNode()
+		for _, group := range modules.groups {
+			members := modules.members[group]
+			if len(members) == 0 {
+				groups.Content = append(groups.Content, stringNode(group))
+				continue
+			}
+			list := sequenceNode()
+			for _, member := range members {
+				list.Content = append(list.Content, stringNode(member))
+			}
+			entry := mappingNode()
+			setKey(entry, group, list)
+			groups.Content = append(groups.Content, entry)
+		}
+		setKey(config, "groups", groups)
+	}
+	if len(modules.users) > 0 {
+		// Listing users replaces the image's default user unless it is kept
+		users := sequenceNode(stringNode("default"))
+		for _, user := range modules.users {
+			entry := mappingNode()
+			setKey(entry, "name", stringNode(user.name))
+			if user.gecos != "" {
+				setKey(entry, "gecos", stringNode(user.gecos))
+			}
+			if user.shell != "" {
+				setKey(entry, "shell", stringNode(user.shell))
+			}
+			if len(user.groups) > 0 {
+				setKey(entry, "groups", stringNode(strings.Join(user.groups, ",")))
+			}
+			if !user.home {
+				// useradd only creates the home directory with -m
+				setKey(entry, "no_create_home", boolNode(true))
+			}
+			users.Content = append(users.Content, entry)
+		}
+		setKey(config, "users", users)
+	}
+	if modules.update {
+		setKey(config, "package_update", boolNode(true))
+	}
+	if modules.upgrade {
+		setKey(config, "package_upgrade", boolNode(true))
+	}
+	if len(modules.packages) > 0 {
+		packages := sequenceNode()
+		for _, name := range modules.packages {
+			packages.Content = append(packages.Content, stringNode(name))
+		}
+		setKey(config, "packages", packages)
+	}
+	if len(modules.files) > 0 {
+		setKey(config, "write_files", sequenceNode(modules.files...))
+	}
+	if runcmd != nil {
+		setKey(config, "runcmd", runcmd)
+	}
+	if plan.Preset.RebootRequired {
+		power := mappingNode()
+		setKey(power, "mode", stringNode("reboot"))
+		setKey(power, "message", stringNode(plan.Preset.Name+" requires a reboot to finish"))
+		setKey(config, "power_state", power)
+	}
+
+	lines := append(headerLines(plan, toolVersion, format), "")
+	switch {
+	case len(remaining) == 0:
+		lines = append(lines, "All tasks map to cloud-init modules.")
+	case lifted == 0:
+		lines = append(lines, fmt.Sprintf("The tasks run in order as root from %s, started by runcmd.", scriptPath))
+	default:
+		lines = append(lines,
+			fmt.Sprintf("The first %d task(s) map to cloud-init modules; the others run in order as root", lifted),
+			fmt.Sprintf("from %s, started by runcmd.", scriptPath))
+	}
+	if len(remaining) > 0 && len(plan.Secrets) > 0 {
+		lines = append(lines, "", fmt.Sprintf("Secrets are read from %s, which the image must provide:", envPath))
+		for _, secret := range plan.Secrets {
+			lines = append(lines, fmt.Sprintf("  %s=...  %s", secretVariable(secret.Name), secret.Description))
+		}
+	}
+	lines = append(lines, skippedLines(plan)...)
+
+	data, err := encodeYAML(config)
+	if err != nil {
+		return nil, err
+	}
+	// user-data must start with the #cloud-config line
+	return []byte("#cloud-config\n" + comment(lines) + "\n" + strings.TrimPrefix(string(data), "---\n")), nil
+}
+
+// stage returns the stage a step can be moved to and the function adding it to the
+// modules, or stageScript when it must run from the script
+func (m *cloudModules) stage(step Step) (int, func()) {
+	task := step.Task
+	if task.Register != "" || len(step.Notify) > 0 || task.IsBlock() {
+		return stageScript, nil
+	}
+
+	tasks := []presets.Task{task}
+	if step.Items != nil {
+		tasks = tasks[:0]
+		for _, item := range step.Items {
+			tasks = append(tasks, item.Task)
+		}
+	}
+
+	stage := -1
+	var applies []func(*cloudModules)
+	add := func(partStage int, apply func(*cloudModules)) bool {
+		// All parts of a step must belong to the same stage to keep their order
+		if apply == nil || stage != -1 && partStage != stage {
+			return false
+		}
+		stage = partStage
+		applies = append(applies, apply)
+		return true
+	}
+	for _, task := range tasks {
+		switch task.Type {
+		case "command":
+			for _, command := range task.Commands {
+				if !add(commandModule(command)) {
+					return stageScript, nil
+				}
+			}
+		case "file":
+			if !add(stageFiles, fileModule(task)) {
+				return stageScript, nil
+			}
+		default:
+			return stageScript, nil
+		}
+	}
+	if stage == -1 {
+		return stageScript, nil
+	}
+	return stage, func() {
+		for _, apply := range applies {
+			apply(m)
+		}
+	}
+}
+
+// commandModule recognizes the package, user and group commands cloud-init modules
+// can run instead, returning their stage and the function adding them to the
+// modules, nil when the command is not one of them
+func commandModule(command string) (int, func(*cloudModules)) {
+	if HasRefs(command) {
+		return stageScript, nil
+	}
+	words := strings.Fields(command)
+	if len(words) > 0 && words[0] == "sudo" {
+		words = words[1:]
+	}
+	if len(words) == 0 {
+		return stageScript, nil
+	}
+
+	switch words[0] {
+	case "apt-get", "apt":
+		var args []string
+		for _, word := range words[1:] {
+			switch word {
+			case "-y", "--yes", "--assume-yes", "-q", "-qq", "--quiet":
+			default:
+				if strings.HasPrefix(word, "-") {
+					return stageScript, nil
+				}
+				args = append(args, word)
+			}
+		}
+		if len(args) == 0 {
+			return stageScript, nil
+		}
+		switch args[0] {
+		case "update":
+			if len(args) == 1 {
+				return stagePackages, func(m *cloudModules) { m.update = true }
+			}
+		case "upgrade", "dist-upgrade", "full-upgrade":
+			if len(args) == 1 {
+				return stagePackages, func(m *cloudModules) { m.upgrade = true }
+			}
+		case "install":
+			if len(args) > 1 {
+				return stagePackages, func(m *cloudModules) { m.addPackages(args[1:]) }
+			}
+		}
+	case "pacman":
+		var sync, update, upgrade bool
+		var names []string
+		for _, word := range words[1:] {
+			switch word {
+			case "--noconfirm", "--needed":
+			case "-S":
+				sync = true
+			case "-Sy", "-Syy":
+				sync, update = true, true
+			case "-Syu", "-Syyu":
+				sync, update, upgrade = true, true, true
+			default:
+				if strings.HasPrefix(word, "-") {
+					return stageScript, nil
+				}
+				names = append(names, word)
+			}
+		}
+		if !sync || !update && len(names) == 0 {
+			return stageScript, nil
+		}
+		return stagePackages, func(m *cloudModules) {
+			m.update = m.update || update
+			m.upgrade = m.upgrade || upgrade
+			m.addPackages(names)
+		}
+	case "groupadd":
+		if name, ok := userCommandName(words[1:], map[string]bool{"-f": false}); ok {
+			return stageUsers, func(m *cloudModules) { m.addGroup(name) }
+		}
+	case "usermod":
+		// usermod -aG groups user, or usermod -a -G groups user
+		args := words[1:]
+		if len(args) == 3 && args[0] == "-aG" {
+			args = []string{"-a", "-G", args[1], args[2]}
+		}
+		if len(args) == 4 && args[0] == "-a" && args[1] == "-G" && !strings.HasPrefix(args[3], "-") {
+			groups, user := strings.Split(args[2], ","), args[3]
+			return stageUsers, func(m *cloudModules) {
+				for _, group := range groups {
+					m.addGroup(group)
+					m.members[group] = append(m.members[group], user)
+				}
+			}
+		}
+	case "useradd":
+		options := map[string]bool{"-m": false, "-s": true, "-G": true, "-c": true}
+		if name, ok := userCommandName(words[1:], options); ok {
+			values := userCommandOptions(words[1:])
+			_, home := values["-m"]
+			user := &cloudUser{name: name, gecos: values["-c"], shell: values["-s"], home: home}
+			if groups := values["-G"]; groups != "" {
+				user.groups = strings.Split(groups, ",")
+			}
+			return stageUsers, func(m *cloudModules) { m.users = append(m.users, user) }
+		}
+	}
+	return stageScript, nil
+}
+
+// userCommandName returns the last argument of a user or group command whose other
+// arguments are the given options, mapped to whether they take a value
+func userCommandName(args []string, options map[string]bool) (string, bool) {
+	if len(args) == 0 || strings.HasPrefix(args[len(args)-1], "-") {
+		return "", false
+	}
+	for i := 0; i < len(args)-1; i++ {
+		takesValue, ok := options[args[i]]
+		if !ok {
+			return "", false
+		}
+		if takesValue {
+			i++
+			if i >= len(args)-1 {
+				return "", false
+			}
+		}
+	}
+	return args[len(args)-1], true
+}
+
+// userCommandOptions returns the options of a useradd command checked by
+// userCommandName, flags mapped to ""
+func userCommandOptions(args []string) map[string]string {
+	values := make(map[string]string)
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == "-m" {
+			values[args[i]] = ""
+			continue
+		}
+		values[args[i]] = args[i+1]
+		i++
+	}
+	return values
+}
+
+// fileModule returns the function adding the write_files entry of a file task, nil
+// when the file uses values only known while running
+func fileModule(task presets.Task) func(*cloudModules) {
+	path, mode, content := task.FileSpec()
+	if path == "" || HasRefs(path) || HasRefs(mode) || HasRefs(content) || HasRefs(task.Owner) || HasRefs(task.Group) {
+		return nil
+	}
+	owner := ""
+	if task.Owner != "" || task.Group != "" {
+		// Files are created by root; the executor leaves an unset owner or group as is
+		user, group := task.Owner, task.Group
+		if user == "" {
+			user = "root"
+		}
+		if group == "" {
+			group = "root"
+		}
+		owner = user + ":" + group
+	}
+	file := writeFile(path, content, mode, owner)
+	return func(m *cloudModules) { m.files = append(m.files, file) }
+}
+
+// writeFile returns a write_files entry, written after users and packages are set up
+func writeFile(path, content, mode, owner string) *yaml.Node {
+	file := mappingNode()
+	setKey(file, "path", stringNode(path))
+	setKey(file, "content", stringNode(content))
+	if mode != "" {
+		setKey(file, "permissions", stringNode(mode))
+	}
+	if owner != "" {
+		setKey(file, "owner", stringNode(owner))
+	}
+	setKey(file, "defer", boolNode(true))
+	return file
+}
+
+func (m *cloudModules) addGroup(name string) {
+	if _, ok := m.members[name]; !ok {
+		m.groups = append(m.groups, name)
+		m.members[name] = nil
+	}
+}
+
+func (m *cloudModules) addPackages(names []string) {
+	for _, name := range names {
+		known := false
+		for _, existing := range m.packages {
+			known = known || existing == name
+		}
+		if !known {
+			m.packages = append(m.packages, name)
+		}
+	}
+}
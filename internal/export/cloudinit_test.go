@@ -0,0 +1,111 @@
+package export
+
+import (
+	"strings"
+	"testing"
+
+	"base-linux-setup/internal/presets"
+
+	"gopkg.in/yaml.v3"
+)
+
+// cloudConfigDoc is the part of user-data the tests look at
+type cloudConfigDoc struct {
+	PackageUpdate bool     `yaml:"package_update"`
+	Packages      []string `yaml:"packages"`
+	WriteFiles    []struct {
+		Path    string `yaml:"path"`
+		Content string `yaml:"content"`
+	} `yaml:"write_files"`
+	Runcmd []interface{} `yaml:"runcmd"`
+}
+
+func decodeCloudConfig(t *testing.T, data []byte) cloudConfigDoc {
+	t.Helper()
+	if !strings.HasPrefix(string(data), "#cloud-config\n") {
+		t.Errorf("user-data does not start with #cloud-config")
+	}
+	var doc cloudConfigDoc
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("user-data is not valid YAML: %v", err)
+	}
+	return doc
+}
+
+func TestCloudConfig(t *testing.T) {
+	userData, err := CloudConfig(testPlan(t, nil), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "cloud-init.golden", userData)
+
+	doc := decodeCloudConfig(t, userData)
+	if !doc.PackageUpdate || strings.Join(doc.Packages, ",") != "curl,git" {
+		t.Errorf("package_update = %v, packages = %v; want the leading tasks as modules", doc.PackageUpdate, doc.Packages)
+	}
+	if len(doc.Runcmd) == 0 {
+		t.Error("the remaining tasks are not started by runcmd")
+	}
+
+	found := false
+	for _, file := range doc.WriteFiles {
+		if file.Path == "/var/lib/base-linux-setup/export-test.sh" {
+			found = true
+			checkShell(t, file.Path, []byte(file.Content))
+			if !strings.Contains(file.Content, "BLS_SECRET_WIFI_PASSWORD") {
+				t.Error("the remaining tasks do not read the secret from the environment")
+			}
+		}
+	}
+	if !found {
+		t.Errorf("write_files = %v, want the script running the remaining tasks", doc.WriteFiles)
+	}
+}
+
+func TestCloudConfigModulesOnly(t *testing.T) {
+	preset := &presets.Preset{Name: "Modules", Tasks: []presets.Task{
+		{ID: "update", Name: "Update", Type: "command", Commands: []string{"sudo apt-get update"}, Elevated: true},
+		{ID: "motd", Name: "Motd", Type: "file", Path: "/etc/motd", Content: "hi\n", Elevated: true},
+	}}
+	plan, err := Resolve(preset, Options{Facts: testFacts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	userData, err := CloudConfig(plan, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := decodeCloudConfig(t, userData)
+	if len(doc.Runcmd) != 0 || len(doc.WriteFiles) != 1 || doc.WriteFiles[0].Path != "/etc/motd" {
+		t.Errorf("user-data =\n%s\nwant only modules", userData)
+	}
+}
+
+func TestNoCloud(t *testing.T) {
+	files, err := NoCloud(testPlan(t, map[string]interface{}{"hostname": "lab-02"}), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].Path != "user-data" || files[1].Path != "meta-data" {
+		t.Fatalf("files = %v, want user-data and meta-data", files)
+	}
+	decodeCloudConfig(t, files[0].Data)
+	golden(t, "nocloud/meta-data", files[1].Data)
+
+	var meta map[string]string
+	if err := yaml.Unmarshal(files[1].Data, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta["local-hostname"] != "lab-02" || !strings.HasPrefix(meta["instance-id"], "export-test-") {
+		t.Errorf("meta-data = %v", meta)
+	}
+
+	// The instance ID follows the user-data so cloud-init runs again after a change
+	other, err := NoCloud(testPlan(t, map[string]interface{}{"hostname": "lab-03"}), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(other[1].Data) == string(files[1].Data) {
+		t.Error("the instance ID did not change with the user-data")
+	}
+}
@@ -0,0 +1,68 @@
+package export
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"base-linux-setup/internal/detector"
+	"base-linux-setup/internal/presets"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Formats are the supported export formats
+var Formats = []string{"bash", "ansible", "ansible-role", "cloud-init", "nocloud"}
+
+// File is a rendered file; Path is empty for formats rendering a single file and
+// relative to the output directory otherwise
+type File struct {
+	Path string
+	Data []byte
+	Mode os.FileMode
+}
+
+// Render renders a plan in the given format
+func Render(plan *Plan, format string) ([]File, error) {
+	switch format {
+	case "bash":
+		data, err := Bash(plan, presets.ToolVersion())
+		return []File{{Data: data, Mode: 0755}}, err
+	case "ansible":
+		data, err := Ansible(plan, presets.ToolVersion())
+		return []File{{Data: data, Mode: 0644}}, err
+	case "ansible-role":
+		return AnsibleRole(plan, presets.ToolVersion())
+	case "cloud-init":
+		data, err := CloudConfig(plan, presets.ToolVersion())
+		return []File{{Data: data, Mode: 0644}}, err
+	case "nocloud":
+		return NoCloud(plan, presets.ToolVersion())
+	default:
+		return nil, fmt.Errorf("unknown export format %q (expected one of %s)", format, strings.Join(Formats, ", "))
+	}
+}
+
+// LoadFactsFile reads the facts of a target machine from a JSON or YAML object,
+// e.g. {"distro": "kali", "arch": "aarch64", "board": {"raspberry_pi": true}}
+func LoadFactsFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read facts file: %v", err)
+	}
+
+	facts := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, &facts); err != nil {
+		return nil, fmt.Errorf("failed to parse facts file %s: %v", path, err)
+	}
+	for name := range facts {
+		known := false
+		for _, fact := range detector.FactNames {
+			known = known || name == fact
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown fact %q in %s (expected %s)", name, path, strings.Join(detector.FactNames, ", "))
+		}
+	}
+	return facts, nil
+}
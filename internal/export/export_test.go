@@ -0,0 +1,137 @@
+package export
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"base-linux-setup/internal/presets"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// testFacts describe a machine the Raspberry Pi tasks of the test preset skip on
+var testFacts = map[string]interface{}{
+	"distro":  "debian",
+	"version": "12",
+	"arch":    "x86_64",
+	"board":   map[string]interface{}{"raspberry_pi": false},
+}
+
+// testPlan resolves testdata/preset.json for testFacts
+func testPlan(t *testing.T, values map[string]interface{}) *Plan {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "preset.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	preset, err := presets.DecodePreset(data)
+	if err != nil {
+		t.Fatalf("DecodePreset: %v", err)
+	}
+	plan, err := Resolve(preset, Options{Facts: testFacts, Values: values})
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	return plan
+}
+
+// golden compares output with testdata/<name>, rewriting it with -update
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file; run go test -update and review the diff\ngot:\n%s", name, got)
+	}
+}
+
+// checkShell parses a script with sh -n
+func checkShell(t *testing.T, name string, script []byte) {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	cmd := exec.Command("sh", "-n")
+	cmd.Stdin = bytes.NewReader(script)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("%s: sh -n: %v\n%s", name, err, output)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	plan := testPlan(t, map[string]interface{}{"hostname": "lab-02"})
+
+	if len(plan.Secrets) != 1 || plan.Secrets[0].Name != "wifi_password" {
+		t.Errorf("Secrets = %v, want wifi_password", plan.Secrets)
+	}
+	if _, ok := plan.Variables["wifi_password"]; ok {
+		t.Error("the secret was resolved as a variable")
+	}
+
+	skips := make(map[string]string)
+	steps := make(map[string]Step)
+	for _, step := range plan.Steps {
+		skips[step.Task.ID] = step.Skip
+		steps[step.Task.ID] = step
+	}
+	if skips["i2c"] != "condition false" || !strings.Contains(skips["i2c-tools"], "dependency i2c") {
+		t.Errorf("skips = %v, want i2c and its dependent skipped", skips)
+	}
+
+	packages := steps["packages"]
+	if len(packages.Items) != 2 || packages.Items[1].Task.Commands[0] != "sudo apt-get install -y git" || packages.Looped == nil {
+		t.Errorf("packages step = %+v, want two items and a looped task", packages)
+	}
+	if _, _, content := steps["hostname"].Task.FileSpec(); content != "lab-02\n" {
+		t.Errorf("hostname content = %q, want the --set value", content)
+	}
+	if len(steps["hostname"].Notify) != 1 {
+		t.Errorf("hostname notifies %v, want the Avahi handler", steps["hostname"].Notify)
+	}
+
+	var refs []Ref
+	ReplaceRefs(steps["wifi"].Task.Script, func(ref Ref) string {
+		refs = append(refs, ref)
+		return ""
+	})
+	if len(refs) != 1 || refs[0].Kind != RefSecret || refs[0].Name != "wifi_password" {
+		t.Errorf("wifi script references %v, want the secret", refs)
+	}
+}
+
+func TestResolveRejectsUnknownVariables(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "preset.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	preset, err := presets.DecodePreset(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Resolve(preset, Options{Facts: testFacts, Values: map[string]interface{}{"nope": "x"}}); err == nil {
+		t.Error("expected an error for an unknown variable")
+	}
+}
+
+func TestRenderUnknownFormat(t *testing.T) {
+	if _, err := Render(testPlan(t, nil), "toml"); err == nil || !strings.Contains(err.Error(), "unknown export format") {
+		t.Errorf("error = %v, want an unknown format error", err)
+	}
+}
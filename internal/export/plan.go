@@ -0,0 +1,412 @@
+// Package export turns a preset into artifacts that run without base-linux-setup,
+// such as shell scripts, Ansible playbooks and cloud-init user-data.
+package export
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"base-linux-setup/internal/expr"
+	"base-linux-setup/internal/presets"
+)
+
+// Options describes the machine a preset is exported for
+type Options struct {
+	Facts  map[string]interface{} // facts of the target machine, see detector.FactNames
+	Values map[string]interface{} // variable values; the others keep their defaults
+}
+
+// Plan is a preset resolved for one machine: templates rendered, loops expanded
+// and conditions evaluated. Values only known while running, registered results
+// and secrets, are left as references, see ReplaceRefs.
+type Plan struct {
+	Preset    *presets.Preset
+	Facts     map[string]interface{}
+	Variables map[string]interface{} // resolved values of the non-secret variables
+	Secrets   []presets.Variable     // variables read from the environment when running
+	Steps     []Step                 // tasks in dependency order
+	Handlers  []Step
+	Warnings  []string // parts of the preset the export only approximates
+}
+
+// Step is a task of a plan
+type Step struct {
+	Task    presets.Task  // rendered task; for loops the unrendered task
+	Items   []Item        // rendered task per loop item, nil when the task has no loop
+	Looped  *presets.Task // loops: task rendered with a reference to the item, nil when it cannot be
+	Skip    string        // reason the task is skipped, "" when it runs
+	Notify  []int         // indexes of the handlers notified when the task changes something
+	Changed *bool         // changed_when evaluated when resolving, nil to detect changes when running
+	Block   []Step        // nested steps of block tasks
+	Rescue  []Step
+	Always  []Step
+}
+
+// Item is one iteration of a loop
+type Item struct {
+	Value string
+	Task  presets.Task
+}
+
+// RefKind is what a run-time reference stands for
+type RefKind string
+
+const (
+	RefSecret     RefKind = "secret"      // value of a secret variable
+	RefRegistered RefKind = "registered"  // field of a registered result: stdout or rc
+	RefFailedTask RefKind = "failed_task" // field of failed_task in rescue tasks: name or error
+	RefLoopItem   RefKind = "item"        // current item of a loop, in Step.Looped
+)
+
+// Ref is a value referenced by rendered text that is only known while running
+type Ref struct {
+	Kind  RefKind
+	Name  string
+	Field string
+}
+
+// refPattern matches the placeholders rendered for references
+var refPattern = regexp.MustCompile("\x1e([a-z_]+):([A-Za-z0-9_]+)\\.([a-z_]*)\x1f")
+
+func (r Ref) placeholder() string {
+	return fmt.Sprintf("\x1e%s:%s.%s\x1f", r.Kind, r.Name, r.Field)
+}
+
+// ReplaceRefs replaces the references in rendered text with the given function
+func ReplaceRefs(text string, replace func(Ref) string) string {
+	return refPattern.ReplaceAllStringFunc(text, func(match string) string {
+		parts := refPattern.FindStringSubmatch(match)
+		return replace(Ref{Kind: RefKind(parts[1]), Name: parts[2], Field: parts[3]})
+	})
+}
+
+// HasRefs reports whether rendered text references run-time values
+func HasRefs(text string) bool {
+	return refPattern.MatchString(text)
+}
+
+// ReplaceTaskRefs replaces the references in the rendered fields of a task
+func ReplaceTaskRefs(task presets.Task, replace func(Ref) string) presets.Task {
+	for _, field := range []*string{&task.Name, &task.Description, &task.Script, &task.Path, &task.Mode,
+		&task.Owner, &task.Group, &task.Content, &task.Service} {
+		*field = ReplaceRefs(*field, replace)
+	}
+	commands := make([]string, len(task.Commands))
+	for i, command := range task.Commands {
+		commands[i] = ReplaceRefs(command, replace)
+	}
+	task.Commands = commands
+	return task
+}
+
+// registeredFields are the fields of registered results that can be referenced
+var registeredFields = []string{"stdout", "rc"}
+
+// Resolve resolves a preset for the machine described by the options
+func Resolve(preset *presets.Preset, opts Options) (*Plan, error) {
+	plan := &Plan{Preset: preset, Facts: opts.Facts}
+
+	// Secrets are never written to exports, so only the other variables are resolved
+	public := *preset
+	public.Variables = nil
+	values := make(map[string]interface{})
+	for _, variable := range preset.Variables {
+		if variable.IsSecret() {
+			plan.Secrets = append(plan.Secrets, variable)
+			continue
+		}
+		public.Variables = append(public.Variables, variable)
+		if value, ok := opts.Values[variable.Name]; ok {
+			values[variable.Name] = value
+		}
+	}
+	for name := range opts.Values {
+		if _, ok := preset.FindVariable(name); !ok {
+			return nil, fmt.Errorf("unknown variable %q for preset %s", name, preset.Name)
+		}
+	}
+	variables, err := public.ResolveVariables(values)
+	if err != nil {
+		return nil, err
+	}
+	plan.Variables = variables
+
+	// Conditions are evaluated now, so they can only use facts and variables;
+	// templates may also reference secrets and registered results
+	r := &resolver{
+		plan:       plan,
+		preset:     preset,
+		conditions: make(map[string]interface{}),
+		templates:  make(map[string]interface{}),
+		skipped:    make(map[string]bool),
+	}
+	for key, value := range opts.Facts {
+		r.conditions[key] = value
+		r.templates[key] = value
+	}
+	for key, value := range variables {
+		r.conditions[key] = value
+		r.templates[key] = value
+	}
+	for _, secret := range plan.Secrets {
+		r.templates[secret.Name] = Ref{Kind: RefSecret, Name: secret.Name}.placeholder()
+	}
+	for _, name := range registerNames(append(append([]presets.Task{}, preset.Tasks...), preset.Handlers...)) {
+		fields := make(map[string]interface{})
+		for _, field := range registeredFields {
+			fields[field] = Ref{Kind: RefRegistered, Name: name, Field: field}.placeholder()
+		}
+		r.templates[name] = fields
+	}
+
+	ordered, err := presets.OrderTasks(preset.Tasks)
+	if err != nil {
+		return nil, err
+	}
+	if plan.Steps, err = r.steps(ordered, true); err != nil {
+		return nil, err
+	}
+	if plan.Handlers, err = r.steps(preset.Handlers, false); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+type resolver struct {
+	plan       *Plan
+	preset     *presets.Preset
+	conditions map[string]interface{} // scope of when conditions
+	templates  map[string]interface{} // scope of templates, with references
+	skipped    map[string]bool        // IDs of tasks skipped when resolving
+}
+
+// steps resolves a task list. Top-level tasks are also skipped when a task they
+// depend on was skipped, as the executor does.
+func (r *resolver) steps(tasks []presets.Task, topLevel bool) ([]Step, error) {
+	steps := make([]Step, 0, len(tasks))
+	for _, task := range tasks {
+		step, err := r.step(task, topLevel)
+		if err != nil {
+			return nil, fmt.Errorf("task '%s': %v", task.Name, err)
+		}
+		if step.Skip != "" && task.ID != "" {
+			r.skipped[task.ID] = true
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+func (r *resolver) step(task presets.Task, topLevel bool) (Step, error) {
+	step := Step{Task: task}
+
+	if topLevel {
+		for _, dep := range task.DependsOn {
+			if r.skipped[dep] {
+				step.Skip = fmt.Sprintf("dependency %s not completed", dep)
+				return step, nil
+			}
+		}
+	}
+	if task.When != "" {
+		run, err := expr.EvalBool(task.When, r.conditions)
+		if err != nil {
+			return step, fmt.Errorf("condition %q cannot be evaluated before running: %v", task.When, err)
+		}
+		if !run {
+			step.Skip = "condition false"
+			return step, nil
+		}
+	}
+
+	for _, ref := range task.Notify {
+		handler, ok := r.preset.FindHandler(ref)
+		if !ok {
+			return step, fmt.Errorf("unknown handler '%s'", ref)
+		}
+		for i := range r.preset.Handlers {
+			if r.preset.Handlers[i].Name == handler.Name {
+				step.Notify = append(step.Notify, i)
+			}
+		}
+	}
+
+	if task.ChangedWhen != "" {
+		changed, err := expr.EvalBool(task.ChangedWhen, r.conditions)
+		if err != nil {
+			r.plan.Warnings = append(r.plan.Warnings, fmt.Sprintf(
+				"task '%s': changed_when %q cannot be evaluated before running, changes are detected as without it", task.Name, task.ChangedWhen))
+		} else {
+			step.Changed = &changed
+		}
+	}
+
+	if task.IsBlock() {
+		var err error
+		if step.Block, err = r.steps(task.Block, false); err != nil {
+			return step, err
+		}
+		// Rescue tasks may reference the task that failed
+		r.templates[presets.FailedTaskVariable] = map[string]interface{}{
+			"name":  Ref{Kind: RefFailedTask, Name: presets.FailedTaskVariable, Field: "name"}.placeholder(),
+			"error": Ref{Kind: RefFailedTask, Name: presets.FailedTaskVariable, Field: "error"}.placeholder(),
+		}
+		step.Rescue, err = r.steps(task.Rescue, false)
+		delete(r.templates, presets.FailedTaskVariable)
+		if err != nil {
+			return step, err
+		}
+		if step.Always, err = r.steps(task.Always, false); err != nil {
+			return step, err
+		}
+		rendered, err := presets.RenderTask(task, r.templates)
+		if err != nil {
+			return step, err
+		}
+		step.Task = rendered
+		return step, nil
+	}
+
+	if !task.Loop.IsEmpty() {
+		values, err := task.Loop.Resolve(r.conditions)
+		if err != nil {
+			return step, fmt.Errorf("failed to resolve loop items: %v", err)
+		}
+		step.Items = make([]Item, 0, len(values))
+		for _, value := range values {
+			rendered, err := presets.RenderTask(task, r.scope(task.LoopVariable(), value))
+			if err != nil {
+				return step, err
+			}
+			step.Items = append(step.Items, Item{Value: value, Task: rendered})
+		}
+		// Formats with their own loops keep the task once, unless the template uses the
+		// item in a way a reference cannot stand for, e.g. in a condition
+		item := Ref{Kind: RefLoopItem, Name: task.LoopVariable()}
+		looped, err := presets.RenderTask(task, r.scope(task.LoopVariable(), item.placeholder()))
+		if err != nil {
+			return step, nil
+		}
+		for _, it := range step.Items {
+			expanded := ReplaceTaskRefs(looped, func(ref Ref) string {
+				if ref == item {
+					return it.Value
+				}
+				return ref.placeholder()
+			})
+			if !reflect.DeepEqual(expanded, it.Task) {
+				return step, nil
+			}
+		}
+		step.Looped = &looped
+		return step, nil
+	}
+
+	rendered, err := presets.RenderTask(task, r.templates)
+	if err != nil {
+		return step, err
+	}
+	step.Task = rendered
+	return step, nil
+}
+
+// scope returns the template scope with one more value
+func (r *resolver) scope(name string, value interface{}) map[string]interface{} {
+	scope := make(map[string]interface{}, len(r.templates)+1)
+	for key, v := range r.templates {
+		scope[key] = v
+	}
+	scope[name] = value
+	return scope
+}
+
+// registerNames returns the names results are registered under, sorted
+func registerNames(tasks []presets.Task) []string {
+	seen := make(map[string]bool)
+	var walk func([]presets.Task)
+	walk = func(tasks []presets.Task) {
+		for _, task := range tasks {
+			if task.Register != "" {
+				seen[task.Register] = true
+			}
+			walk(task.Block)
+			walk(task.Rescue)
+			walk(task.Always)
+		}
+	}
+	walk(tasks)
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// headerLines describes the preset and the machine a plan was resolved for, for
+// the header comment of an export
+func headerLines(plan *Plan, toolVersion, format string) []string {
+	lines := []string{strings.TrimSpace(plan.Preset.Name + " " + plan.Preset.Version)}
+	if plan.Preset.Description != "" {
+		lines = append(lines, plan.Preset.Description)
+	}
+	lines = append(lines, "", fmt.Sprintf("Generated by base-linux-setup %s (export --format %s).", toolVersion, format))
+	if facts := describeFacts(plan.Facts); facts != "" {
+		lines = append(lines, "Conditions were evaluated for: "+facts)
+	}
+	if len(plan.Variables) > 0 {
+		lines = append(lines, "", "Variables:")
+		names := make([]string, 0, len(plan.Variables))
+		for name := range plan.Variables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			lines = append(lines, fmt.Sprintf("  %s = %s", name, presets.FormatValue(plan.Variables[name])))
+		}
+	}
+	return lines
+}
+
+// skippedLines lists the tasks and handlers a plan leaves out, for header comments
+func skippedLines(plan *Plan) []string {
+	var lines []string
+	for _, step := range append(append([]Step{}, plan.Steps...), plan.Handlers...) {
+		if step.Skip != "" {
+			lines = append(lines, fmt.Sprintf("  %s (%s)", step.Task.Name, step.Skip))
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return append([]string{"", "Left out for these facts:"}, lines...)
+}
+
+// comment turns lines into a YAML comment
+func comment(lines []string) string {
+	commented := make([]string, len(lines))
+	for i, line := range lines {
+		commented[i] = strings.TrimRight("# "+line, " ")
+	}
+	return strings.Join(commented, "\n")
+}
+
+// describeFacts summarizes the facts a plan was resolved for, e.g. for a header comment
+func describeFacts(facts map[string]interface{}) string {
+	parts := make([]string, 0, 4)
+	for _, key := range []string{"distro", "version", "arch"} {
+		if value, ok := facts[key]; ok && fmt.Sprint(value) != "" {
+			parts = append(parts, fmt.Sprintf("%s=%v", key, value))
+		}
+	}
+	if board, ok := facts["board"].(map[string]interface{}); ok {
+		if pi, _ := board["raspberry_pi"].(bool); pi {
+			parts = append(parts, "board.raspberry_pi=true")
+		}
+	}
+	return strings.Join(parts, ", ")
+}
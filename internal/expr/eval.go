@@ -0,0 +1,266 @@
+package expr
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// node is an evaluable element of the expression tree
+type node interface {
+	eval(scope map[string]interface{}) (interface{}, error)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(scope map[string]interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+type listNode struct {
+	items []node
+}
+
+func (n *listNode) eval(scope map[string]interface{}) (interface{}, error) {
+	values := make([]interface{}, 0, len(n.items))
+	for _, item := range n.items {
+		value, err := item.eval(scope)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+type nameNode struct {
+	path []string
+}
+
+func (n *nameNode) eval(scope map[string]interface{}) (interface{}, error) {
+	var current interface{} = scope
+	for i, key := range n.path {
+		fields, ok := toMap(current)
+		if !ok {
+			return nil, fmt.Errorf("%s is not an object", strings.Join(n.path[:i], "."))
+		}
+		value, ok := fields[key]
+		if !ok {
+			return nil, fmt.Errorf("undefined name %s", strings.Join(n.path[:i+1], "."))
+		}
+		current = value
+	}
+	return current, nil
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n *notNode) eval(scope map[string]interface{}) (interface{}, error) {
+	value, err := n.operand.eval(scope)
+	if err != nil {
+		return nil, err
+	}
+	return !truthy(value), nil
+}
+
+type logicalNode struct {
+	op          string
+	left, right node
+}
+
+func (n *logicalNode) eval(scope map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	// Short-circuit so guards like `x != null && x.y` work
+	if n.op == "&&" && !truthy(left) {
+		return false, nil
+	}
+	if n.op == "||" && truthy(left) {
+		return true, nil
+	}
+
+	right, err := n.right.eval(scope)
+	if err != nil {
+		return nil, err
+	}
+	return truthy(right), nil
+}
+
+type compareNode struct {
+	op          string
+	left, right node
+}
+
+func (n *compareNode) eval(scope map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(scope)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "in":
+		return member(left, right)
+	case "not in":
+		found, err := member(left, right)
+		return !found, err
+	case "=~":
+		pattern, ok := right.(string)
+		if !ok {
+			return nil, fmt.Errorf("=~ requires a string pattern")
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+		return re.MatchString(toString(left)), nil
+	}
+
+	// Ordering comparisons: numeric when both sides are numbers, otherwise lexical
+	if l, lok := toNumber(left); lok {
+		if r, rok := toNumber(right); rok {
+			return compareOrdered(n.op, l < r, l == r), nil
+		}
+	}
+	l, lok := left.(string)
+	r, rok := right.(string)
+	if !lok || !rok {
+		return nil, fmt.Errorf("cannot compare %v %s %v", left, n.op, right)
+	}
+	return compareOrdered(n.op, l < r, l == r), nil
+}
+
+// compareOrdered applies an ordering operator given less and equal results
+func compareOrdered(op string, less, eq bool) bool {
+	switch op {
+	case "<":
+		return less
+	case "<=":
+		return less || eq
+	case ">":
+		return !less && !eq
+	default: // ">="
+		return !less
+	}
+}
+
+// equal compares two values, treating numbers of any type as equal by value
+func equal(left, right interface{}) bool {
+	if l, ok := toNumber(left); ok {
+		if r, ok := toNumber(right); ok {
+			return l == r
+		}
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+// member reports whether item is in a list or a substring of a string
+func member(item, container interface{}) (bool, error) {
+	if text, ok := container.(string); ok {
+		return strings.Contains(text, toString(item)), nil
+	}
+
+	list, ok := toList(container)
+	if !ok {
+		return false, fmt.Errorf("'in' requires a list or string, got %v", container)
+	}
+	for _, candidate := range list {
+		if equal(item, candidate) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// truthy reports whether a value counts as true in a condition
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	}
+	if n, ok := toNumber(value); ok {
+		return n != 0
+	}
+	if list, ok := toList(value); ok {
+		return len(list) > 0
+	}
+	if fields, ok := toMap(value); ok {
+		return len(fields) > 0
+	}
+	return true
+}
+
+// toNumber converts numeric values to float64
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// toString formats a value for string operations
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// toList converts slice values to []interface{}
+func toList(value interface{}) ([]interface{}, bool) {
+	switch v := value.(type) {
+	case []interface{}:
+		return v, true
+	case []string:
+		list := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			list = append(list, item)
+		}
+		return list, true
+	}
+	return nil, false
+}
+
+// toMap converts object values to map[string]interface{}
+func toMap(value interface{}) (map[string]interface{}, bool) {
+	fields, ok := value.(map[string]interface{})
+	return fields, ok
+}
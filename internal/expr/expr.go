@@ -0,0 +1,68 @@
+// Package expr implements the small boolean expression language used by
+// preset conditions, e.g. `arch in ["arm64", "aarch64"] && board.model >= 4`.
+//
+// Supported syntax:
+//
+//	literals     "text", 'text', 42, 1.5, true, false, null, [a, b, ...]
+//	names        arch, board.model, result.stdout
+//	comparison   ==  !=  <  <=  >  >=  =~ (regular expression match)
+//	membership   in, not in (lists, or substrings of strings)
+//	logic        &&  ||  !  and  or  not, grouped with parentheses
+package expr
+
+import (
+	"fmt"
+)
+
+// Expression is a parsed expression that can be evaluated repeatedly
+type Expression struct {
+	source string
+	root   node
+}
+
+// Parse parses an expression
+func Parse(source string) (*Expression, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+	}
+
+	return &Expression{source: source, root: root}, nil
+}
+
+// String returns the expression source
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Eval evaluates the expression against the given scope
+func (e *Expression) Eval(scope map[string]interface{}) (interface{}, error) {
+	return e.root.eval(scope)
+}
+
+// EvalBool evaluates the expression and reports whether the result is truthy
+func (e *Expression) EvalBool(scope map[string]interface{}) (bool, error) {
+	value, err := e.Eval(scope)
+	if err != nil {
+		return false, err
+	}
+	return truthy(value), nil
+}
+
+// EvalBool parses and evaluates an expression in one step
+func EvalBool(source string, scope map[string]interface{}) (bool, error) {
+	expression, err := Parse(source)
+	if err != nil {
+		return false, err
+	}
+	return expression.EvalBool(scope)
+}
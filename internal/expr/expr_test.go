@@ -0,0 +1,101 @@
+package expr
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEvalBool(t *testing.T) {
+	scope := map[string]interface{}{
+		"arch":     "arm64",
+		"hostname": "kali-pi",
+		"ports":    []interface{}{"22", "80"},
+		"count":    3,
+		"board":    map[string]interface{}{"model": 4},
+		"café":     "open",
+		"result":   map[string]interface{}{"rc": 0, "stdout": "active"},
+	}
+
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{`arch == "arm64"`, true},
+		{`arch != 'arm64'`, false},
+		{`arch in ["arm64", "aarch64"]`, true},
+		{`arch not in ["arm64", "aarch64"]`, false},
+		{`"pi" in hostname`, true},
+		{`"22" in ports`, true},
+		{`board.model >= 4 && count < 4`, true},
+		{`board.model > 4 || count == 3`, true},
+		{`not (count == 3)`, false},
+		{`!false and true`, true},
+		{`hostname =~ "^kali-"`, true},
+		{`result.rc == 0 && result.stdout == "active"`, true},
+		{`count == 3.0`, true},
+		{`1.5 < 2`, true},
+		{`.5 == 0.5`, true},
+		{`café == "open"`, true},
+		{`null == null`, true},
+		{`[]`, false},
+		{`""`, false},
+	}
+
+	for _, tt := range tests {
+		got, err := EvalBool(tt.source, scope)
+		if err != nil {
+			t.Errorf("EvalBool(%q) returned error: %v", tt.source, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("EvalBool(%q) = %v, want %v", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{`1.2.3 == 1.2`, `invalid number "1.2"`},
+		{`1.5.0`, `invalid number "1.5"`},
+		{`12abc == 12`, `invalid number "12"`},
+		{`arch == "arm64`, "unterminated string"},
+		{`arch ==`, "unexpected end of expression"},
+		{`(arch == "arm64"`, "position"},
+		{`arch == "arm64" extra`, `unexpected "extra"`},
+		{`é == 1 @`, `unexpected character '@'`},
+		{`€ == 1`, `unexpected character '€'`},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.source)
+		if err == nil {
+			t.Errorf("Parse(%q) succeeded, want error containing %q", tt.source, tt.want)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error = %q, want it to contain %q", tt.source, err, tt.want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	scope := map[string]interface{}{"arch": "arm64", "count": 3}
+
+	tests := []string{
+		`missing == 1`,
+		`arch.model == 1`,
+		`count < "three"`,
+		`arch =~ 1`,
+		`arch =~ "("`,
+		`"x" in 3`,
+	}
+
+	for _, source := range tests {
+		if _, err := EvalBool(source, scope); err == nil {
+			t.Errorf("EvalBool(%q) succeeded, want an error", source)
+		}
+	}
+}
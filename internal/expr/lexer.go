@@ -0,0 +1,172 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenKind identifies the lexical class of a token
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+	tokenComma
+	tokenDot
+)
+
+// token is a single lexical element of an expression
+type token struct {
+	kind  tokenKind
+	text  string
+	value interface{} // decoded literal for strings and numbers
+	pos   int
+}
+
+// operators lists the symbolic operators, longest first so prefixes match correctly
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "<", ">", "!"}
+
+// tokenize splits an expression into tokens
+func tokenize(input string) ([]token, error) {
+	tokens := make([]token, 0)
+	i := 0
+
+	for i < len(input) {
+		c, size := utf8.DecodeRuneInString(input[i:])
+
+		switch {
+		case unicode.IsSpace(c):
+			i += size
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: i})
+			i++
+		case c == '[':
+			tokens = append(tokens, token{kind: tokenLBracket, text: "[", pos: i})
+			i++
+		case c == ']':
+			tokens = append(tokens, token{kind: tokenRBracket, text: "]", pos: i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: i})
+			i++
+		case c == '.' && (i+1 >= len(input) || !isDigit(rune(input[i+1]))):
+			tokens = append(tokens, token{kind: tokenDot, text: ".", pos: i})
+			i++
+		case c == '"' || c == '\'':
+			text, next, err := readString(input, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: input[i:next], value: text, pos: i})
+			i = next
+		case isDigit(c) || c == '.':
+			start := i
+			i = readNumber(input, i)
+			number, err := strconv.ParseFloat(input[start:i], 64)
+			if err != nil || (i < len(input) && (input[i] == '.' || isIdentPart(nextRune(input, i)))) {
+				return nil, fmt.Errorf("invalid number %q at position %d", input[start:i], start)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: input[start:i], value: number, pos: start})
+		case isIdentStart(c):
+			start := i
+			for i < len(input) && isIdentPart(nextRune(input, i)) {
+				_, size := utf8.DecodeRuneInString(input[i:])
+				i += size
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: input[start:i], pos: start})
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(input[i:], op) {
+					tokens = append(tokens, token{kind: tokenOperator, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+			}
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(input)})
+	return tokens, nil
+}
+
+// readNumber returns the end of the number starting at input[start]: digits with
+// at most one fractional part
+func readNumber(input string, start int) int {
+	i := start
+	for i < len(input) && isDigit(rune(input[i])) {
+		i++
+	}
+	if i < len(input) && input[i] == '.' {
+		i++
+		for i < len(input) && isDigit(rune(input[i])) {
+			i++
+		}
+	}
+	return i
+}
+
+// nextRune decodes the rune starting at input[i]
+func nextRune(input string, i int) rune {
+	c, _ := utf8.DecodeRuneInString(input[i:])
+	return c
+}
+
+// readString reads a quoted string literal starting at input[start]
+func readString(input string, start int) (string, int, error) {
+	quote := input[start]
+	var out strings.Builder
+
+	for i := start + 1; i < len(input); i++ {
+		switch input[i] {
+		case '\\':
+			if i+1 >= len(input) {
+				return "", 0, fmt.Errorf("unterminated string at position %d", start)
+			}
+			i++
+			switch input[i] {
+			case 'n':
+				out.WriteByte('\n')
+			case 't':
+				out.WriteByte('\t')
+			default:
+				out.WriteByte(input[i])
+			}
+		case quote:
+			return out.String(), i + 1, nil
+		default:
+			out.WriteByte(input[i])
+		}
+	}
+
+	return "", 0, fmt.Errorf("unterminated string at position %d", start)
+}
+
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c rune) bool {
+	return c == '_' || unicode.IsLetter(c)
+}
+
+func isIdentPart(c rune) bool {
+	return isIdentStart(c) || isDigit(c)
+}
@@ -0,0 +1,182 @@
+package expr
+
+import (
+	"fmt"
+)
+
+// parser is a recursive descent parser over a token stream
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// isKeyword reports whether the token is the given operator or keyword
+func isKeyword(tok token, words ...string) bool {
+	if tok.kind != tokenOperator && tok.kind != tokenIdent {
+		return false
+	}
+	for _, word := range words {
+		if tok.text == word {
+			return true
+		}
+	}
+	return false
+}
+
+// parseOr parses: and ( ("||" | "or") and )*
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for isKeyword(p.peek(), "||", "or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseAnd parses: not ( ("&&" | "and") not )*
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for isKeyword(p.peek(), "&&", "and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseNot parses: ("!" | "not") not | comparison
+func (p *parser) parseNot() (node, error) {
+	if isKeyword(p.peek(), "!", "not") {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+// parseComparison parses: primary ( op primary )?
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	switch {
+	case isKeyword(tok, "==", "!=", "<", "<=", ">", ">=", "=~", "in"):
+		p.next()
+	case isKeyword(tok, "not") && isKeyword(p.tokens[p.pos+1], "in"):
+		p.next()
+		p.next()
+		tok.text = "not in"
+	default:
+		return left, nil
+	}
+
+	right, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	return &compareNode{op: tok.text, left: left, right: right}, nil
+}
+
+// parsePrimary parses literals, names, lists and parenthesized expressions
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case tokenString, tokenNumber:
+		return &literalNode{value: tok.value}, nil
+	case tokenLParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, fmt.Errorf("expected ')' at position %d", closing.pos)
+		}
+		return inner, nil
+	case tokenLBracket:
+		return p.parseList(tok)
+	case tokenIdent:
+		switch tok.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null", "nil":
+			return &literalNode{value: nil}, nil
+		}
+
+		path := []string{tok.text}
+		for p.peek().kind == tokenDot {
+			p.next()
+			field := p.next()
+			if field.kind != tokenIdent {
+				return nil, fmt.Errorf("expected field name after '.' at position %d", field.pos)
+			}
+			path = append(path, field.text)
+		}
+		return &nameNode{path: path}, nil
+	case tokenEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+
+	return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+}
+
+// parseList parses the items of a list literal after the opening bracket
+func (p *parser) parseList(open token) (node, error) {
+	list := &listNode{}
+	if p.peek().kind == tokenRBracket {
+		p.next()
+		return list, nil
+	}
+
+	for {
+		item, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		list.items = append(list.items, item)
+
+		switch tok := p.next(); tok.kind {
+		case tokenComma:
+			continue
+		case tokenRBracket:
+			return list, nil
+		default:
+			return nil, fmt.Errorf("unterminated list starting at position %d", open.pos)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+// Package lint checks presets for risky and deprecated patterns in their
+// commands, scripts, file contents and variable defaults.
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"base-linux-setup/internal/presets"
+)
+
+// Severity ranks findings; CI runs fail on findings at or above a chosen severity
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	default:
+		return "info"
+	}
+}
+
+// ParseSeverity parses "info", "warning" or "error"
+func ParseSeverity(name string) (Severity, error) {
+	switch strings.ToLower(name) {
+	case "info":
+		return Info, nil
+	case "warning", "warn":
+		return Warning, nil
+	case "error":
+		return Error, nil
+	}
+	return Info, fmt.Errorf("unknown severity %q (expected info, warning or error)", name)
+}
+
+// Source is the kind of preset text a rule looks at
+type Source int
+
+const (
+	SourceCommand  Source = iota // entries of a command task's commands
+	SourceScript                 // lines of a script task
+	SourceContent                // lines written by a file task
+	SourceVariable               // variable defaults
+)
+
+// Rule is a single lint check. Line rules match Pattern, but not Unless, against
+// each line of the sources in In (all sources when empty); task rules implement
+// Check instead, returning one detail per violation ("" when there is nothing to add).
+type Rule struct {
+	ID       string
+	Severity Severity
+	Summary  string
+	Pattern  *regexp.Regexp
+	Unless   *regexp.Regexp
+	In       []Source
+	Check    func(preset *presets.Preset, task presets.Task) []string
+}
+
+// matches reports whether a line rule flags a line
+func (r Rule) matches(line string) bool {
+	return r.Pattern.MatchString(line) && (r.Unless == nil || !r.Unless.MatchString(line))
+}
+
+// appliesTo reports whether a line rule looks at a source
+func (r Rule) appliesTo(source Source) bool {
+	if r.Pattern == nil {
+		return false
+	}
+	if len(r.In) == 0 {
+		return true
+	}
+	for _, in := range r.In {
+		if in == source {
+			return true
+		}
+	}
+	return false
+}
+
+// Finding is a rule violation at a location in a preset
+type Finding struct {
+	Rule     string
+	Severity Severity
+	Location string // e.g. "task install-golang, script line 23"
+	Text     string // the offending line, when there is one
+	Message  string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s %s %s: %s", f.Severity, f.Rule, f.Location, f.Message)
+}
+
+// ignorePattern matches inline suppressions in scripts and file contents:
+// "# lint:ignore BLS001" or "# lint:ignore BLS001,BLS005"
+var ignorePattern = regexp.MustCompile(`#\s*lint:ignore\s+([A-Za-z0-9_, ]+)`)
+
+// templatePattern matches template actions, which are not shell syntax
+var templatePattern = regexp.MustCompile(`\{\{.*?\}\}`)
+
+// Lint checks a preset against every rule and returns the findings in preset order
+func Lint(preset *presets.Preset) []Finding {
+	l := &linter{rules: Rules()}
+
+	ignored := idSet(preset.LintIgnore)
+	for _, warning := range preset.Warnings {
+		l.add(ignored, deprecatedRule, "preset", "", warning)
+	}
+
+	for _, variable := range preset.Variables {
+		if variable.Default == nil {
+			continue
+		}
+		location := fmt.Sprintf("variable %s", variable.Name)
+		l.checkLine(ignored, SourceVariable, location, defaultText(variable.Default))
+	}
+
+	for i, task := range preset.Tasks {
+		l.checkTask(preset, ignored, task, taskLabel(task, fmt.Sprintf("tasks[%d]", i)))
+	}
+	for i, handler := range preset.Handlers {
+		l.checkTask(preset, ignored, handler, "handler "+taskLabel(handler, fmt.Sprintf("handlers[%d]", i)))
+	}
+	return l.findings
+}
+
+// Failed reports whether any finding is at or above a severity
+func Failed(findings []Finding, threshold Severity) bool {
+	for _, finding := range findings {
+		if finding.Severity >= threshold {
+			return true
+		}
+	}
+	return false
+}
+
+type linter struct {
+	rules    []Rule
+	findings []Finding
+}
+
+// add records a finding unless its rule is suppressed
+func (l *linter) add(ignored map[string]bool, rule Rule, location, text, message string) {
+	if ignored[rule.ID] {
+		return
+	}
+	l.findings = append(l.findings, Finding{
+		Rule:     rule.ID,
+		Severity: rule.Severity,
+		Location: location,
+		Text:     strings.TrimSpace(text),
+		Message:  message,
+	})
+}
+
+// checkLine runs the line rules for a source against one line. Template actions
+// in commands are left out, as the executor renders them before splitting.
+func (l *linter) checkLine(ignored map[string]bool, source Source, location, line string) {
+	subject := line
+	if source == SourceCommand {
+		subject = templatePattern.ReplaceAllString(line, "")
+	}
+	for _, rule := range l.rules {
+		if rule.appliesTo(source) && rule.matches(subject) {
+			l.add(ignored, rule, location, line, rule.Summary)
+		}
+	}
+}
+
+// checkTask runs the rules against a task and its nested block tasks. Suppressions
+// of a task apply to the tasks nested in it.
+func (l *linter) checkTask(preset *presets.Preset, inherited map[string]bool, task presets.Task, label string) {
+	ignored := mergeIDs(inherited, task.LintIgnore)
+
+	for _, rule := range l.rules {
+		if rule.Check == nil {
+			continue
+		}
+		for _, detail := range rule.Check(preset, task) {
+			l.add(ignored, rule, "task "+label, detail, rule.Summary)
+		}
+	}
+
+	for i, command := range task.Commands {
+		location := fmt.Sprintf("task %s, command %d", label, i+1)
+		l.checkLine(ignored, SourceCommand, location, command)
+	}
+	if task.Type == "script" {
+		l.checkLines(ignored, SourceScript, "task "+label+", script", task.Script)
+	}
+	if task.Type == "file" {
+		_, _, content := task.FileSpec()
+		l.checkLines(ignored, SourceContent, "task "+label+", content", content)
+	}
+
+	for _, nested := range []struct {
+		name  string
+		tasks []presets.Task
+	}{{"block", task.Block}, {"rescue", task.Rescue}, {"always", task.Always}} {
+		for i, child := range nested.tasks {
+			l.checkTask(preset, ignored, child, label+" > "+taskLabel(child, fmt.Sprintf("%s[%d]", nested.name, i)))
+		}
+	}
+}
+
+// checkLines runs line rules against a multi-line text. A "# lint:ignore" comment
+// suppresses rules on its own line, or on the next line when it stands alone.
+func (l *linter) checkLines(ignored map[string]bool, source Source, location, text string) {
+	var pending []string
+	for i, line := range strings.Split(text, "\n") {
+		lineIgnored := ignored
+		if len(pending) > 0 {
+			lineIgnored = mergeIDs(lineIgnored, pending)
+			pending = nil
+		}
+		if match := ignorePattern.FindStringSubmatch(line); match != nil {
+			ids := splitIDs(match[1])
+			if strings.HasPrefix(strings.TrimSpace(line), "#") {
+				pending = ids
+				continue
+			}
+			lineIgnored = mergeIDs(lineIgnored, ids)
+		}
+		l.checkLine(lineIgnored, source, fmt.Sprintf("%s line %d", location, i+1), line)
+	}
+}
+
+// taskLabel names a task by ID, then name, then position
+func taskLabel(task presets.Task, position string) string {
+	switch {
+	case task.ID != "":
+		return task.ID
+	case task.Name != "":
+		return fmt.Sprintf("%q", task.Name)
+	default:
+		return position
+	}
+}
+
+// defaultText renders a variable default for matching, joining list values
+func defaultText(value interface{}) string {
+	if list, ok := value.([]interface{}); ok {
+		parts := make([]string, len(list))
+		for i, item := range list {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, " ")
+	}
+	if list, ok := value.([]string); ok {
+		return strings.Join(list, " ")
+	}
+	return fmt.Sprint(value)
+}
+
+func splitIDs(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+func idSet(ids []string) map[string]bool {
+	return mergeIDs(nil, ids)
+}
+
+func mergeIDs(base map[string]bool, ids []string) map[string]bool {
+	if len(ids) == 0 {
+		return base
+	}
+	merged := make(map[string]bool, len(base)+len(ids))
+	for id := range base {
+		merged[id] = true
+	}
+	for _, id := range ids {
+		merged[strings.ToUpper(strings.TrimSpace(id))] = true
+	}
+	return merged
+}
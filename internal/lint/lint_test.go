@@ -0,0 +1,232 @@
+package lint
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"base-linux-setup/internal/presets"
+)
+
+// command, script and file build single tasks for rule tests
+func command(lines ...string) presets.Task {
+	return presets.Task{Name: "t", Type: "command", Commands: lines}
+}
+
+func script(body string) presets.Task {
+	return presets.Task{Name: "t", Type: "script", Script: "#!/bin/bash\nset -e\n" + body}
+}
+
+func file(content string) presets.Task {
+	return presets.Task{Name: "t", Type: "file", Path: "/tmp/t", Content: content}
+}
+
+func elevated(task presets.Task) presets.Task {
+	task.Elevated = true
+	return task
+}
+
+// ruleIDs lints a preset holding one task and returns the distinct rule IDs found
+func ruleIDs(task presets.Task) []string {
+	preset := &presets.Preset{Name: "p", Tasks: []presets.Task{task}}
+	return findingIDs(Lint(preset))
+}
+
+func findingIDs(findings []Finding) []string {
+	seen := make(map[string]bool)
+	ids := make([]string, 0)
+	for _, finding := range findings {
+		if !seen[finding.Rule] {
+			seen[finding.Rule] = true
+			ids = append(ids, finding.Rule)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name string
+		task presets.Task
+		rule string
+		want bool
+	}{
+		{"apt-key add", script("apt-key add key.gpg"), "BLS001", true},
+		{"keyring file", script("sudo install -m 0644 key.gpg /etc/apt/keyrings/key.gpg"), "BLS001", false},
+
+		{"curl piped into sh", script("curl -fsSL https://example.com/install.sh | sh"), "BLS002", true},
+		{"wget piped into sudo bash", script("wget -qO- https://example.com/x | sudo -E bash"), "BLS002", true},
+		{"curl to a file", script("curl -fsSL -o install.sh https://example.com/install.sh"), "BLS002", false},
+
+		{"public DNS in a file", file("nameserver 8.8.8.8\n"), "BLS003", true},
+		{"private DNS in a file", file("nameserver 192.168.1.1\n"), "BLS003", false},
+
+		{"script without set -e", presets.Task{Name: "t", Type: "script", Script: "#!/bin/bash\necho hi"}, "BLS004", true},
+		{"set -euo pipefail", presets.Task{Name: "t", Type: "script", Script: "#!/bin/bash\nset -euo pipefail\necho hi"}, "BLS004", false},
+		{"set -o errexit", presets.Task{Name: "t", Type: "script", Script: "#!/bin/bash\nset -o errexit\necho hi"}, "BLS004", false},
+
+		{"append to bashrc", script("echo 'export A=1' >> ~/.bashrc"), "BLS005", true},
+		{"tee -a to profile", script("echo 'export A=1' | tee -a \"$HOME/.profile\""), "BLS005", true},
+		{"append to another file", script("echo 'export A=1' >> /tmp/env"), "BLS005", false},
+
+		{"pipe in a command", command("sudo apt-get update || true"), "BLS006", true},
+		{"variable in a command", command("echo $HOME"), "BLS006", true},
+		{"template in a command", command("sudo hostnamectl set-hostname {{ .hostname }}"), "BLS006", false},
+		{"pipe in a script", script("ls | wc -l"), "BLS006", false},
+
+		{"http repository", file("deb http://deb.debian.org/debian bookworm main\n"), "BLS007", true},
+		{"http download", script("curl -fsSLO http://example.com/x.tar.gz"), "BLS007", true},
+		{"https repository", file("deb [signed-by=/etc/apt/keyrings/x.gpg] https://deb.debian.org/debian bookworm main\n"), "BLS007", false},
+
+		{"apt-get install without -y", command("sudo apt-get install curl"), "BLS008", true},
+		{"apt-get install -y", command("sudo apt-get install -y curl"), "BLS008", false},
+		{"apt-get install -qy", command("sudo apt-get -qy install curl"), "BLS008", false},
+		{"apt-get update", command("sudo apt-get update"), "BLS008", false},
+
+		{"chmod 777", command("chmod 777 /srv"), "BLS009", true},
+		{"chmod -R o+w", command("chmod -R o+w /srv"), "BLS009", true},
+		{"chmod 755", command("chmod 755 /srv"), "BLS009", false},
+
+		{"curl --insecure", script("curl --insecure -fsSLO https://example.com/x"), "BLS010", true},
+		{"wget --no-check-certificate", script("wget --no-check-certificate https://example.com/x"), "BLS010", true},
+		{"curl with verification", script("curl -fsSLO https://example.com/x"), "BLS010", false},
+
+		{"unterminated if", script("if true; then\necho"), "BLS011", true},
+		{"valid script", script("if true; then\necho\nfi"), "BLS011", false},
+
+		{"sudo without elevated", script("sudo apt-get update"), "BLS012", true},
+		{"sudo and elevated", elevated(script("sudo apt-get update")), "BLS012", false},
+
+		{"elevated without sudo", elevated(script("echo hi")), "BLS013", true},
+		{"elevated file task", elevated(file("x")), "BLS013", false},
+
+		{"redirect to /etc under sudo", elevated(script("sudo echo x > /etc/motd")), "BLS014", true},
+		{"tee to /etc under sudo", elevated(script("echo x | sudo tee /etc/motd")), "BLS014", false},
+		{"sed -i on /etc", script("sed -i 's/a/b/' /etc/motd"), "BLS014", true},
+		{"sed reading /etc", script("sed 's/a/b/' /etc/motd > /tmp/motd"), "BLS014", false},
+		{"file task in /etc", presets.Task{Name: "t", Type: "file", Path: "/etc/motd"}, "BLS014", true},
+
+		{"reboot", elevated(script("sudo reboot")), "BLS015", true},
+		{"no reboot", elevated(script("sudo systemctl restart ssh")), "BLS015", false},
+	}
+
+	for _, tt := range tests {
+		ids := ruleIDs(tt.task)
+		got := false
+		for _, id := range ids {
+			got = got || id == tt.rule
+		}
+		if got != tt.want {
+			t.Errorf("%s: %s reported = %v, want %v (findings: %v)", tt.name, tt.rule, got, tt.want, ids)
+		}
+	}
+}
+
+func TestVariableDefaults(t *testing.T) {
+	preset := &presets.Preset{Name: "p", Variables: []presets.Variable{
+		{Name: "dns_servers", Type: "list", Default: []interface{}{"192.168.1.1", "1.1.1.1"}},
+		{Name: "gateway", Type: "ip", Default: "192.168.1.1"},
+	}}
+	findings := Lint(preset)
+	if len(findings) != 1 || findings[0].Rule != "BLS003" || findings[0].Location != "variable dns_servers" {
+		t.Errorf("findings = %v, want BLS003 on variable dns_servers", findings)
+	}
+}
+
+func TestDeprecationWarnings(t *testing.T) {
+	preset := &presets.Preset{Name: "p", Warnings: []string{"old syntax"}}
+	if ids := findingIDs(Lint(preset)); strings.Join(ids, ",") != "BLS000" {
+		t.Errorf("findings = %v, want BLS000", ids)
+	}
+	preset.LintIgnore = []string{"BLS000"}
+	if findings := Lint(preset); len(findings) != 0 {
+		t.Errorf("findings = %v, want none with BLS000 ignored", findings)
+	}
+}
+
+func TestSuppressions(t *testing.T) {
+	tests := []struct {
+		name   string
+		preset *presets.Preset
+		want   string // comma-separated rule IDs
+	}{
+		{
+			name:   "inline comment",
+			preset: &presets.Preset{Tasks: []presets.Task{script("apt-key add key.gpg # lint:ignore BLS001")}},
+			want:   "",
+		},
+		{
+			name:   "comment on the previous line",
+			preset: &presets.Preset{Tasks: []presets.Task{script("# lint:ignore BLS001\napt-key add key.gpg")}},
+			want:   "",
+		},
+		{
+			name:   "comment only covers the next line",
+			preset: &presets.Preset{Tasks: []presets.Task{script("# lint:ignore BLS001\necho\napt-key add key.gpg")}},
+			want:   "BLS001",
+		},
+		{
+			name:   "several IDs, lower case",
+			preset: &presets.Preset{Tasks: []presets.Task{script("curl -k https://x | apt-key add - # lint:ignore bls001, BLS002")}},
+			want:   "BLS010",
+		},
+		{
+			name:   "comment in file content",
+			preset: &presets.Preset{Tasks: []presets.Task{file("nameserver 8.8.8.8 # lint:ignore BLS003\n")}},
+			want:   "",
+		},
+		{
+			name: "task lint_ignore covers nested tasks",
+			preset: &presets.Preset{Tasks: []presets.Task{{
+				Name: "b", Type: "block", LintIgnore: []string{"BLS001"},
+				Block: []presets.Task{script("apt-key add key.gpg")},
+			}}},
+			want: "",
+		},
+		{
+			name:   "preset lint_ignore",
+			preset: &presets.Preset{LintIgnore: []string{"BLS001"}, Tasks: []presets.Task{script("apt-key add key.gpg")}},
+			want:   "",
+		},
+		{
+			name:   "suppressing another rule",
+			preset: &presets.Preset{Tasks: []presets.Task{script("apt-key add key.gpg # lint:ignore BLS005")}},
+			want:   "BLS001",
+		},
+		{
+			name:   "handlers are linted",
+			preset: &presets.Preset{Handlers: []presets.Task{script("apt-key add key.gpg")}},
+			want:   "BLS001",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := strings.Join(findingIDs(Lint(tt.preset)), ","); got != tt.want {
+			t.Errorf("%s: findings = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFailed(t *testing.T) {
+	findings := []Finding{{Rule: "BLS003", Severity: Warning}}
+	if !Failed(findings, Warning) || Failed(findings, Error) || Failed(nil, Info) {
+		t.Error("Failed does not compare severities against the threshold")
+	}
+}
+
+func TestBuiltinPresetsPass(t *testing.T) {
+	// Lint the shipped JSON presets rather than their hardcoded fallbacks
+	presets.SetEmbeddedJSONGetter(func(filename string) ([]byte, error) {
+		return os.ReadFile(filepath.Join("..", "..", "scripts", filename))
+	})
+	t.Cleanup(func() { presets.SetEmbeddedJSONGetter(nil) })
+
+	for _, preset := range presets.GetBuiltinPresets() {
+		if findings := Lint(preset); len(findings) > 0 {
+			t.Errorf("%s: %v", preset.Name, findings)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"base-linux-setup/internal/analysis"
+	"base-linux-setup/internal/presets"
+)
+
+// deprecatedRule reports deprecations found while the preset was loaded
+var deprecatedRule = Rule{
+	ID:       "BLS000",
+	Severity: Warning,
+	Summary:  "deprecated preset syntax; run migrate-preset",
+}
+
+// errexitPattern matches "set -e", "set -euo pipefail" and "set -o errexit"
+var errexitPattern = regexp.MustCompile(`(?m)^\s*set\s+(-[a-zA-Z]*e[a-zA-Z]*\b|.*-o\s+errexit\b)`)
+
+// Rules returns every lint rule, in ID order
+func Rules() []Rule {
+	return []Rule{
+		deprecatedRule,
+		{
+			ID:       "BLS001",
+			Severity: Error,
+			Summary:  "apt-key is deprecated; store the key in /etc/apt/keyrings and reference it with signed-by",
+			Pattern:  regexp.MustCompile(`\bapt-key\b`),
+		},
+		{
+			ID:       "BLS002",
+			Severity: Error,
+			Summary:  "downloaded content is piped straight into a shell or apt-key; download, verify, then use it",
+			Pattern:  regexp.MustCompile(`\b(curl|wget)\b[^|]*\|\s*(sudo\s+(-\S+\s+)*)?((ba|z|da)?sh|apt-key)\b`),
+		},
+		{
+			ID:       "BLS003",
+			Severity: Warning,
+			Summary:  "hardcoded public DNS server; make it a variable or use the network's resolver",
+			Pattern:  regexp.MustCompile(`\b(8\.8\.8\.8|8\.8\.4\.4|1\.1\.1\.1|1\.0\.0\.1|9\.9\.9\.9)\b`),
+		},
+		{
+			ID:       "BLS004",
+			Severity: Warning,
+			Summary:  "script does not use 'set -e', so failing steps are ignored",
+			Check: func(preset *presets.Preset, task presets.Task) []string {
+				if task.Type == "script" && strings.TrimSpace(task.Script) != "" && !errexitPattern.MatchString(task.Script) {
+					return []string{""}
+				}
+				return nil
+			},
+		},
+		{
+			ID:       "BLS005",
+			Severity: Warning,
+			Summary:  "appending to a shell startup file adds a duplicate line on every run; guard it with grep -q",
+			Pattern:  regexp.MustCompile(`(>>|\btee\s+(-\S+\s+)*-a\b[^|]*?)\s*"?(~|\$HOME|\$\{HOME\})/\.(bashrc|zshrc|profile|bash_profile)`),
+			In:       []Source{SourceCommand, SourceScript},
+		},
+		{
+			ID:       "BLS006",
+			Severity: Error,
+			Summary:  "commands run without a shell, so pipes, redirects, quotes and $variables are passed literally; use a script task",
+			Pattern:  regexp.MustCompile("[|<>;`'\"]|&&|\\$[A-Za-z_{(]"),
+			In:       []Source{SourceCommand},
+		},
+		{
+			ID:       "BLS007",
+			Severity: Warning,
+			Summary:  "download or package repository over plain http",
+			Pattern:  regexp.MustCompile(`\bdeb(-src)?\s+(\[[^]]*\]\s+)?http://|\b(curl|wget)\b.*\bhttp://`),
+		},
+		{
+			ID:       "BLS008",
+			Severity: Warning,
+			Summary:  "package operation without -y waits for confirmation",
+			Pattern:  regexp.MustCompile(`\bapt(-get)?\s+(\S+\s+)*(install|upgrade|dist-upgrade|full-upgrade|remove|purge)\b`),
+			Unless:   regexp.MustCompile(`\s(-y|--yes|--assume-yes|-[a-zA-Z]*y[a-zA-Z]*)\b`),
+			In:       []Source{SourceCommand, SourceScript},
+		},
+		{
+			ID:       "BLS009",
+			Severity: Warning,
+			Summary:  "makes files world-writable",
+			Pattern:  regexp.MustCompile(`\bchmod\s+(-R\s+)?(0?777|a\+w|o\+w)\b`),
+			In:       []Source{SourceCommand, SourceScript},
+		},
+		{
+			ID:       "BLS010",
+			Severity: Error,
+			Summary:  "TLS certificate verification is disabled",
+			Pattern:  regexp.MustCompile(`\bcurl\b.*\s(-k|--insecure)\b|\bwget\b.*--no-check-certificate`),
+			In:       []Source{SourceCommand, SourceScript},
+		},
+		{
+			ID:       "BLS011",
+			Severity: Error,
+			Summary:  "script cannot be parsed",
+			Check: func(preset *presets.Preset, task presets.Task) []string {
+				if _, err := analysis.Analyze(task); err != nil {
+					return []string{err.Error()}
+				}
+				return nil
+			},
+		},
+		{
+			ID:       "BLS012",
+			Severity: Warning,
+			Summary:  "calls sudo but the task is not marked elevated",
+			Check: func(preset *presets.Preset, task presets.Task) []string {
+				if req, err := analysis.Analyze(task); err == nil && req.Sudo && !task.Elevated {
+					return []string{""}
+				}
+				return nil
+			},
+		},
+		{
+			ID:       "BLS013",
+			Severity: Info,
+			Summary:  "marked elevated but never calls sudo",
+			Check: func(preset *presets.Preset, task presets.Task) []string {
+				if task.Type != "command" && task.Type != "script" {
+					return nil
+				}
+				if req, err := analysis.Analyze(task); err == nil && !req.Sudo && task.Elevated {
+					return []string{""}
+				}
+				return nil
+			},
+		},
+		{
+			ID:       "BLS014",
+			Severity: Error,
+			Summary:  "writes to a system path without root; use sudo (redirections run as the calling user) or mark the file task elevated",
+			Check: func(preset *presets.Preset, task presets.Task) []string {
+				req, err := analysis.Analyze(task)
+				if err != nil {
+					return nil
+				}
+				details := make([]string, 0)
+				for _, write := range req.Unprivileged() {
+					if write.Line > 0 {
+						details = append(details, fmt.Sprintf("line %d: %s", write.Line, write.Path))
+					} else {
+						details = append(details, write.Path)
+					}
+				}
+				return details
+			},
+		},
+		{
+			ID:       "BLS015",
+			Severity: Warning,
+			Summary:  "reboots the machine mid-run; set reboot_required on the preset instead",
+			Check: func(preset *presets.Preset, task presets.Task) []string {
+				if req, err := analysis.Analyze(task); err == nil && req.Reboot {
+					if preset.RebootRequired {
+						return []string{"the preset already declares reboot_required"}
+					}
+					return []string{""}
+				}
+				return nil
+			},
+		},
+	}
+}
@@ -0,0 +1,45 @@
+package presets
+
+import "fmt"
+
+// FailedTaskVariable is the name under which rescue tasks see the failure that
+// triggered them, as a map with "name" and "error" keys
+const FailedTaskVariable = "failed_task"
+
+// IsBlock reports whether the task groups other tasks
+func (t Task) IsBlock() bool {
+	return t.Type == "block"
+}
+
+// validateBlock checks a block task and, recursively, the tasks it contains
+func (p *Preset) validateBlock(task Task) error {
+	if !task.IsBlock() {
+		if len(task.Block) > 0 || len(task.Rescue) > 0 || len(task.Always) > 0 {
+			return fmt.Errorf("task %q uses block, rescue or always but is not a block task", task.Name)
+		}
+		return nil
+	}
+
+	if len(task.Block) == 0 {
+		return fmt.Errorf("block task %q has no tasks", task.Name)
+	}
+	if !task.Loop.IsEmpty() || task.Register != "" || len(task.Notify) > 0 || task.ChangedWhen != "" {
+		return fmt.Errorf("block task %q cannot use loop, register, notify or changed_when; set them on its tasks", task.Name)
+	}
+
+	sections := map[string][]Task{"block": task.Block, "rescue": task.Rescue, "always": task.Always}
+	for _, section := range []string{"block", "rescue", "always"} {
+		for _, nested := range sections[section] {
+			if len(nested.DependsOn) > 0 {
+				return fmt.Errorf("task %q in the %s of %q cannot use depends_on", nested.Name, section, task.Name)
+			}
+			if nested.Type == "flush_handlers" {
+				return fmt.Errorf("task %q in the %s of %q cannot flush handlers", nested.Name, section, task.Name)
+			}
+			if err := p.validateTask(nested); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package presets
+
+import (
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// serviceStates maps a service task's state to the systemctl action reaching it
+var serviceStates = map[string]string{
+	"started":   "start",
+	"stopped":   "stop",
+	"restarted": "restart",
+	"reloaded":  "reload",
+}
+
+// legacyServiceActions maps positional service actions to the named fields replacing them
+var legacyServiceActions = map[string]func() (state string, enabled *bool){
+	"start":   func() (string, *bool) { return "started", nil },
+	"stop":    func() (string, *bool) { return "stopped", nil },
+	"restart": func() (string, *bool) { return "restarted", nil },
+	"reload":  func() (string, *bool) { return "reloaded", nil },
+	"enable":  func() (string, *bool) { enabled := true; return "", &enabled },
+	"disable": func() (string, *bool) { enabled := false; return "", &enabled },
+}
+
+// FileSpec returns the path, mode and content of a file task. The deprecated
+// positional form (Commands[0] path, Commands[1] mode, Script content) is used
+// when Path is not set.
+func (t Task) FileSpec() (path, mode, content string) {
+	if t.Path != "" || len(t.Commands) == 0 {
+		return t.Path, t.Mode, t.Content
+	}
+
+	path, content = t.Commands[0], t.Script
+	if len(t.Commands) > 1 {
+		mode = t.Commands[1]
+	}
+	return path, mode, content
+}
+
+// ServiceSpec returns the unit name of a service task and the systemctl actions to
+// run, enabling or disabling before changing state. The deprecated positional form
+// (Commands[0] unit, Commands[1] action) is used when Service is not set.
+func (t Task) ServiceSpec() (name string, actions []string) {
+	if t.Service == "" && len(t.Commands) >= 2 {
+		return t.Commands[0], []string{t.Commands[1]}
+	}
+
+	if t.Enabled != nil {
+		if *t.Enabled {
+			actions = append(actions, "enable")
+		} else {
+			actions = append(actions, "disable")
+		}
+	}
+	if action, ok := serviceStates[t.State]; ok {
+		actions = append(actions, action)
+	}
+	return t.Service, actions
+}
+
+// usesPositionalFields reports whether a file or service task uses the deprecated
+// positional form
+func (t Task) usesPositionalFields() bool {
+	switch t.Type {
+	case "file":
+		return t.Path == "" && len(t.Commands) > 0
+	case "service":
+		return t.Service == "" && len(t.Commands) > 0
+	}
+	return false
+}
+
+// validateTypedFields checks the named fields of file and service tasks and that
+// they are not set on other task types
+func validateTypedFields(task Task) error {
+	fileField := task.Path != "" || task.Mode != "" || task.Owner != "" || task.Group != "" || task.Content != ""
+	serviceField := task.Service != "" || task.State != "" || task.Enabled != nil
+
+	switch task.Type {
+	case "file":
+		if serviceField {
+			return fmt.Errorf("file task %q cannot use service, state or enabled", task.Name)
+		}
+		path, mode, _ := task.FileSpec()
+		if path == "" {
+			return fmt.Errorf("file task %q requires a path", task.Name)
+		}
+		if mode != "" {
+			if _, err := strconv.ParseUint(mode, 8, 32); err != nil {
+				return fmt.Errorf("file task %q has an invalid mode %q: expected octal permissions such as \"0644\"", task.Name, mode)
+			}
+		}
+	case "service":
+		if fileField {
+			return fmt.Errorf("service task %q cannot use path, mode, owner, group or content", task.Name)
+		}
+		if task.State != "" {
+			if _, ok := serviceStates[task.State]; !ok {
+				return fmt.Errorf("service task %q has an invalid state %q: expected started, stopped, restarted or reloaded", task.Name, task.State)
+			}
+		}
+		name, actions := task.ServiceSpec()
+		if name == "" || len(actions) == 0 {
+			return fmt.Errorf("service task %q requires a service and a state or enabled", task.Name)
+		}
+	default:
+		if fileField || serviceField {
+			return fmt.Errorf("task %q uses file or service fields but has type %q", task.Name, task.Type)
+		}
+	}
+	return nil
+}
+
+// legacyFieldWarnings returns a deprecation warning for each task, handler or
+// nested task still using positional file or service fields
+func (p *Preset) legacyFieldWarnings() []string {
+	warnings := make([]string, 0)
+	var visit func(tasks []Task)
+	visit = func(tasks []Task) {
+		for _, task := range tasks {
+			if task.usesPositionalFields() {
+				warnings = append(warnings, fmt.Sprintf("task %q passes %s settings in commands, which is deprecated; use named fields instead", task.Name, task.Type))
+			}
+			visit(task.Block)
+			visit(task.Rescue)
+			visit(task.Always)
+		}
+	}
+	visit(p.Tasks)
+	visit(p.Handlers)
+	return warnings
+}
+
+// migrateNamedFields upgrades schema 1 documents, which configure file and service
+// tasks through positional commands, to the named fields of schema 2
+func migrateNamedFields(doc *yaml.Node) error {
+	var visit func(tasks *yaml.Node) error
+	visit = func(tasks *yaml.Node) error {
+		if tasks == nil || tasks.Kind != yaml.SequenceNode {
+			return nil
+		}
+		for _, task := range tasks.Content {
+			if err := migrateTaskFields(task); err != nil {
+				return err
+			}
+			for _, section := range []string{"block", "rescue", "always"} {
+				if err := visit(mappingValue(task, section)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := visit(mappingValue(doc, "tasks")); err != nil {
+		return err
+	}
+	return visit(mappingValue(doc, "handlers"))
+}
+
+// migrateTaskFields rewrites one file or service task to named fields in place
+func migrateTaskFields(task *yaml.Node) error {
+	taskType := mappingValue(task, "type")
+	commands := mappingValue(task, "commands")
+	if taskType == nil || commands == nil || commands.Kind != yaml.SequenceNode || len(commands.Content) == 0 {
+		return nil
+	}
+
+	var entries []*yaml.Node
+	switch taskType.Value {
+	case "file":
+		entries = append(entries, entry("path", "!!str", commands.Content[0].Value)...)
+		if len(commands.Content) > 1 {
+			entries = append(entries, entry("mode", "!!str", commands.Content[1].Value)...)
+		}
+		renameKey(task, "script", "content")
+	case "service":
+		if len(commands.Content) < 2 {
+			return nil
+		}
+		toFields, ok := legacyServiceActions[commands.Content[1].Value]
+		if !ok {
+			// Actions without a named equivalent, such as status, stay positional
+			return nil
+		}
+		entries = append(entries, entry("service", "!!str", commands.Content[0].Value)...)
+		state, enabled := toFields()
+		if state != "" {
+			entries = append(entries, entry("state", "!!str", state)...)
+		}
+		if enabled != nil {
+			entries = append(entries, entry("enabled", "!!bool", strconv.FormatBool(*enabled))...)
+		}
+	default:
+		return nil
+	}
+
+	replaceKey(task, "commands", entries)
+	return nil
+}
+
+// entry returns the key and value nodes of a scalar mapping entry
+func entry(key, tag, value string) []*yaml.Node {
+	return []*yaml.Node{
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		{Kind: yaml.ScalarNode, Tag: tag, Value: value},
+	}
+}
@@ -0,0 +1,102 @@
+package presets
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrateNamedFields(t *testing.T) {
+	tests := []struct {
+		name string
+		task string
+		want string
+	}{
+		{
+			name: "file with mode",
+			task: `{"name": "f", "type": "file", "commands": ["/etc/motd", "0644"], "script": "hi"}`,
+			want: `{"name": "f", "type": "file", "path": "/etc/motd", "mode": "0644", "content": "hi"}`,
+		},
+		{
+			name: "file without mode",
+			task: `{"name": "f", "type": "file", "commands": ["/etc/motd"], "script": "hi"}`,
+			want: `{"name": "f", "type": "file", "path": "/etc/motd", "content": "hi"}`,
+		},
+		{
+			name: "service start",
+			task: `{"name": "s", "type": "service", "commands": ["ssh", "start"]}`,
+			want: `{"name": "s", "type": "service", "service": "ssh", "state": "started"}`,
+		},
+		{
+			name: "service enable",
+			task: `{"name": "s", "type": "service", "commands": ["ssh", "enable"]}`,
+			want: `{"name": "s", "type": "service", "service": "ssh", "enabled": true}`,
+		},
+		{
+			name: "service disable",
+			task: `{"name": "s", "type": "service", "commands": ["ssh", "disable"]}`,
+			want: `{"name": "s", "type": "service", "service": "ssh", "enabled": false}`,
+		},
+		{
+			name: "service status stays positional",
+			task: `{"name": "s", "type": "service", "commands": ["ssh", "status"]}`,
+			want: `{"name": "s", "type": "service", "commands": ["ssh", "status"]}`,
+		},
+		{
+			name: "commands are untouched",
+			task: `{"name": "c", "type": "command", "commands": ["true"]}`,
+			want: `{"name": "c", "type": "command", "commands": ["true"]}`,
+		},
+		{
+			name: "nested block tasks are migrated",
+			task: `{"name": "b", "type": "block", "block": [{"name": "s", "type": "service", "commands": ["ssh", "restart"]}]}`,
+			want: `{"name": "b", "type": "block", "block": [{"name": "s", "type": "service", "service": "ssh", "state": "restarted"}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		got := migrateTasks(t, `{"tasks": [`+tt.task+`]}`)
+		want := migrateTasks(t, `{"schema_version": 3, "tasks": [`+tt.want+`]}`)
+		if got != want {
+			t.Errorf("%s: migrated to\n%s\nwant\n%s", tt.name, got, want)
+		}
+	}
+}
+
+func TestMigrateNamedFieldsInHandlers(t *testing.T) {
+	got := migrateTasks(t, `{"handlers": [{"name": "h", "type": "service", "commands": ["nginx", "reload"]}]}`)
+	if !strings.Contains(got, `"state": "reloaded"`) || strings.Contains(got, `"commands"`) {
+		t.Errorf("handler was not migrated:\n%s", got)
+	}
+}
+
+func TestLegacyFieldsStillDecode(t *testing.T) {
+	preset, err := DecodePreset([]byte(`{"schema_version": 3, "name": "x", "tasks": [
+		{"name": "f", "type": "file", "commands": ["/etc/motd", "0600"], "script": "hi"},
+		{"name": "s", "type": "service", "commands": ["ssh", "enable"]}
+	]}`))
+	if err != nil {
+		t.Fatalf("DecodePreset: %v", err)
+	}
+
+	path, mode, content := preset.Tasks[0].FileSpec()
+	if path != "/etc/motd" || mode != "0600" || content != "hi" {
+		t.Errorf("FileSpec() = %q, %q, %q", path, mode, content)
+	}
+	service, actions := preset.Tasks[1].ServiceSpec()
+	if service != "ssh" || strings.Join(actions, ",") != "enable" {
+		t.Errorf("ServiceSpec() = %q, %v", service, actions)
+	}
+	if len(preset.Warnings) == 0 {
+		t.Error("expected a warning about the deprecated positional fields")
+	}
+}
+
+// migrateTasks migrates a JSON preset document and returns it as JSON
+func migrateTasks(t *testing.T, input string) string {
+	t.Helper()
+	out, _, err := MigratePreset([]byte(input), FormatJSON)
+	if err != nil {
+		t.Fatalf("MigratePreset(%s): %v", input, err)
+	}
+	return string(out)
+}
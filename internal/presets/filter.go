@@ -0,0 +1,119 @@
+package presets
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TaskFilter selects a subset of a preset's tasks by tag or name
+type TaskFilter struct {
+	Tags     []string // run only tasks with at least one of these tags
+	SkipTags []string // never run tasks with any of these tags
+	Only     []string // run only these tasks, by ID or name
+}
+
+// IsEmpty reports whether the filter selects every task
+func (f TaskFilter) IsEmpty() bool {
+	return len(f.Tags) == 0 && len(f.SkipTags) == 0 && len(f.Only) == 0
+}
+
+// HasTag reports whether the task carries any of the given tags
+func (t Task) HasTag(tags ...string) bool {
+	for _, tag := range tags {
+		for _, own := range t.Tags {
+			if strings.EqualFold(own, tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchesRef reports whether ref names the task by ID or (case-insensitive) name
+func (t Task) matchesRef(ref string) bool {
+	return (t.ID != "" && t.ID == ref) || strings.EqualFold(t.Name, ref)
+}
+
+// Filter returns a copy of the preset containing only the tasks selected by the filter,
+// together with warnings describing adjustments made for dependencies.
+//
+// Tasks selected with Tags or Only pull in the tasks they depend on. Tasks excluded with
+// SkipTags are removed along with every task that depends on them, directly or not,
+// and a warning is returned for each dependent removed that way.
+func (p *Preset) Filter(f TaskFilter) (*Preset, []string, error) {
+	if f.IsEmpty() {
+		return p, nil, nil
+	}
+
+	warnings := make([]string, 0)
+	selected := make([]bool, len(p.Tasks))
+
+	for _, ref := range f.Only {
+		found := false
+		for i, task := range p.Tasks {
+			if task.matchesRef(ref) {
+				selected[i] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, nil, fmt.Errorf("no task named %q in preset %s", ref, p.Name)
+		}
+	}
+
+	for i, task := range p.Tasks {
+		if len(f.Only) == 0 && len(f.Tags) == 0 {
+			selected[i] = true
+		} else if len(f.Tags) > 0 && task.HasTag(f.Tags...) {
+			selected[i] = true
+		}
+	}
+
+	// Pull in dependencies of selected tasks until nothing changes
+	index := make(map[string]int)
+	for i, task := range p.Tasks {
+		if task.ID != "" {
+			index[task.ID] = i
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for i, task := range p.Tasks {
+			if !selected[i] {
+				continue
+			}
+			for _, dep := range task.DependsOn {
+				if j, ok := index[dep]; ok && !selected[j] {
+					selected[j] = true
+					changed = true
+					warnings = append(warnings, fmt.Sprintf("including '%s' (required by '%s')", p.Tasks[j].Name, task.Name))
+				}
+			}
+		}
+	}
+
+	// Skipped tasks take their transitive dependents with them, as a task cannot run
+	// without the tasks it depends on
+	for i, task := range p.Tasks {
+		if !selected[i] || !task.HasTag(f.SkipTags...) {
+			continue
+		}
+		selected[i] = false
+		for _, dependent := range Dependents(p.Tasks, task.ID) {
+			if j := index[dependent.ID]; selected[j] {
+				selected[j] = false
+				warnings = append(warnings, fmt.Sprintf("skipping '%s' (depends on skipped task '%s')", dependent.Name, task.Name))
+			}
+		}
+	}
+
+	filtered := *p
+	filtered.Tasks = make([]Task, 0, len(p.Tasks))
+	for i, task := range p.Tasks {
+		if selected[i] {
+			filtered.Tasks = append(filtered.Tasks, task)
+		}
+	}
+
+	return &filtered, warnings, nil
+}
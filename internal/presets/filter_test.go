@@ -0,0 +1,78 @@
+package presets
+
+import (
+	"strings"
+	"testing"
+)
+
+// tagged returns a task carrying tags
+func tagged(t Task, tags ...string) Task {
+	t.Tags = tags
+	return t
+}
+
+func TestFilter(t *testing.T) {
+	preset := &Preset{Name: "p", Tasks: []Task{
+		tagged(task("update"), "system"),
+		tagged(task("tools", "update"), "packages"),
+		tagged(task("golang", "tools"), "dev", "slow"),
+		tagged(task("vscode", "golang"), "dev"),
+		tagged(task("hostname"), "system"),
+	}}
+
+	tests := []struct {
+		name     string
+		filter   TaskFilter
+		want     string
+		warnings int
+	}{
+		{"empty filter", TaskFilter{}, "update,tools,golang,vscode,hostname", 0},
+		{"tags pull in dependencies", TaskFilter{Tags: []string{"dev"}}, "update,tools,golang,vscode", 2},
+		{"only by id", TaskFilter{Only: []string{"hostname"}}, "hostname", 0},
+		{"only by name ignores case", TaskFilter{Only: []string{"HOSTNAME"}}, "hostname", 0},
+		{"skip tags apply to selected tasks", TaskFilter{SkipTags: []string{"system"}, Only: []string{"hostname", "update"}}, "", 0},
+		{"skipping cascades to dependents", TaskFilter{SkipTags: []string{"slow"}}, "update,tools,hostname", 1},
+		{"skipping a dependency cascades transitively", TaskFilter{SkipTags: []string{"packages"}}, "update,hostname", 2},
+		{"skip wins over tags", TaskFilter{Tags: []string{"dev"}, SkipTags: []string{"system"}}, "", 5},
+	}
+
+	for _, tt := range tests {
+		filtered, warnings, err := preset.Filter(tt.filter)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if got := taskIDs(filtered.Tasks); got != tt.want {
+			t.Errorf("%s: tasks = %s, want %s", tt.name, got, tt.want)
+		}
+		if len(warnings) != tt.warnings {
+			t.Errorf("%s: warnings = %q, want %d", tt.name, warnings, tt.warnings)
+		}
+	}
+}
+
+func TestFilterReportsSkippedDependents(t *testing.T) {
+	preset := &Preset{Name: "p", Tasks: []Task{
+		tagged(task("update"), "slow"),
+		task("tools", "update"),
+		task("golang", "tools"),
+	}}
+
+	filtered, warnings, err := preset.Filter(TaskFilter{SkipTags: []string{"slow"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filtered.Tasks) != 0 {
+		t.Errorf("tasks = %s, want none", taskIDs(filtered.Tasks))
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "'tools'") || !strings.Contains(warnings[1], "'golang'") {
+		t.Errorf("warnings = %q, want one per removed dependent", warnings)
+	}
+}
+
+func TestFilterUnknownTask(t *testing.T) {
+	preset := &Preset{Name: "p", Tasks: []Task{task("update")}}
+	if _, _, err := preset.Filter(TaskFilter{Only: []string{"missing"}}); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("error = %v, want it to name the missing task", err)
+	}
+}
@@ -0,0 +1,139 @@
+package presets
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// taskIDPattern restricts task IDs to simple slugs
+var taskIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// validateDependencies checks task IDs and depends_on references and rejects cycles
+func validateDependencies(tasks []Task) error {
+	ids := make(map[string]bool)
+	for _, task := range tasks {
+		if task.ID == "" {
+			if len(task.DependsOn) > 0 {
+				return fmt.Errorf("task %q declares depends_on but has no id", task.Name)
+			}
+			continue
+		}
+		if !taskIDPattern.MatchString(task.ID) {
+			return fmt.Errorf("task %q has an invalid id %q", task.Name, task.ID)
+		}
+		if ids[task.ID] {
+			return fmt.Errorf("duplicate task id %q", task.ID)
+		}
+		ids[task.ID] = true
+	}
+
+	for _, task := range tasks {
+		for _, dep := range task.DependsOn {
+			if dep == task.ID {
+				return fmt.Errorf("task %q depends on itself", task.ID)
+			}
+			if !ids[dep] {
+				return fmt.Errorf("task %q depends on unknown task %q", task.ID, dep)
+			}
+		}
+	}
+
+	if _, err := OrderTasks(tasks); err != nil {
+		return err
+	}
+	return nil
+}
+
+// OrderTasks returns the tasks in dependency order. Tasks keep their original
+// relative order unless a dependency forces one to move later. Dependencies on
+// tasks that are not in the list are ignored so filtered task lists can be ordered.
+func OrderTasks(tasks []Task) ([]Task, error) {
+	index := make(map[string]int)
+	for i, task := range tasks {
+		if task.ID != "" {
+			index[task.ID] = i
+		}
+	}
+
+	// Count unmet dependencies and record reverse edges
+	pending := make([]int, len(tasks))
+	dependents := make([][]int, len(tasks))
+	for i, task := range tasks {
+		for _, dep := range task.DependsOn {
+			if j, ok := index[dep]; ok {
+				pending[i]++
+				dependents[j] = append(dependents[j], i)
+			}
+		}
+	}
+
+	ordered := make([]Task, 0, len(tasks))
+	done := make([]bool, len(tasks))
+	for len(ordered) < len(tasks) {
+		// Pick the first task in original order whose dependencies are all done
+		next := -1
+		for i := range tasks {
+			if !done[i] && pending[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next == -1 {
+			return nil, fmt.Errorf("dependency cycle detected; tasks that cannot be ordered: %s", strings.Join(cycleMembers(tasks, done), ", "))
+		}
+
+		done[next] = true
+		ordered = append(ordered, tasks[next])
+		for _, dependent := range dependents[next] {
+			pending[dependent]--
+		}
+	}
+
+	return ordered, nil
+}
+
+// cycleMembers names the tasks left unscheduled when a cycle is detected
+func cycleMembers(tasks []Task, done []bool) []string {
+	names := make([]string, 0)
+	for i, task := range tasks {
+		if !done[i] {
+			names = append(names, task.ID)
+		}
+	}
+	return names
+}
+
+// Dependents returns the tasks that depend on the task with the given ID,
+// directly or transitively, in their original order
+func Dependents(tasks []Task, id string) []Task {
+	if id == "" {
+		return nil
+	}
+
+	// Repeat until no new dependents are found so transitive chains are covered
+	affected := map[string]bool{id: true}
+	for changed := true; changed; {
+		changed = false
+		for _, task := range tasks {
+			if task.ID == "" || affected[task.ID] {
+				continue
+			}
+			for _, dep := range task.DependsOn {
+				if affected[dep] {
+					affected[task.ID] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	result := make([]Task, 0)
+	for _, task := range tasks {
+		if task.ID != "" && task.ID != id && affected[task.ID] {
+			result = append(result, task)
+		}
+	}
+	return result
+}
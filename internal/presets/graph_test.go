@@ -0,0 +1,92 @@
+package presets
+
+import (
+	"strings"
+	"testing"
+)
+
+// task builds a task for graph tests; the name doubles as the id
+func task(id string, deps ...string) Task {
+	return Task{ID: id, Name: id, Type: "command", DependsOn: deps}
+}
+
+func taskIDs(tasks []Task) string {
+	ids := make([]string, 0, len(tasks))
+	for _, t := range tasks {
+		ids = append(ids, t.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestOrderTasks(t *testing.T) {
+	tests := []struct {
+		name  string
+		tasks []Task
+		want  string
+	}{
+		{"no dependencies keep their order", []Task{task("a"), task("b"), task("c")}, "a,b,c"},
+		{"dependency moves a task later", []Task{task("a", "b"), task("b"), task("c")}, "b,a,c"},
+		{"chain", []Task{task("c", "b"), task("b", "a"), task("a")}, "a,b,c"},
+		{"diamond", []Task{task("d", "b", "c"), task("c", "a"), task("b", "a"), task("a")}, "a,c,b,d"},
+		{"unknown dependency is ignored", []Task{task("a", "missing"), task("b")}, "a,b"},
+		{"tasks without ids stay in place", []Task{{Name: "x"}, task("a", "b"), task("b")}, ",b,a"},
+	}
+
+	for _, tt := range tests {
+		ordered, err := OrderTasks(tt.tasks)
+		if err != nil {
+			t.Errorf("%s: OrderTasks returned error: %v", tt.name, err)
+			continue
+		}
+		if got := taskIDs(ordered); got != tt.want {
+			t.Errorf("%s: OrderTasks = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOrderTasksCycle(t *testing.T) {
+	_, err := OrderTasks([]Task{task("a", "c"), task("b", "a"), task("c", "b"), task("d")})
+	if err == nil {
+		t.Fatal("OrderTasks succeeded on a cycle")
+	}
+	if !strings.HasSuffix(err.Error(), ": a, b, c") {
+		t.Errorf("cycle error = %q, want it to name a, b and c only", err)
+	}
+}
+
+func TestValidateDependencies(t *testing.T) {
+	tests := []struct {
+		name  string
+		tasks []Task
+		want  string
+	}{
+		{"valid", []Task{task("a"), task("b", "a")}, ""},
+		{"depends_on without id", []Task{task("a"), {Name: "x", DependsOn: []string{"a"}}}, "has no id"},
+		{"invalid id", []Task{task("-a")}, "invalid id"},
+		{"duplicate id", []Task{task("a"), task("a")}, "duplicate task id"},
+		{"self dependency", []Task{task("a", "a")}, "depends on itself"},
+		{"unknown dependency", []Task{task("a", "b")}, "unknown task"},
+		{"cycle", []Task{task("a", "b"), task("b", "a")}, "cycle"},
+	}
+
+	for _, tt := range tests {
+		err := validateDependencies(tt.tasks)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%s: error = %v, want it to contain %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestDependents(t *testing.T) {
+	tasks := []Task{task("a"), task("b", "a"), task("c", "b"), task("d"), task("e", "d", "c")}
+
+	if got := taskIDs(Dependents(tasks, "a")); got != "b,c,e" {
+		t.Errorf("Dependents(a) = %s, want b,c,e", got)
+	}
+	if got := taskIDs(Dependents(tasks, "e")); got != "" {
+		t.Errorf("Dependents(e) = %s, want none", got)
+	}
+}
@@ -0,0 +1,46 @@
+package presets
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FindHandler returns the handler referenced by ID or (case-insensitive) name
+func (p *Preset) FindHandler(ref string) (Task, bool) {
+	for _, handler := range p.Handlers {
+		if handler.matchesRef(ref) {
+			return handler, true
+		}
+	}
+	return Task{}, false
+}
+
+// validateHandlers checks that handler names are unique and that handlers only use
+// fields that make sense outside the task graph
+func (p *Preset) validateHandlers() error {
+	seen := make(map[string]bool)
+	for _, handler := range p.Handlers {
+		if handler.Name == "" {
+			return fmt.Errorf("handlers must have a name")
+		}
+		key := strings.ToLower(handler.Name)
+		if seen[key] {
+			return fmt.Errorf("duplicate handler name %q", handler.Name)
+		}
+		seen[key] = true
+
+		if len(handler.DependsOn) > 0 {
+			return fmt.Errorf("handler %q cannot use depends_on", handler.Name)
+		}
+		if len(handler.Notify) > 0 {
+			return fmt.Errorf("handler %q cannot notify other handlers", handler.Name)
+		}
+		if handler.Type == "flush_handlers" {
+			return fmt.Errorf("handler %q cannot flush handlers", handler.Name)
+		}
+		if err := p.validateTask(handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
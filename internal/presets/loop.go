@@ -0,0 +1,84 @@
+package presets
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"base-linux-setup/internal/expr"
+)
+
+// Loop lists the items a task is repeated for. In JSON it is either an array of
+// items (each may contain templates) or a string naming a list variable or fact:
+//
+//	"loop": ["git", "curl", "{{ .editor }}"]
+//	"loop": "interfaces"
+type Loop struct {
+	Items []string
+	From  string // expression evaluating to a list, used when Items is empty
+}
+
+// IsEmpty reports whether the loop has no items; a nil loop is empty
+func (l *Loop) IsEmpty() bool {
+	return l == nil || (len(l.Items) == 0 && l.From == "")
+}
+
+// UnmarshalJSON accepts either an item array or a list expression string
+func (l *Loop) UnmarshalJSON(data []byte) error {
+	var from string
+	if err := json.Unmarshal(data, &from); err == nil {
+		*l = Loop{From: from}
+		return nil
+	}
+
+	var items []string
+	if err := json.Unmarshal(data, &items); err != nil {
+		return fmt.Errorf("loop must be a list of items or the name of a list variable")
+	}
+	*l = Loop{Items: items}
+	return nil
+}
+
+// MarshalJSON writes the loop back in the form it was declared
+func (l Loop) MarshalJSON() ([]byte, error) {
+	if l.From != "" {
+		return json.Marshal(l.From)
+	}
+	return json.Marshal(l.Items)
+}
+
+// Resolve returns the loop items rendered against the given scope
+func (l Loop) Resolve(scope map[string]interface{}) ([]string, error) {
+	if l.From != "" {
+		expression, err := expr.Parse(l.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := expression.Eval(scope)
+		if err != nil {
+			return nil, err
+		}
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("loop source %q is not a list", l.From)
+		}
+		return toStrings(items), nil
+	}
+
+	items := make([]string, 0, len(l.Items))
+	for _, item := range l.Items {
+		rendered, err := RenderString(item, scope)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, rendered)
+	}
+	return items, nil
+}
+
+// LoopVariable returns the name under which the current item is exposed to templates
+func (t Task) LoopVariable() string {
+	if t.LoopVar != "" {
+		return t.LoopVar
+	}
+	return "item"
+}
@@ -0,0 +1,136 @@
+package presets
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// toolVersion is the version of the running binary, checked against MinToolVersion
+var toolVersion = "dev"
+
+// SetToolVersion sets the version of the running binary
+func SetToolVersion(version string) {
+	toolVersion = version
+}
+
+// ToolVersion returns the version of the running binary
+func ToolVersion() string {
+	return toolVersion
+}
+
+// versionPattern matches the versions presets may declare, e.g. "1.2" or "v1.2.3"
+var versionPattern = regexp.MustCompile(`^v?\d+(\.\d+){0,2}$`)
+
+// releasePattern extracts the release from a binary version such as "v1.2.0-3-gabc123"
+var releasePattern = regexp.MustCompile(`^v?\d+(\.\d+){0,2}`)
+
+// archAliases maps the names different tools report for an architecture to one name
+var archAliases = map[string]string{
+	"x86_64":  "amd64",
+	"x86-64":  "amd64",
+	"aarch64": "arm64",
+	"armv7l":  "armhf",
+	"armv7":   "armhf",
+	"armv6l":  "armel",
+	"i686":    "i386",
+	"i386":    "i386",
+}
+
+// normalizeArch returns the canonical name of an architecture
+func normalizeArch(arch string) string {
+	arch = strings.ToLower(strings.TrimSpace(arch))
+	if alias, ok := archAliases[arch]; ok {
+		return alias
+	}
+	return arch
+}
+
+// validateMetadata checks the preset's descriptive and compatibility fields
+func (p *Preset) validateMetadata() error {
+	if p.Version != "" && !versionPattern.MatchString(p.Version) {
+		return fmt.Errorf("invalid version %q: expected MAJOR[.MINOR[.PATCH]]", p.Version)
+	}
+	if p.MinToolVersion != "" && !versionPattern.MatchString(p.MinToolVersion) {
+		return fmt.Errorf("invalid min_tool_version %q: expected MAJOR[.MINOR[.PATCH]]", p.MinToolVersion)
+	}
+	if p.Homepage != "" {
+		parsed, err := url.Parse(p.Homepage)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("invalid homepage %q: expected an http(s) URL", p.Homepage)
+		}
+	}
+	for _, author := range p.Authors {
+		if strings.TrimSpace(author) == "" {
+			return fmt.Errorf("authors must not be empty")
+		}
+	}
+	for _, arch := range p.Architectures {
+		if strings.TrimSpace(arch) == "" {
+			return fmt.Errorf("architectures must not be empty")
+		}
+	}
+	if p.EstimatedDuration != "" {
+		if duration, err := time.ParseDuration(p.EstimatedDuration); err != nil || duration <= 0 {
+			return fmt.Errorf("invalid estimated_duration %q: expected a duration such as 30m or 1h30m", p.EstimatedDuration)
+		}
+	}
+	return nil
+}
+
+// CheckCompatibility reports why the preset cannot run with this binary on the
+// given architecture, or nil when it can
+func (p *Preset) CheckCompatibility(arch string) error {
+	// Development builds have no release number and are assumed to be current
+	release := releasePattern.FindString(toolVersion)
+	if p.MinToolVersion != "" && release != "" && compareVersions(release, p.MinToolVersion) < 0 {
+		return fmt.Errorf("preset %s requires base-linux-setup %s or newer (this is %s)", p.Name, p.MinToolVersion, toolVersion)
+	}
+
+	if len(p.Architectures) > 0 && arch != "" && !p.SupportsArch(arch) {
+		return fmt.Errorf("preset %s supports %s, not %s", p.Name, strings.Join(p.Architectures, ", "), arch)
+	}
+	return nil
+}
+
+// SupportsArch reports whether the preset declares support for an architecture;
+// presets without an architecture list support all of them
+func (p *Preset) SupportsArch(arch string) bool {
+	if len(p.Architectures) == 0 {
+		return true
+	}
+	for _, supported := range p.Architectures {
+		if normalizeArch(supported) == normalizeArch(arch) {
+			return true
+		}
+	}
+	return false
+}
+
+// compareVersions compares two dotted versions numerically, returning -1, 0 or 1.
+// Missing components count as zero, so "1.2" equals "1.2.0".
+func compareVersions(a, b string) int {
+	left := versionParts(a)
+	right := versionParts(b)
+	for i := 0; i < 3; i++ {
+		if left[i] < right[i] {
+			return -1
+		}
+		if left[i] > right[i] {
+			return 1
+		}
+	}
+	return 0
+}
+
+// versionParts splits a version into major, minor and patch numbers
+func versionParts(version string) [3]int {
+	var parts [3]int
+	for i, field := range strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3) {
+		parts[i], _ = strconv.Atoi(field)
+	}
+	return parts
+}
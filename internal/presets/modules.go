@@ -0,0 +1,301 @@
+package presets
+
+import (
+	"fmt"
+	"strings"
+
+	"base-linux-setup/internal/detector"
+)
+
+// Package families that add-on modules provide implementations for
+const (
+	FamilyDebian = "debian" // apt: Debian, Ubuntu, Kali, Raspberry Pi OS
+	FamilyArch   = "arch"   // pacman
+)
+
+// Module is an add-on feature, such as Docker or a language toolchain, that can be
+// merged into any OS preset whose package family it supports
+type Module struct {
+	ID              string
+	Name            string
+	Description     string
+	Implementations map[string][]Task // tasks per package family
+}
+
+// Family returns the package family of an environment, or "" when unknown
+func Family(env *detector.Environment) string {
+	switch {
+	case isDebianBased(env) || strings.Contains(strings.ToLower(env.Distribution), "raspbian"):
+		return FamilyDebian
+	case isArch(env):
+		return FamilyArch
+	default:
+		return ""
+	}
+}
+
+// Supports reports whether the module has an implementation for a package family
+func (m Module) Supports(family string) bool {
+	_, ok := m.Implementations[family]
+	return ok
+}
+
+// GetAllModules returns the catalog of add-on modules
+func GetAllModules() []Module {
+	return []Module{
+		getDockerModule(),
+		getNodeModule(),
+		getGoModule(),
+		getPythonModule(),
+	}
+}
+
+// ModulesFor returns the modules with an implementation for a package family
+func ModulesFor(family string) []Module {
+	modules := make([]Module, 0)
+	for _, module := range GetAllModules() {
+		if module.Supports(family) {
+			modules = append(modules, module)
+		}
+	}
+	return modules
+}
+
+// FindModules looks modules up by ID, failing on unknown IDs
+func FindModules(ids []string) ([]Module, error) {
+	catalog := GetAllModules()
+	modules := make([]Module, 0, len(ids))
+	for _, id := range ids {
+		found := false
+		for _, module := range catalog {
+			if strings.EqualFold(module.ID, id) {
+				modules = append(modules, module)
+				found = true
+				break
+			}
+		}
+		if !found {
+			available := make([]string, 0, len(catalog))
+			for _, module := range catalog {
+				available = append(available, module.ID)
+			}
+			return nil, fmt.Errorf("unknown module %q (available: %s)", id, strings.Join(available, ", "))
+		}
+	}
+	return modules, nil
+}
+
+// WithModules returns a copy of the preset with the tasks of each module appended,
+// using the implementation for the given package family. Module tasks are tagged
+// with "addon" and the module ID so they can be filtered like any other task.
+func (p *Preset) WithModules(modules []Module, family string) (*Preset, error) {
+	if len(modules) == 0 {
+		return p, nil
+	}
+
+	merged := *p
+	merged.Tasks = append([]Task{}, p.Tasks...)
+	for _, module := range modules {
+		tasks, ok := module.Implementations[family]
+		if !ok {
+			if family == "" {
+				return nil, fmt.Errorf("module %s is not available: unknown package family", module.ID)
+			}
+			return nil, fmt.Errorf("module %s is not available for %s systems", module.ID, family)
+		}
+		for _, task := range tasks {
+			task.Tags = append([]string{"addon", module.ID}, task.Tags...)
+			merged.Tasks = append(merged.Tasks, task)
+		}
+	}
+
+	if err := merged.Validate(); err != nil {
+		return nil, fmt.Errorf("failed to add modules: %v", err)
+	}
+	return &merged, nil
+}
+
+// boolPtr returns a pointer to a bool, for optional fields such as Task.Enabled
+func boolPtr(value bool) *bool {
+	return &value
+}
+
+func getDockerModule() Module {
+	return Module{
+		ID:          "docker",
+		Name:        "Docker",
+		Description: "Docker engine with the current user in the docker group",
+		Implementations: map[string][]Task{
+			FamilyDebian: {
+				{
+					ID:          "docker-install",
+					Name:        "Install Docker",
+					Description: "Install the Docker engine and Docker Compose",
+					Type:        "command",
+					Commands: []string{
+						"sudo apt-get update",
+						"sudo apt-get install -y docker.io docker-compose",
+					},
+					Elevated: true,
+				},
+				{
+					ID:          "docker-service",
+					Name:        "Enable Docker Service",
+					Description: "Start Docker now and on boot",
+					Type:        "service",
+					Service:     "docker",
+					State:       "started",
+					Enabled:     boolPtr(true),
+					Elevated:    true,
+					DependsOn:   []string{"docker-install"},
+				},
+				{
+					ID:          "docker-group",
+					Name:        "Add User to Docker Group",
+					Description: "Allow running docker without sudo (takes effect at next login)",
+					Type:        "script",
+					Script:      "#!/bin/bash\nset -e\n\nsudo usermod -aG docker \"$USER\"\necho \"Log out and back in to use docker without sudo\"",
+					Elevated:    true,
+					DependsOn:   []string{"docker-install"},
+				},
+			},
+			FamilyArch: {
+				{
+					ID:          "docker-install",
+					Name:        "Install Docker",
+					Description: "Install the Docker engine and Compose",
+					Type:        "command",
+					Commands: []string{
+						"sudo pacman -S --noconfirm --needed docker docker-compose",
+					},
+					Elevated: true,
+				},
+				{
+					ID:          "docker-service",
+					Name:        "Enable Docker Service",
+					Description: "Start Docker now and on boot",
+					Type:        "service",
+					Service:     "docker",
+					State:       "started",
+					Enabled:     boolPtr(true),
+					Elevated:    true,
+					DependsOn:   []string{"docker-install"},
+				},
+				{
+					ID:          "docker-group",
+					Name:        "Add User to Docker Group",
+					Description: "Allow running docker without sudo (takes effect at next login)",
+					Type:        "script",
+					Script:      "#!/bin/bash\nset -e\n\nsudo usermod -aG docker \"$USER\"\necho \"Log out and back in to use docker without sudo\"",
+					Elevated:    true,
+					DependsOn:   []string{"docker-install"},
+				},
+			},
+		},
+	}
+}
+
+func getNodeModule() Module {
+	return Module{
+		ID:          "node",
+		Name:        "Node.js",
+		Description: "Node.js runtime and npm",
+		Implementations: map[string][]Task{
+			FamilyDebian: {
+				{
+					ID:          "node-install",
+					Name:        "Install Node.js",
+					Description: "Install Node.js and npm from the distribution repositories",
+					Type:        "command",
+					Commands: []string{
+						"sudo apt-get update",
+						"sudo apt-get install -y nodejs npm",
+					},
+					Elevated: true,
+				},
+			},
+			FamilyArch: {
+				{
+					ID:          "node-install",
+					Name:        "Install Node.js",
+					Description: "Install Node.js and npm",
+					Type:        "command",
+					Commands: []string{
+						"sudo pacman -S --noconfirm --needed nodejs npm",
+					},
+					Elevated: true,
+				},
+			},
+		},
+	}
+}
+
+func getGoModule() Module {
+	return Module{
+		ID:          "go",
+		Name:        "Go Toolchain",
+		Description: "Go compiler and tools",
+		Implementations: map[string][]Task{
+			FamilyDebian: {
+				{
+					ID:          "go-install",
+					Name:        "Install Go",
+					Description: "Install the Go toolchain from the distribution repositories",
+					Type:        "command",
+					Commands: []string{
+						"sudo apt-get update",
+						"sudo apt-get install -y golang-go",
+					},
+					Elevated: true,
+				},
+			},
+			FamilyArch: {
+				{
+					ID:          "go-install",
+					Name:        "Install Go",
+					Description: "Install the Go toolchain",
+					Type:        "command",
+					Commands: []string{
+						"sudo pacman -S --noconfirm --needed go",
+					},
+					Elevated: true,
+				},
+			},
+		},
+	}
+}
+
+func getPythonModule() Module {
+	return Module{
+		ID:          "python",
+		Name:        "Python Development",
+		Description: "Python 3 with pip, venv and headers for building extensions",
+		Implementations: map[string][]Task{
+			FamilyDebian: {
+				{
+					ID:          "python-install",
+					Name:        "Install Python Development Tools",
+					Description: "Install Python 3, pip, venv and build dependencies",
+					Type:        "command",
+					Commands: []string{
+						"sudo apt-get update",
+						"sudo apt-get install -y python3 python3-pip python3-venv python3-dev build-essential",
+					},
+					Elevated: true,
+				},
+			},
+			FamilyArch: {
+				{
+					ID:          "python-install",
+					Name:        "Install Python Development Tools",
+					Description: "Install Python 3, pip and build dependencies",
+					Type:        "command",
+					Commands: []string{
+						"sudo pacman -S --noconfirm --needed python python-pip base-devel",
+					},
+					Elevated: true,
+				},
+			},
+		},
+	}
+}
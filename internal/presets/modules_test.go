@@ -0,0 +1,64 @@
+package presets
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWithModulesValidatesBuiltinPresets(t *testing.T) {
+	for _, family := range []string{FamilyDebian, FamilyArch} {
+		modules := ModulesFor(family)
+		for _, preset := range GetBuiltinPresets() {
+			merged, err := preset.WithModules(modules, family)
+			if err != nil {
+				t.Errorf("%s with %s modules: %v", preset.Name, family, err)
+				continue
+			}
+			if len(merged.Tasks) <= len(preset.Tasks) {
+				t.Errorf("%s with %s modules: no tasks were added", preset.Name, family)
+			}
+		}
+	}
+}
+
+func TestWithModulesRejectsInvalidTasks(t *testing.T) {
+	base := &Preset{Name: "Base", Description: "base", Tasks: []Task{{ID: "docker-install", Name: "Existing", Type: "command", Commands: []string{"true"}}}}
+	broken := Module{ID: "broken", Implementations: map[string][]Task{
+		FamilyDebian: {{Name: "Bad Condition", Type: "command", Commands: []string{"true"}, When: "arch =="}},
+	}}
+
+	tests := []struct {
+		name    string
+		modules []Module
+		family  string
+		want    string
+	}{
+		{"duplicate id", []Module{getDockerModule()}, FamilyDebian, "duplicate task id"},
+		{"invalid task", []Module{broken}, FamilyDebian, "invalid when condition"},
+		{"unsupported family", []Module{broken}, FamilyArch, "not available for arch"},
+		{"unknown family", []Module{broken}, "", "unknown package family"},
+	}
+
+	for _, tt := range tests {
+		_, err := base.WithModules(tt.modules, tt.family)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want it to contain %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestModuleTasksUsingSudoAreElevated(t *testing.T) {
+	for _, module := range GetAllModules() {
+		for family, tasks := range module.Implementations {
+			for _, task := range tasks {
+				usesSudo := strings.Contains(task.Script, "sudo ")
+				for _, command := range task.Commands {
+					usesSudo = usesSudo || strings.HasPrefix(command, "sudo ")
+				}
+				if usesSudo && !task.Elevated {
+					t.Errorf("%s (%s): task %q runs sudo but is not elevated", module.ID, family, task.Name)
+				}
+			}
+		}
+	}
+}
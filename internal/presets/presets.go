@@ -1,7 +1,6 @@
 package presets
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -9,6 +8,7 @@ import (
 	"strings"
 
 	"base-linux-setup/internal/detector"
+	"base-linux-setup/internal/expr"
 )
 
 // EmbeddedJSONGetter is a function type for getting embedded JSON data
@@ -24,46 +24,165 @@ func SetEmbeddedJSONGetter(getter EmbeddedJSONGetter) {
 
 // Task represents a single setup task
 type Task struct {
-	Name        string
-	Description string
-	Type        string // "command", "script", "file", "service"
-	Commands    []string
-	Script      string
-	Elevated    bool // requires sudo
-	Optional    bool
+	ID          string   `json:"id,omitempty"` // referenced by other tasks' depends_on
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Type        string   `json:"type"` // "command", "script", "file", "service", "block", "flush_handlers"
+	Commands    []string `json:"commands,omitempty"`
+	Script      string   `json:"script,omitempty"`
+	Path        string   `json:"path,omitempty"`    // file tasks: destination path
+	Mode        string   `json:"mode,omitempty"`    // file tasks: octal permissions, e.g. "0644"
+	Owner       string   `json:"owner,omitempty"`   // file tasks: owning user
+	Group       string   `json:"group,omitempty"`   // file tasks: owning group
+	Content     string   `json:"content,omitempty"` // file tasks: file content
+	Service     string   `json:"service,omitempty"` // service tasks: unit name
+	State       string   `json:"state,omitempty"`   // service tasks: started, stopped, restarted or reloaded
+	Enabled     *bool    `json:"enabled,omitempty"` // service tasks: start on boot
+	Elevated    bool     `json:"elevated"`          // requires sudo
+	Optional    bool     `json:"optional"`
+	When        string   `json:"when,omitempty"` // condition evaluated against facts and variables
+	DependsOn   []string `json:"depends_on,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Loop        *Loop    `json:"loop,omitempty"`         // repeat the task for each item
+	LoopVar     string   `json:"loop_var,omitempty"`     // item variable name, "item" by default
+	Register    string   `json:"register,omitempty"`     // store stdout, exit code and parsed JSON under this name
+	Notify      []string `json:"notify,omitempty"`       // handlers to run when the task changes something
+	ChangedWhen string   `json:"changed_when,omitempty"` // condition overriding change detection
+	Block       []Task   `json:"block,omitempty"`        // tasks run in order by a "block" task
+	Rescue      []Task   `json:"rescue,omitempty"`       // tasks run when a block task fails
+	Always      []Task   `json:"always,omitempty"`       // tasks run after the block whatever the outcome
+	LintIgnore  []string `json:"lint_ignore,omitempty"`  // lint rule IDs suppressed for this task
 }
 
 // Preset represents a collection of tasks for a specific environment
 type Preset struct {
-	Name        string
-	Environment string
-	Description string
-	Tasks       []Task
+	SchemaVersion int    `json:"schema_version,omitempty"`
+	Name          string `json:"name"`
+	Environment   string `json:"environment"`
+	Description   string `json:"description"`
+	Match         string `json:"match,omitempty"` // condition on facts selecting the preset automatically
+
+	Version           string   `json:"version,omitempty"`
+	Authors           []string `json:"authors,omitempty"`
+	Homepage          string   `json:"homepage,omitempty"`
+	License           string   `json:"license,omitempty"`
+	MinToolVersion    string   `json:"min_tool_version,omitempty"`   // oldest base-linux-setup release that can run the preset
+	Architectures     []string `json:"architectures,omitempty"`      // supported CPU architectures, all when empty
+	EstimatedDuration string   `json:"estimated_duration,omitempty"` // e.g. "45m"
+	RebootRequired    bool     `json:"reboot_required,omitempty"`
+
+	Variables []Variable `json:"variables,omitempty"`
+	Tasks     []Task     `json:"tasks"`
+	Handlers  []Task     `json:"handlers,omitempty"` // run once at the end of a run when notified
+	Profiles  []Profile  `json:"profiles,omitempty"` // named task subsets with their own variable defaults
+
+	LintIgnore []string `json:"lint_ignore,omitempty"` // lint rule IDs suppressed for the whole preset
+
+	Profile  string      `json:"-"` // name of the applied profile, if any
+	Warnings []string    `json:"-"` // deprecations found while loading
+	Path     string      `json:"-"` // file the preset was loaded from, for user presets
+	Source   *Provenance `json:"-"` // remote source of a fetched preset
+	SignedBy string      `json:"-"` // trusted key whose signature was verified
+}
+
+// Validate checks a preset for declaration errors before it is used
+func (p *Preset) Validate() error {
+	if err := p.validateMetadata(); err != nil {
+		return err
+	}
+	if p.Match != "" {
+		if _, err := expr.Parse(p.Match); err != nil {
+			return fmt.Errorf("invalid match condition: %v", err)
+		}
+	}
+	if err := validateVariables(p.Variables); err != nil {
+		return err
+	}
+	if err := validateDependencies(p.Tasks); err != nil {
+		return err
+	}
+	for _, task := range p.Tasks {
+		if err := p.validateTask(task); err != nil {
+			return err
+		}
+	}
+	if err := p.validateHandlers(); err != nil {
+		return err
+	}
+	if err := p.validateProfiles(); err != nil {
+		return err
+	}
+	return nil
 }
 
-// GetPreset returns the appropriate preset for the given environment
-func GetPreset(env *detector.Environment) *Preset {
+// validateTask checks the expressions and names used by a single task or handler
+func (p *Preset) validateTask(task Task) error {
+	if task.When != "" {
+		if _, err := expr.Parse(task.When); err != nil {
+			return fmt.Errorf("task %q has an invalid when condition: %v", task.Name, err)
+		}
+	}
+	if task.ChangedWhen != "" {
+		if _, err := expr.Parse(task.ChangedWhen); err != nil {
+			return fmt.Errorf("task %q has an invalid changed_when condition: %v", task.Name, err)
+		}
+	}
+	if !task.Loop.IsEmpty() && task.Loop.From != "" {
+		if _, err := expr.Parse(task.Loop.From); err != nil {
+			return fmt.Errorf("task %q has an invalid loop source: %v", task.Name, err)
+		}
+	}
+	if task.LoopVar != "" && !variableNamePattern.MatchString(task.LoopVar) {
+		return fmt.Errorf("task %q has an invalid loop_var %q", task.Name, task.LoopVar)
+	}
+	if task.Register != "" {
+		if err := p.validateRegister(task); err != nil {
+			return err
+		}
+	}
+	for _, ref := range task.Notify {
+		if _, ok := p.FindHandler(ref); !ok {
+			return fmt.Errorf("task %q notifies unknown handler %q", task.Name, ref)
+		}
+	}
+	if err := validateTypedFields(task); err != nil {
+		return err
+	}
+	return p.validateBlock(task)
+}
+
+// GetPreset returns the appropriate preset for the given environment. User presets
+// whose match condition holds take precedence over the built-in presets. User
+// presets that failed to load are skipped and returned as errors.
+func GetPreset(env *detector.Environment) (*Preset, []error) {
+	userPresets, loadErrs := LoadUserPresets()
+	for _, preset := range userPresets {
+		if preset.Matches(env) {
+			return preset, loadErrs
+		}
+	}
+
 	// Check for Kali Linux on Raspberry Pi
 	if isKaliRaspberryPi(env) {
-		return getKaliRaspberryPiPreset()
+		return getKaliRaspberryPiPreset(), loadErrs
 	}
 
 	// Check for other Debian-based systems
 	if isDebianBased(env) {
-		return getDebianBasePreset()
+		return getDebianBasePreset(), loadErrs
 	}
 
 	// Check for Ubuntu
 	if isUbuntu(env) {
-		return getUbuntuPreset()
+		return getUbuntuPreset(), loadErrs
 	}
 
 	// Check for Arch Linux
 	if isArch(env) {
-		return getArchPreset()
+		return getArchPreset(), loadErrs
 	}
 
-	return nil
+	return nil, loadErrs
 }
 
 // GetDefaultPreset returns a basic preset for unknown environments
@@ -74,25 +193,37 @@ func GetDefaultPreset() *Preset {
 		Description: "Basic setup tasks for generic Linux systems",
 		Tasks: []Task{
 			{
+				ID:          "update-packages",
 				Name:        "Update Package List",
 				Description: "Update the package manager cache",
-				Type:        "command",
-				Commands:    []string{"sudo apt-get update || sudo yum update || sudo pacman -Sy"},
+				Type:        "script",
+				Script:      "#!/bin/sh\nset -e\n\nif command -v apt-get >/dev/null; then\n    sudo apt-get update\nelif command -v yum >/dev/null; then\n    sudo yum makecache\nelif command -v pacman >/dev/null; then\n    sudo pacman -Sy\nelse\n    echo \"No supported package manager found\" >&2\n    exit 1\nfi",
 				Elevated:    true,
+				Tags:        []string{"system"},
 			},
 			{
+				ID:          "install-basic-tools",
 				Name:        "Install Basic Tools",
 				Description: "Install essential development tools",
-				Type:        "command",
-				Commands:    []string{"sudo apt-get install -y curl wget git || sudo yum install -y curl wget git || sudo pacman -S curl wget git"},
+				Type:        "script",
+				Script:      "#!/bin/sh\nset -e\n\nif command -v apt-get >/dev/null; then\n    sudo apt-get install -y curl wget git\nelif command -v yum >/dev/null; then\n    sudo yum install -y curl wget git\nelif command -v pacman >/dev/null; then\n    sudo pacman -S --needed --noconfirm curl wget git\nelse\n    echo \"No supported package manager found\" >&2\n    exit 1\nfi",
 				Elevated:    true,
+				DependsOn:   []string{"update-packages"},
+				Tags:        []string{"packages", "dev"},
 			},
 		},
 	}
 }
 
-// GetAllPresets returns all available presets
-func GetAllPresets() []*Preset {
+// GetAllPresets returns all available presets, built-in and user presets, along
+// with the errors of user presets that failed to load
+func GetAllPresets() ([]*Preset, []error) {
+	userPresets, loadErrs := LoadUserPresets()
+	return append(GetBuiltinPresets(), userPresets...), loadErrs
+}
+
+// GetBuiltinPresets returns the presets shipped with the binary
+func GetBuiltinPresets() []*Preset {
 	return []*Preset{
 		getKaliRaspberryPiPreset(),
 		getDebianBasePreset(),
@@ -121,6 +252,7 @@ func getKaliRaspberryPiPreset() *Preset {
 		Description: "Complete setup for Kali Linux on Raspberry Pi with development tools",
 		Tasks: []Task{
 			{
+				ID:          "upgrade-system",
 				Name:        "Update and Upgrade System",
 				Description: "Update package lists and upgrade all installed packages",
 				Type:        "command",
@@ -130,33 +262,43 @@ func getKaliRaspberryPiPreset() *Preset {
 					"sudo apt-get dist-upgrade -y",
 				},
 				Elevated: true,
+				Tags:     []string{"system", "upgrade", "slow"},
 			},
 			{
+				ID:          "install-golang",
 				Name:        "Install Golang",
 				Description: "Install Go programming language",
 				Type:        "command",
 				Commands: []string{
 					"sudo apt-get install -y golang-go",
 				},
-				Elevated: true,
+				Elevated:  true,
+				DependsOn: []string{"upgrade-system"},
+				Tags:      []string{"dev", "golang"},
 			},
 			{
+				ID:          "install-packages",
 				Name:        "Install Required System Packages",
 				Description: "Install essential development and system packages",
 				Type:        "command",
 				Commands: []string{
 					"sudo apt-get install -y build-essential git curl wget vim python3 python3-pip nodejs npm htop tree i2c-tools libi2c-dev python3-smbus",
 				},
-				Elevated: true,
+				Elevated:  true,
+				DependsOn: []string{"upgrade-system"},
+				Tags:      []string{"packages", "dev"},
 			},
 			{
+				ID:          "enable-i2c",
 				Name:        "Enable I2C Interface",
 				Description: "Enable I2C interface for hardware communication",
 				Type:        "command",
 				Commands: []string{
 					"sudo raspi-config nonint do_i2c 0",
 				},
-				Elevated: true,
+				Elevated:  true,
+				DependsOn: []string{"install-packages"},
+				Tags:      []string{"hardware", "i2c"},
 			},
 		},
 	}
@@ -173,14 +315,18 @@ func loadPresetFromEmbeddedJSON(filename string) (*Preset, error) {
 	if err != nil {
 		return nil, err
 	}
-	
-	// Parse JSON
-	var preset Preset
-	if err := json.Unmarshal(data, &preset); err != nil {
-		return nil, fmt.Errorf("failed to parse embedded preset JSON: %v", err)
+
+	// Parse JSON, migrating older schema versions
+	preset, err := DecodePreset(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid embedded preset %s: %v", filename, err)
 	}
-	
-	return &preset, nil
+
+	if err := preset.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid embedded preset %s: %v", filename, err)
+	}
+
+	return preset, nil
 }
 
 // loadPresetFromJSON loads a preset from a JSON file (fallback for development)
@@ -201,27 +347,44 @@ func loadPresetFromJSON(filename string) (*Preset, error) {
 		projectRoot := filepath.Dir(filepath.Dir(filepath.Dir(currentFile)))
 		scriptDir = filepath.Join(projectRoot, "scripts")
 	}
-	
-	filePath := filepath.Join(scriptDir, filename)
-	
+
+	return LoadPresetFile(filepath.Join(scriptDir, filename))
+}
+
+// LoadPresetFile loads and validates a JSON or YAML preset file, migrating older
+// schema versions in memory. The file's detached signature is verified first.
+func LoadPresetFile(filePath string) (*Preset, error) {
 	// Check if file exists
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		return nil, fmt.Errorf("preset file not found: %s", filePath)
 	}
-	
-	// Read the JSON file
+
+	// Read the preset file
 	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read preset file: %v", err)
 	}
-	
-	// Parse JSON
-	var preset Preset
-	if err := json.Unmarshal(data, &preset); err != nil {
-		return nil, fmt.Errorf("failed to parse preset JSON: %v", err)
+
+	signer, err := verifyPresetFile(filePath, data)
+	if err != nil {
+		return nil, fmt.Errorf("refusing preset %s: %v", filePath, err)
 	}
-	
-	return &preset, nil
+
+	preset, err := DecodePreset(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid preset %s: %v", filePath, err)
+	}
+
+	if err := preset.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid preset %s: %v", filePath, err)
+	}
+
+	preset.SignedBy = signer
+	if signer == "" {
+		preset.Warnings = append(preset.Warnings, fmt.Sprintf("%s is not signed", filePath))
+	}
+
+	return preset, nil
 }
 
 // Helper functions for environment detection
@@ -254,6 +417,7 @@ func getDebianBasePreset() *Preset {
 		Description: "Basic setup for Debian-based systems",
 		Tasks: []Task{
 			{
+				ID:          "update-system",
 				Name:        "Update System",
 				Description: "Update and upgrade system packages",
 				Type:        "command",
@@ -262,15 +426,19 @@ func getDebianBasePreset() *Preset {
 					"sudo apt-get upgrade -y",
 				},
 				Elevated: true,
+				Tags:     []string{"system"},
 			},
 			{
+				ID:          "install-essentials",
 				Name:        "Install Essential Packages",
 				Description: "Install essential development tools",
 				Type:        "command",
 				Commands: []string{
 					"sudo apt-get install -y build-essential git curl wget vim",
 				},
-				Elevated: true,
+				Elevated:  true,
+				DependsOn: []string{"update-system"},
+				Tags:      []string{"packages", "dev"},
 			},
 		},
 	}
@@ -283,6 +451,7 @@ func getUbuntuPreset() *Preset {
 		Description: "Setup for Ubuntu systems",
 		Tasks: []Task{
 			{
+				ID:          "update-system",
 				Name:        "Update System",
 				Description: "Update package lists and upgrade system",
 				Type:        "command",
@@ -291,8 +460,10 @@ func getUbuntuPreset() *Preset {
 					"sudo apt upgrade -y",
 				},
 				Elevated: true,
+				Tags:     []string{"system"},
 			},
 			{
+				ID:          "install-snaps",
 				Name:        "Install Snap Packages",
 				Description: "Install useful snap packages",
 				Type:        "command",
@@ -300,8 +471,10 @@ func getUbuntuPreset() *Preset {
 					"sudo snap install code --classic",
 					"sudo snap install discord",
 				},
-				Elevated: true,
-				Optional: true,
+				Elevated:  true,
+				Optional:  true,
+				DependsOn: []string{"update-system"},
+				Tags:      []string{"packages", "snap"},
 			},
 		},
 	}
@@ -314,6 +487,7 @@ func getArchPreset() *Preset {
 		Description: "Setup for Arch Linux systems",
 		Tasks: []Task{
 			{
+				ID:          "update-system",
 				Name:        "Update System",
 				Description: "Update system packages",
 				Type:        "command",
@@ -321,15 +495,19 @@ func getArchPreset() *Preset {
 					"sudo pacman -Syu --noconfirm",
 				},
 				Elevated: true,
+				Tags:     []string{"system"},
 			},
 			{
+				ID:          "install-base-devel",
 				Name:        "Install Base Development Tools",
 				Description: "Install essential development packages",
 				Type:        "command",
 				Commands: []string{
 					"sudo pacman -S --noconfirm base-devel git curl wget vim",
 				},
-				Elevated: true,
+				Elevated:  true,
+				DependsOn: []string{"update-system"},
+				Tags:      []string{"packages", "dev"},
 			},
 		},
 	}
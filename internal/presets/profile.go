@@ -0,0 +1,112 @@
+package presets
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Profile is a named variant of a preset that selects a subset of its tasks and
+// overrides variable defaults, e.g. "minimal", "dev" or "server". A profile
+// without tags or tasks keeps every task.
+type Profile struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Tags        []string               `json:"tags,omitempty"`      // include tasks with any of these tags
+	SkipTags    []string               `json:"skip_tags,omitempty"` // exclude tasks with any of these tags
+	Tasks       []string               `json:"tasks,omitempty"`     // include these tasks, by ID or name
+	Variables   map[string]interface{} `json:"variables,omitempty"` // variable defaults for this profile
+}
+
+// filter returns the task filter selecting the profile's tasks
+func (pr Profile) filter() TaskFilter {
+	return TaskFilter{Tags: pr.Tags, SkipTags: pr.SkipTags, Only: pr.Tasks}
+}
+
+// FindProfile returns the profile with the given (case-insensitive) name
+func (p *Preset) FindProfile(name string) (Profile, bool) {
+	for _, profile := range p.Profiles {
+		if strings.EqualFold(profile.Name, name) {
+			return profile, true
+		}
+	}
+	return Profile{}, false
+}
+
+// ApplyProfile returns a copy of the preset restricted to the profile's tasks, with
+// the profile's variable defaults applied, and warnings about dependency adjustments
+func (p *Preset) ApplyProfile(name string) (*Preset, []string, error) {
+	profile, ok := p.FindProfile(name)
+	if !ok {
+		names := make([]string, 0, len(p.Profiles))
+		for _, profile := range p.Profiles {
+			names = append(names, profile.Name)
+		}
+		if len(names) == 0 {
+			return nil, nil, fmt.Errorf("preset %s has no profiles", p.Name)
+		}
+		return nil, nil, fmt.Errorf("no profile named %q in preset %s (available: %s)", name, p.Name, strings.Join(names, ", "))
+	}
+
+	profiled, warnings, err := p.Filter(profile.filter())
+	if err != nil {
+		return nil, nil, err
+	}
+	if profiled == p {
+		copied := *p
+		profiled = &copied
+	}
+
+	profiled.Variables = make([]Variable, len(p.Variables))
+	for i, variable := range p.Variables {
+		if raw, ok := profile.Variables[variable.Name]; ok {
+			value, err := variable.Convert(raw)
+			if err != nil {
+				return nil, nil, fmt.Errorf("profile %s: variable %s: %v", profile.Name, variable.Name, err)
+			}
+			variable.Default = value
+		}
+		profiled.Variables[i] = variable
+	}
+
+	profiled.Profile = profile.Name
+	return profiled, warnings, nil
+}
+
+// validateProfiles checks profile names, task references and variable defaults
+func (p *Preset) validateProfiles() error {
+	seen := make(map[string]bool)
+	for _, profile := range p.Profiles {
+		if !taskIDPattern.MatchString(profile.Name) {
+			return fmt.Errorf("invalid profile name %q", profile.Name)
+		}
+		key := strings.ToLower(profile.Name)
+		if seen[key] {
+			return fmt.Errorf("duplicate profile name %q", profile.Name)
+		}
+		seen[key] = true
+
+		for _, ref := range profile.Tasks {
+			found := false
+			for _, task := range p.Tasks {
+				if task.matchesRef(ref) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("profile %s references unknown task %q", profile.Name, ref)
+			}
+		}
+
+		for name, raw := range profile.Variables {
+			variable, ok := p.FindVariable(name)
+			if !ok {
+				return fmt.Errorf("profile %s sets unknown variable %q", profile.Name, name)
+			}
+			if _, err := variable.Convert(raw); err != nil {
+				return fmt.Errorf("profile %s: variable %s: %v", profile.Name, name, err)
+			}
+		}
+	}
+	return nil
+}
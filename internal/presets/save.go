@@ -0,0 +1,76 @@
+package presets
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// EncodePreset serializes a preset in the given format, with keys in declaration
+// order and templates left unescaped
+func EncodePreset(p *Preset, format string) ([]byte, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode preset: %v", err)
+	}
+	encoded, _, err := MigratePreset(data, format)
+	return encoded, err
+}
+
+// WritePresetFile writes a preset to a file, choosing the format from its extension
+func WritePresetFile(p *Preset, path string) error {
+	data, err := EncodePreset(p, FormatForPath(path))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create preset directory: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write preset: %v", err)
+	}
+	return nil
+}
+
+// UserPresetPath returns where a user preset with the given name is stored
+func UserPresetPath(name, format string) (string, error) {
+	if Slug(name) == "" {
+		return "", fmt.Errorf("preset name %q has no letters or digits to name its file after", name)
+	}
+	dir, err := UserPresetDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, Slug(name)+"."+format), nil
+}
+
+// Snapshot returns a standalone copy of a preset as it is about to run, so it can
+// be saved and run again: profiles are dropped as the tasks already reflect the
+// chosen one, and the variable values in use become the defaults. Secrets are
+// never written; they keep their declared default.
+func (p *Preset) Snapshot(name string, values map[string]interface{}) (*Preset, error) {
+	snapshot := *p
+	snapshot.SchemaVersion = CurrentSchemaVersion
+	snapshot.Name = name
+	snapshot.Match = ""
+	snapshot.Profiles = nil
+	snapshot.Profile = ""
+	snapshot.Warnings = nil
+	snapshot.Path = ""
+	snapshot.Source = nil
+	snapshot.SignedBy = ""
+
+	snapshot.Variables = make([]Variable, len(p.Variables))
+	for i, variable := range p.Variables {
+		if value, ok := values[variable.Name]; ok && !variable.IsSecret() {
+			variable.Default = value
+		}
+		snapshot.Variables[i] = variable
+	}
+
+	if err := snapshot.Validate(); err != nil {
+		return nil, fmt.Errorf("customized preset is invalid: %v", err)
+	}
+	return &snapshot, nil
+}
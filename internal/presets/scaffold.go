@@ -0,0 +1,173 @@
+package presets
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"base-linux-setup/internal/detector"
+)
+
+// ScaffoldTaskTypes are the task types an example task can be generated for
+var ScaffoldTaskTypes = []string{"command", "script", "file", "service"}
+
+// ScaffoldOptions describes a new preset skeleton
+type ScaffoldOptions struct {
+	Name          string
+	Description   string
+	Environment   string
+	Match         string   // detection condition, see DefaultMatch
+	Family        string   // package family the example commands are written for
+	Architectures []string // supported architectures, all when empty
+	TaskTypes     []string // example tasks to include, all when empty
+}
+
+// slugPattern matches runs of characters that cannot appear in a file name slug
+var slugPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Slug turns a preset name into a file name, e.g. "My Pi Setup" → "my-pi-setup"
+func Slug(name string) string {
+	return strings.Trim(slugPattern.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// DefaultMatch builds a match condition selecting environments like the detected one
+func DefaultMatch(env *detector.Environment) string {
+	conditions := make([]string, 0, 2)
+	if fields := strings.Fields(strings.ToLower(env.Distribution)); len(fields) > 0 && fields[0] != "unknown" {
+		conditions = append(conditions, fmt.Sprintf("distro =~ %q", "^"+regexp.QuoteMeta(fields[0])))
+	}
+	if env.IsRaspberryPi {
+		conditions = append(conditions, "board.raspberry_pi")
+	}
+	return strings.Join(conditions, " && ")
+}
+
+// DefaultArchitectures returns the detected architecture in the form presets declare it
+func DefaultArchitectures(env *detector.Environment) []string {
+	if env.Architecture == "" {
+		return nil
+	}
+	return []string{normalizeArch(env.Architecture)}
+}
+
+// Scaffold builds a preset skeleton with example tasks of the requested types
+func Scaffold(opts ScaffoldOptions) (*Preset, error) {
+	if Slug(opts.Name) == "" {
+		return nil, fmt.Errorf("a preset name with letters or digits is required")
+	}
+	types := opts.TaskTypes
+	if len(types) == 0 {
+		types = ScaffoldTaskTypes
+	}
+
+	preset := &Preset{
+		SchemaVersion: CurrentSchemaVersion,
+		Name:          opts.Name,
+		Environment:   opts.Environment,
+		Description:   opts.Description,
+		Match:         opts.Match,
+		Version:       "0.1.0",
+		Architectures: opts.Architectures,
+	}
+	if preset.Environment == "" {
+		preset.Environment = opts.Name
+	}
+	if preset.Description == "" {
+		preset.Description = "Setup tasks for " + preset.Environment
+	}
+
+	for _, taskType := range types {
+		switch taskType {
+		case "command":
+			preset.Variables = append(preset.Variables, Variable{
+				Name:        "packages",
+				Description: "Packages to install",
+				Type:        "list",
+				Default:     []interface{}{"git", "curl"},
+			})
+			preset.Tasks = append(preset.Tasks, PackageTasks(opts.Family)...)
+		case "script":
+			preset.Tasks = append(preset.Tasks, Task{
+				ID:          "configure-shell",
+				Name:        "Configure Shell",
+				Description: "Add ~/.local/bin to PATH once",
+				Type:        "script",
+				Script:      "#!/bin/bash\nset -e\n\nif ! grep -q '.local/bin' ~/.bashrc; then\n    echo 'export PATH=$PATH:$HOME/.local/bin' >> ~/.bashrc # lint:ignore BLS005\nfi",
+				Tags:        []string{"shell"},
+			})
+		case "file":
+			preset.Tasks = append(preset.Tasks, Task{
+				ID:          "motd",
+				Name:        "Set Login Message",
+				Description: "Write the message shown at login",
+				Type:        "file",
+				Path:        "/etc/motd",
+				Mode:        "0644",
+				Owner:       "root",
+				Group:       "root",
+				Content:     "Configured with base-linux-setup\n",
+				Elevated:    true,
+				Optional:    true,
+				Tags:        []string{"config"},
+			})
+		case "service":
+			service := "ssh"
+			if opts.Family == FamilyArch {
+				service = "sshd"
+			}
+			preset.Tasks = append(preset.Tasks, Task{
+				ID:          "ssh-service",
+				Name:        "Enable SSH",
+				Description: "Start the SSH server now and on boot",
+				Type:        "service",
+				Service:     service,
+				State:       "started",
+				Enabled:     boolPtr(true),
+				Elevated:    true,
+				Optional:    true,
+				Tags:        []string{"services"},
+			})
+		default:
+			return nil, fmt.Errorf("unknown task type %q (expected one of %s)", taskType, strings.Join(ScaffoldTaskTypes, ", "))
+		}
+	}
+
+	if err := preset.Validate(); err != nil {
+		return nil, fmt.Errorf("generated preset is invalid: %v", err)
+	}
+	return preset, nil
+}
+
+// PackageTasks returns tasks updating the package lists and installing the
+// packages listed in the "packages" variable, for a package family
+func PackageTasks(family string) []Task {
+	update, install := "echo Replace with the command updating package lists", "echo Replace with the command installing {{ join \" \" .packages }}"
+	switch family {
+	case FamilyDebian:
+		update, install = "sudo apt-get update", "sudo apt-get install -y {{ join \" \" .packages }}"
+	case FamilyArch:
+		update, install = "sudo pacman -Sy --noconfirm", "sudo pacman -S --noconfirm --needed {{ join \" \" .packages }}"
+	}
+
+	return []Task{
+		{
+			ID:          "update-packages",
+			Name:        "Update Package Lists",
+			Description: "Refresh the package manager cache",
+			Type:        "command",
+			Commands:    []string{update},
+			Elevated:    family != "",
+			Tags:        []string{"system"},
+		},
+		{
+			ID:          "install-packages",
+			Name:        "Install Packages",
+			Description: "Install the packages listed in the packages variable",
+			Type:        "command",
+			Commands:    []string{install},
+			Elevated:    family != "",
+			DependsOn:   []string{"update-packages"},
+			Tags:        []string{"packages"},
+		},
+	}
+}
@@ -0,0 +1,37 @@
+package presets
+
+import "testing"
+
+func TestSlug(t *testing.T) {
+	tests := map[string]string{
+		"My Pi Setup":      "my-pi-setup",
+		"  Kali / RPi 4  ": "kali-rpi-4",
+		"dev_box.v2":       "dev-box-v2",
+		"***":              "",
+		"":                 "",
+	}
+	for name, want := range tests {
+		if got := Slug(name); got != want {
+			t.Errorf("Slug(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestScaffoldRejectsNamesWithoutSlug(t *testing.T) {
+	for _, name := range []string{"", "   ", "***", "--"} {
+		if _, err := Scaffold(ScaffoldOptions{Name: name}); err == nil {
+			t.Errorf("Scaffold(%q) succeeded, want an error", name)
+		}
+		if _, err := UserPresetPath(name, FormatJSON); err == nil {
+			t.Errorf("UserPresetPath(%q) succeeded, want an error", name)
+		}
+	}
+
+	preset, err := Scaffold(ScaffoldOptions{Name: "My Box", Family: FamilyDebian})
+	if err != nil {
+		t.Fatalf("Scaffold: %v", err)
+	}
+	if err := preset.Validate(); err != nil {
+		t.Errorf("scaffolded preset does not validate: %v", err)
+	}
+}
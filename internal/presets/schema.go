@@ -0,0 +1,396 @@
+package presets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentSchemaVersion is the preset schema this binary reads natively. Presets
+// declaring an older schema_version (or none, meaning 1) are migrated on load.
+const CurrentSchemaVersion = 3
+
+// schemaVersionAlias is the camelCase spelling of schema_version, accepted for
+// presets written that way and rewritten to schema_version on migration
+const schemaVersionAlias = "schemaVersion"
+
+// Preset document formats
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// migration upgrades a preset document by one schema version. It edits the
+// document tree in place so comments and key order survive.
+type migration struct {
+	description string
+	apply       func(doc *yaml.Node) error
+}
+
+// migrations[v] upgrades a version v document to version v+1
+var migrations = map[int]migration{
+	1: {"keys are spelled as documented, e.g. name instead of Name", migrateKeyCase},
+	2: {"named path, mode, content, service, state and enabled fields replace positional commands", migrateNamedFields},
+}
+
+// FormatForPath returns the preset format implied by a file name
+func FormatForPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	default:
+		return FormatJSON
+	}
+}
+
+// DecodePreset parses a JSON or YAML preset, migrating it to the current schema
+func DecodePreset(data []byte) (*Preset, error) {
+	doc, err := parseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := migrateDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode through JSON so the json tags on Preset and Task stay the single
+	// description of the format
+	var raw interface{}
+	if err := doc.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to parse preset: %v", err)
+	}
+	normalized, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse preset: %v", err)
+	}
+
+	var preset Preset
+	if err := json.Unmarshal(normalized, &preset); err != nil {
+		return nil, fmt.Errorf("failed to parse preset: %v", err)
+	}
+	preset.SchemaVersion = CurrentSchemaVersion
+
+	if len(applied) > 0 {
+		preset.Warnings = append(preset.Warnings, "preset uses an older schema version and was migrated on load; run 'base-linux-setup migrate-preset' to update the file")
+	}
+	preset.Warnings = append(preset.Warnings, preset.legacyFieldWarnings()...)
+	return &preset, nil
+}
+
+// MigratePreset rewrites a preset document to the current schema in the given
+// output format, returning the new document and a description of each migration
+// applied. YAML comments are kept when the output is YAML.
+func MigratePreset(data []byte, format string) ([]byte, []string, error) {
+	doc, err := parseDocument(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	applied, err := migrateDocument(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch format {
+	case FormatYAML:
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if doc.Style&yaml.FlowStyle != 0 {
+			// Converting from JSON; YAML sources keep their own styles
+			blockStyle(doc)
+		}
+		if err := encoder.Encode(doc); err != nil {
+			return nil, nil, fmt.Errorf("failed to write YAML: %v", err)
+		}
+		return buf.Bytes(), applied, nil
+	case FormatJSON:
+		var buf bytes.Buffer
+		if err := writeJSON(&buf, doc, ""); err != nil {
+			return nil, nil, fmt.Errorf("failed to write JSON: %v", err)
+		}
+		buf.WriteString("\n")
+		return buf.Bytes(), applied, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown preset format %q (expected json or yaml)", format)
+	}
+}
+
+// parseDocument parses JSON or YAML into a document tree and returns its root mapping
+func parseDocument(data []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse preset: %v", err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("failed to parse preset: expected an object at the top level")
+	}
+
+	// Keep comments attached to the document on the root mapping
+	root := doc.Content[0]
+	if root.HeadComment == "" {
+		root.HeadComment = doc.HeadComment
+	}
+	if root.FootComment == "" {
+		root.FootComment = doc.FootComment
+	}
+	return root, nil
+}
+
+// migrateDocument upgrades a document to the current schema and records the new version
+func migrateDocument(doc *yaml.Node) ([]string, error) {
+	version, err := schemaVersionOf(doc)
+	if err != nil {
+		return nil, err
+	}
+	if version > CurrentSchemaVersion {
+		return nil, fmt.Errorf("preset uses schema version %d, but this base-linux-setup only supports up to %d; please upgrade", version, CurrentSchemaVersion)
+	}
+
+	applied := make([]string, 0)
+	for ; version < CurrentSchemaVersion; version++ {
+		step, ok := migrations[version]
+		if !ok {
+			return nil, fmt.Errorf("no migration from schema version %d", version)
+		}
+		if err := step.apply(doc); err != nil {
+			return nil, fmt.Errorf("failed to migrate from schema version %d: %v", version, err)
+		}
+		applied = append(applied, fmt.Sprintf("schema %d → %d: %s", version, version+1, step.description))
+	}
+
+	setSchemaVersion(doc, CurrentSchemaVersion)
+	return applied, nil
+}
+
+// schemaVersionOf reads a document's schema_version (or schemaVersion); documents
+// without one are version 1
+func schemaVersionOf(doc *yaml.Node) (int, error) {
+	value := mappingValue(doc, "schema_version")
+	alias := mappingValue(doc, schemaVersionAlias)
+	if value == nil {
+		value = alias
+	} else if alias != nil && alias.Value != value.Value {
+		return 0, fmt.Errorf("schema_version %q and schemaVersion %q disagree", value.Value, alias.Value)
+	}
+	if value == nil {
+		return 1, nil
+	}
+	version, err := strconv.Atoi(value.Value)
+	if err != nil || value.Kind != yaml.ScalarNode || version < 1 {
+		return 0, fmt.Errorf("invalid schema_version %q: expected a positive integer", value.Value)
+	}
+	return version, nil
+}
+
+// setSchemaVersion sets schema_version, adding it as the first key when missing.
+// A schemaVersion key is renamed to schema_version.
+func setSchemaVersion(doc *yaml.Node, version int) {
+	if mappingValue(doc, "schema_version") != nil {
+		replaceKey(doc, schemaVersionAlias, nil)
+	} else {
+		renameKey(doc, schemaVersionAlias, "schema_version")
+	}
+	scalar := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(version)}
+	if value := mappingValue(doc, "schema_version"); value != nil {
+		value.Kind, value.Tag, value.Value, value.Style = scalar.Kind, scalar.Tag, scalar.Value, 0
+		return
+	}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "schema_version"}
+	if len(doc.Content) > 0 {
+		// A comment heading the document stays at the top
+		key.HeadComment, doc.Content[0].HeadComment = doc.Content[0].HeadComment, ""
+	}
+	doc.Content = append([]*yaml.Node{key, scalar}, doc.Content...)
+}
+
+// migrateKeyCase spells the keys of a preset, its variables and its tasks as
+// documented. Releases before schema versions matched keys in any letter case, so
+// older files may use "Name" or "Commands", which migrations looking up keys miss.
+func migrateKeyCase(doc *yaml.Node) error {
+	canonicalizeKeys(doc, jsonKeys(Preset{}))
+	if variables := mappingValue(doc, "variables"); variables != nil && variables.Kind == yaml.SequenceNode {
+		for _, variable := range variables.Content {
+			canonicalizeKeys(variable, jsonKeys(Variable{}))
+		}
+	}
+
+	taskKeys := jsonKeys(Task{})
+	var visit func(tasks *yaml.Node)
+	visit = func(tasks *yaml.Node) {
+		if tasks == nil || tasks.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, task := range tasks.Content {
+			canonicalizeKeys(task, taskKeys)
+			for _, section := range []string{"block", "rescue", "always"} {
+				visit(mappingValue(task, section))
+			}
+		}
+	}
+	visit(mappingValue(doc, "tasks"))
+	visit(mappingValue(doc, "handlers"))
+	return nil
+}
+
+// canonicalizeKeys renames the keys of a mapping that match one of keys in another
+// letter case, unless that spelling is present as well
+func canonicalizeKeys(mapping *yaml.Node, keys []string) {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key := mapping.Content[i]
+		for _, canonical := range keys {
+			if key.Value != canonical && strings.EqualFold(key.Value, canonical) && mappingValue(mapping, canonical) == nil {
+				key.Value = canonical
+				break
+			}
+		}
+	}
+}
+
+// jsonKeys returns the keys a struct is encoded with
+func jsonKeys(value interface{}) []string {
+	t := reflect.TypeOf(value)
+	keys := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ","); name != "" && name != "-" {
+			keys = append(keys, name)
+		}
+	}
+	return keys
+}
+
+// mappingValue returns the value stored under key in a mapping node, or nil
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// replaceKey replaces a mapping entry with the given key and value nodes, keeping
+// its position and the comments attached to its key
+func replaceKey(mapping *yaml.Node, key string, entries []*yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != key {
+			continue
+		}
+		if len(entries) > 1 {
+			entries[0].HeadComment = mapping.Content[i].HeadComment
+			entries[1].LineComment = mapping.Content[i].LineComment + mapping.Content[i+1].LineComment
+		}
+		content := append([]*yaml.Node{}, mapping.Content[:i]...)
+		content = append(content, entries...)
+		mapping.Content = append(content, mapping.Content[i+2:]...)
+		return
+	}
+}
+
+// renameKey renames a mapping entry in place
+func renameKey(mapping *yaml.Node, from, to string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == from {
+			mapping.Content[i].Value = to
+			return
+		}
+	}
+}
+
+// blockStyle switches a tree parsed from JSON to block YAML, writing multi-line
+// strings as literal blocks
+func blockStyle(node *yaml.Node) {
+	if node.Style&yaml.FlowStyle != 0 {
+		node.Style &^= yaml.FlowStyle
+	}
+	if node.Kind == yaml.ScalarNode && node.Style&yaml.DoubleQuotedStyle != 0 {
+		node.Style = 0
+		if strings.Contains(node.Value, "\n") {
+			node.Style = yaml.LiteralStyle
+		}
+	}
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// writeJSON writes a document tree as indented JSON, keeping key order
+func writeJSON(buf *bytes.Buffer, node *yaml.Node, indent string) error {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		if len(node.Content) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		buf.WriteString("{\n")
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			buf.WriteString(indent + "  ")
+			if err := writeJSONValue(buf, node.Content[i].Value); err != nil {
+				return err
+			}
+			buf.WriteString(": ")
+			if err := writeJSON(buf, node.Content[i+1], indent+"  "); err != nil {
+				return err
+			}
+			if i+2 < len(node.Content) {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(indent + "}")
+	case yaml.SequenceNode:
+		if len(node.Content) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+		buf.WriteString("[\n")
+		for i, item := range node.Content {
+			buf.WriteString(indent + "  ")
+			if err := writeJSON(buf, item, indent+"  "); err != nil {
+				return err
+			}
+			if i+1 < len(node.Content) {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(indent + "]")
+	case yaml.ScalarNode:
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return err
+		}
+		return writeJSONValue(buf, value)
+	default:
+		return fmt.Errorf("unsupported YAML node at line %d", node.Line)
+	}
+	return nil
+}
+
+// writeJSONValue writes a scalar without escaping HTML characters, which are common in scripts
+func writeJSONValue(buf *bytes.Buffer, value interface{}) error {
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return err
+	}
+	buf.Write(bytes.TrimRight(encoded.Bytes(), "\n"))
+	return nil
+}
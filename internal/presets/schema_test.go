@@ -0,0 +1,167 @@
+package presets
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSchemaVersionOf(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		want    int
+		wantErr string
+	}{
+		{"missing means version 1", `{"name": "x"}`, 1, ""},
+		{"snake_case key", `{"schema_version": 2}`, 2, ""},
+		{"camelCase key", `{"schemaVersion": 2}`, 2, ""},
+		{"both keys agreeing", `{"schema_version": 2, "schemaVersion": 2}`, 2, ""},
+		{"both keys disagreeing", `{"schema_version": 2, "schemaVersion": 1}`, 0, "disagree"},
+		{"not a number", `{"schema_version": "two"}`, 0, "positive integer"},
+		{"zero", `{"schema_version": 0}`, 0, "positive integer"},
+		{"not a scalar", `{"schema_version": [2]}`, 0, "positive integer"},
+	}
+
+	for _, tt := range tests {
+		doc, err := parseDocument([]byte(tt.doc))
+		if err != nil {
+			t.Fatalf("%s: parseDocument: %v", tt.name, err)
+		}
+		got, err := schemaVersionOf(doc)
+		switch {
+		case tt.wantErr != "":
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error = %v, want it to contain %q", tt.name, err, tt.wantErr)
+			}
+		case err != nil:
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		case got != tt.want:
+			t.Errorf("%s: version = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMigratePreset(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		format      string
+		want        string
+		wantApplied int
+	}{
+		{
+			name:        "version 1 JSON gains schema_version first",
+			input:       `{"name": "x", "tasks": []}`,
+			format:      FormatJSON,
+			want:        "{\n  \"schema_version\": 3,\n  \"name\": \"x\",\n  \"tasks\": []\n}\n",
+			wantApplied: 2,
+		},
+		{
+			name:        "current version is left alone",
+			input:       `{"schema_version": 3, "name": "x"}`,
+			format:      FormatJSON,
+			want:        "{\n  \"schema_version\": 3,\n  \"name\": \"x\"\n}\n",
+			wantApplied: 0,
+		},
+		{
+			name:        "camelCase key is renamed in place",
+			input:       `{"name": "x", "schemaVersion": 3}`,
+			format:      FormatJSON,
+			want:        "{\n  \"name\": \"x\",\n  \"schema_version\": 3\n}\n",
+			wantApplied: 0,
+		},
+		{
+			name:        "duplicate camelCase key is dropped",
+			input:       `{"schema_version": 1, "schemaVersion": 1, "name": "x"}`,
+			format:      FormatJSON,
+			want:        "{\n  \"schema_version\": 3,\n  \"name\": \"x\"\n}\n",
+			wantApplied: 2,
+		},
+		{
+			name:        "YAML comments survive",
+			input:       "# heading\nname: x # inline\ntasks: []\n",
+			format:      FormatYAML,
+			want:        "# heading\nschema_version: 3\nname: x # inline\ntasks: []\n",
+			wantApplied: 2,
+		},
+		{
+			name:        "JSON converts to block YAML",
+			input:       `{"schema_version": 3, "name": "x", "tags": ["a", "b"]}`,
+			format:      FormatYAML,
+			want:        "schema_version: 3\nname: x\ntags:\n  - a\n  - b\n",
+			wantApplied: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		got, applied, err := MigratePreset([]byte(tt.input), tt.format)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: output =\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+		if len(applied) != tt.wantApplied {
+			t.Errorf("%s: applied %d migrations (%v), want %d", tt.name, len(applied), applied, tt.wantApplied)
+		}
+	}
+}
+
+func TestMigrateKeyCase(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"preset keys", `{"Name": "x", "Description": "d"}`, "\"name\": \"x\",\n  \"description\": \"d\""},
+		{"task keys", `{"name": "x", "Tasks": [{"Name": "t", "Type": "command", "Commands": ["true"]}]}`, "\"name\": \"t\",\n      \"type\": \"command\",\n      \"commands\": ["},
+		{"nested tasks", `{"name": "x", "tasks": [{"name": "b", "type": "block", "Block": [{"Name": "t"}]}]}`, "\"block\": [\n        {\n          \"name\": \"t\""},
+		{"variables", `{"name": "x", "Variables": [{"Name": "v", "Default": 1}]}`, "\"variables\": [\n    {\n      \"name\": \"v\",\n      \"default\": 1"},
+		{"canonical spelling wins", `{"name": "x", "Name": "y"}`, "\"name\": \"x\",\n  \"Name\": \"y\""},
+	}
+
+	for _, tt := range tests {
+		got, _, err := MigratePreset([]byte(tt.input), FormatJSON)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if !strings.Contains(string(got), tt.want) {
+			t.Errorf("%s: output =\n%s\nwant it to contain\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMigratePresetRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		format string
+		want   string
+	}{
+		{"newer schema", `{"schema_version": 99}`, FormatJSON, "please upgrade"},
+		{"not an object", `["x"]`, FormatJSON, "expected an object"},
+		{"unknown format", `{"name": "x"}`, "toml", "unknown preset format"},
+	}
+
+	for _, tt := range tests {
+		_, _, err := MigratePreset([]byte(tt.input), tt.format)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want it to contain %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestDecodePresetWarnsOnMigration(t *testing.T) {
+	preset, err := DecodePreset([]byte(`{"name": "x", "schemaVersion": 1, "tasks": []}`))
+	if err != nil {
+		t.Fatalf("DecodePreset: %v", err)
+	}
+	if preset.SchemaVersion != CurrentSchemaVersion {
+		t.Errorf("SchemaVersion = %d, want %d", preset.SchemaVersion, CurrentSchemaVersion)
+	}
+	if len(preset.Warnings) == 0 || !strings.Contains(preset.Warnings[0], "migrate-preset") {
+		t.Errorf("Warnings = %v, want a migrate-preset hint", preset.Warnings)
+	}
+}
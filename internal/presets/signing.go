@@ -0,0 +1,307 @@
+package presets
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SignatureExt is appended to a preset file name to form its detached signature
+const SignatureExt = ".sig"
+
+// allowUnsigned lets presets without a signature load, with a warning
+var allowUnsigned = false
+
+// SetAllowUnsigned sets whether presets without a signature may be loaded.
+// Presets whose signature does not verify are refused either way.
+func SetAllowUnsigned(allow bool) {
+	allowUnsigned = allow
+}
+
+// ErrUnsigned is returned when a preset file has no signature and unsigned
+// presets are not allowed
+var ErrUnsigned = errors.New("preset is not signed; sign it with 'preset sign' or pass --allow-unsigned")
+
+// TrustedKey is a public key whose signatures are accepted
+type TrustedKey struct {
+	Key     ed25519.PublicKey
+	Comment string
+}
+
+// ID returns a short fingerprint identifying the key in signature files
+func (k TrustedKey) ID() string {
+	return KeyID(k.Key)
+}
+
+// Name returns the key's comment, or its ID when it has none
+func (k TrustedKey) Name() string {
+	if k.Comment != "" {
+		return k.Comment
+	}
+	return k.ID()
+}
+
+// KeyID returns the fingerprint of a public key: the first 8 bytes of its sha256
+func KeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// EncodePublicKey returns the text form of a public key used in the trusted keys file
+func EncodePublicKey(key ed25519.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// TrustedKeysFile returns the path of the trusted keys file. Each line holds a
+// base64 public key followed by an optional comment; lines starting with # are ignored.
+func TrustedKeysFile() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "trusted_keys"), nil
+}
+
+// SigningKeyFile returns the default path of the local signing key
+func SigningKeyFile() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "signing.key"), nil
+}
+
+// LoadTrustedKeys reads the trusted keys file; a missing file trusts no keys
+func LoadTrustedKeys() ([]TrustedKey, error) {
+	path, err := TrustedKeysFile()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trusted keys: %v", err)
+	}
+
+	keys := make([]TrustedKey, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.SplitN(text, " ", 2)
+		key, err := ParsePublicKey(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		trusted := TrustedKey{Key: key}
+		if len(fields) == 2 {
+			trusted.Comment = strings.TrimSpace(fields[1])
+		}
+		keys = append(keys, trusted)
+	}
+	return keys, nil
+}
+
+// ParsePublicKey decodes a base64 ed25519 public key
+func ParsePublicKey(text string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(text)
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key %q", text)
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// TrustKey adds a public key to the trusted keys file, doing nothing if it is
+// already trusted
+func TrustKey(key ed25519.PublicKey, comment string) error {
+	keys, err := LoadTrustedKeys()
+	if err != nil {
+		return err
+	}
+	for _, trusted := range keys {
+		if trusted.Key.Equal(key) {
+			return nil
+		}
+	}
+
+	path, err := TrustedKeysFile()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create configuration directory: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open trusted keys: %v", err)
+	}
+	defer file.Close()
+
+	line := EncodePublicKey(key)
+	if comment != "" {
+		line += " " + comment
+	}
+	if _, err := fmt.Fprintln(file, line); err != nil {
+		return fmt.Errorf("failed to write trusted keys: %v", err)
+	}
+	return nil
+}
+
+// LoadSigningKey reads a private key file holding a base64 ed25519 seed
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %v", err)
+	}
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid signing key %s", path)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// GenerateSigningKey creates a new private key file readable only by its owner
+func GenerateSigningKey(path string) (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create key directory: %v", err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(key.Seed()) + "\n"
+	if err := os.WriteFile(path, []byte(encoded), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write signing key: %v", err)
+	}
+	return key, nil
+}
+
+// LocalSigningKey loads a signing key, generating it and trusting its public key
+// when the file does not exist yet. An empty path selects SigningKeyFile.
+func LocalSigningKey(path string) (key ed25519.PrivateKey, generated bool, err error) {
+	if path == "" {
+		if path, err = SigningKeyFile(); err != nil {
+			return nil, false, err
+		}
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		key, err := LoadSigningKey(path)
+		return key, false, err
+	}
+
+	key, err = GenerateSigningKey(path)
+	if err == nil {
+		err = TrustKey(key.Public().(ed25519.PublicKey), "local signing key")
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create signing key: %v", err)
+	}
+	return key, true, nil
+}
+
+// SignPresetFile writes the detached signature of a preset file, refusing presets
+// that would not load
+func SignPresetFile(key ed25519.PrivateKey, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read preset: %v", err)
+	}
+	preset, err := DecodePreset(data)
+	if err == nil {
+		err = preset.Validate()
+	}
+	if err != nil {
+		return fmt.Errorf("refusing to sign invalid preset %s: %v", path, err)
+	}
+
+	if err := os.WriteFile(path+SignatureExt, SignPreset(key, data), 0644); err != nil {
+		return fmt.Errorf("failed to write signature: %v", err)
+	}
+	return nil
+}
+
+// SignPreset returns the detached signature of a preset file's content: one line
+// holding the signing key's ID and the base64 signature
+func SignPreset(key ed25519.PrivateKey, data []byte) []byte {
+	public := key.Public().(ed25519.PublicKey)
+	signature := ed25519.Sign(key, data)
+	return []byte(fmt.Sprintf("%s %s\n", KeyID(public), base64.StdEncoding.EncodeToString(signature)))
+}
+
+// VerifySignature checks a preset's content against its detached signature,
+// returning the trusted key that signed it. A signature file may hold several
+// lines; one signature from a trusted key is enough.
+func VerifySignature(data, signature []byte, keys []TrustedKey) (*TrustedKey, error) {
+	lines := 0
+	scanner := bufio.NewScanner(bytes.NewReader(signature))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		lines++
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("malformed signature line %q", scanner.Text())
+		}
+		raw, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("malformed signature: %v", err)
+		}
+		for i := range keys {
+			if keys[i].ID() == fields[0] {
+				if !ed25519.Verify(keys[i].Key, data, raw) {
+					return nil, fmt.Errorf("signature by %s does not match the preset content", keys[i].Name())
+				}
+				return &keys[i], nil
+			}
+		}
+	}
+	if lines == 0 {
+		return nil, fmt.Errorf("empty signature")
+	}
+	return nil, fmt.Errorf("not signed by a trusted key; add the signer with 'preset trust <public-key>'")
+}
+
+// VerifyPreset checks a preset's content against its detached signature, which is
+// nil when the preset has none. It returns the name of the signer, or "" for an
+// unsigned preset when those are allowed.
+func VerifyPreset(data, signature []byte) (string, error) {
+	if signature == nil {
+		if allowUnsigned {
+			return "", nil
+		}
+		return "", ErrUnsigned
+	}
+
+	keys, err := LoadTrustedKeys()
+	if err != nil {
+		return "", err
+	}
+	signer, err := VerifySignature(data, signature, keys)
+	if err != nil {
+		return "", fmt.Errorf("signature check failed: %v", err)
+	}
+	return signer.Name(), nil
+}
+
+// verifyPresetFile checks the detached signature next to a preset file
+func verifyPresetFile(path string, data []byte) (string, error) {
+	signature, err := os.ReadFile(path + SignatureExt)
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read signature: %v", err)
+	}
+	return VerifyPreset(data, signature)
+}
@@ -0,0 +1,156 @@
+package presets
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const signedPreset = `{"schema_version": 3, "name": "Signed", "description": "d", "tasks": [{"name": "Noop", "type": "command", "commands": ["true"]}]}
+`
+
+// newKey generates a signing key and its trusted form
+func newKey(t *testing.T, comment string) (ed25519.PrivateKey, TrustedKey) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return private, TrustedKey{Key: public, Comment: comment}
+}
+
+func TestVerifySignature(t *testing.T) {
+	trustedPrivate, trusted := newKey(t, "trusted")
+	otherPrivate, _ := newKey(t, "other")
+	data := []byte(signedPreset)
+	keys := []TrustedKey{trusted}
+
+	valid := SignPreset(trustedPrivate, data)
+	untrusted := SignPreset(otherPrivate, data)
+	id, _, _ := strings.Cut(string(valid), " ")
+
+	tests := []struct {
+		name      string
+		data      []byte
+		signature []byte
+		want      string // error substring, "" for success
+	}{
+		{"valid", data, valid, ""},
+		{"valid after an untrusted line", data, append(untrusted, valid...), ""},
+		{"blank lines are skipped", data, append([]byte("\n\n"), valid...), ""},
+		{"tampered body", []byte(strings.Replace(signedPreset, "true", "false", 1)), valid, "does not match"},
+		{"untrusted key", data, untrusted, "not signed by a trusted key"},
+		{"empty", data, []byte("\n"), "empty signature"},
+		{"missing signature field", data, []byte(id + "\n"), "malformed signature line"},
+		{"extra field", data, []byte(strings.TrimSpace(string(valid)) + " extra\n"), "malformed signature line"},
+		{"invalid base64", data, []byte(id + " !!!\n"), "malformed signature"},
+		{"truncated signature", data, []byte(id + " " + base64.StdEncoding.EncodeToString([]byte("short")) + "\n"), "does not match"},
+	}
+
+	for _, tt := range tests {
+		signer, err := VerifySignature(tt.data, tt.signature, keys)
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.name, err)
+			} else if signer.Name() != "trusted" {
+				t.Errorf("%s: signer = %s, want trusted", tt.name, signer.Name())
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want it to contain %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestVerifyPresetFile(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Cleanup(func() { SetAllowUnsigned(false) })
+
+	private, trusted := newKey(t, "team")
+	if err := TrustKey(trusted.Key, trusted.Comment); err != nil {
+		t.Fatal(err)
+	}
+	otherPrivate, _ := newKey(t, "other")
+
+	dir := t.TempDir()
+	write := func(name, content string, signature []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if signature != nil {
+			if err := os.WriteFile(path+SignatureExt, signature, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return path
+	}
+
+	signed := write("signed.json", signedPreset, SignPreset(private, []byte(signedPreset)))
+	tampered := write("tampered.json", strings.Replace(signedPreset, "Signed", "Tampered", 1), SignPreset(private, []byte(signedPreset)))
+	untrusted := write("untrusted.json", signedPreset, SignPreset(otherPrivate, []byte(signedPreset)))
+	malformed := write("malformed.json", signedPreset, []byte("not a signature line\n"))
+	unsigned := write("unsigned.json", signedPreset, nil)
+
+	for _, allow := range []bool{false, true} {
+		SetAllowUnsigned(allow)
+
+		preset, err := LoadPresetFile(signed)
+		if err != nil || preset.SignedBy != "team" {
+			t.Errorf("allow=%v: signed preset: %v, %v", allow, preset, err)
+		}
+
+		// A bad signature is refused even when unsigned presets are allowed
+		for path, want := range map[string]string{
+			tampered:  "does not match",
+			untrusted: "not signed by a trusted key",
+			malformed: "malformed signature line",
+		} {
+			if _, err := LoadPresetFile(path); err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("allow=%v: %s: error = %v, want it to contain %q", allow, filepath.Base(path), err, want)
+			}
+		}
+
+		preset, err = LoadPresetFile(unsigned)
+		if allow {
+			if err != nil || preset.SignedBy != "" || len(preset.Warnings) == 0 {
+				t.Errorf("allow=true: unsigned preset: %v, %v", preset, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), ErrUnsigned.Error()) {
+			t.Errorf("allow=false: unsigned preset: error = %v, want %v", err, ErrUnsigned)
+		}
+	}
+}
+
+func TestLoadTrustedKeys(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	keys, err := LoadTrustedKeys()
+	if err != nil || len(keys) != 0 {
+		t.Fatalf("missing trusted keys file: %v, %v", keys, err)
+	}
+
+	_, trusted := newKey(t, "")
+	for i := 0; i < 2; i++ {
+		if err := TrustKey(trusted.Key, "alice laptop"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys, err = LoadTrustedKeys()
+	if err != nil || len(keys) != 1 || keys[0].Comment != "alice laptop" {
+		t.Errorf("LoadTrustedKeys() = %v, %v; want the key once with its comment", keys, err)
+	}
+
+	path, _ := TrustedKeysFile()
+	if err := os.WriteFile(path, []byte("# comment\n\nnot-base64\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTrustedKeys(); err == nil || !strings.Contains(err.Error(), ":3:") {
+		t.Errorf("invalid key line: error = %v, want the line number", err)
+	}
+}
@@ -0,0 +1,100 @@
+package presets
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs are the helper functions available inside preset templates
+var templateFuncs = template.FuncMap{
+	"join": func(sep string, items interface{}) string {
+		return strings.Join(toStrings(items), sep)
+	},
+	"quote": func(value interface{}) string {
+		return "'" + strings.ReplaceAll(fmt.Sprint(value), "'", `'\''`) + "'"
+	},
+}
+
+// RenderString expands a template string against the given scope.
+// Strings without template actions are returned unchanged.
+func RenderString(text string, scope map[string]interface{}) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := template.New("preset").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template: %v", err)
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, scope); err != nil {
+		return "", fmt.Errorf("failed to render template: %v", err)
+	}
+	return out.String(), nil
+}
+
+// EscapeTemplate quotes template delimiters in literal text, such as a copied
+// configuration file, so RenderString returns it unchanged
+func EscapeTemplate(text string) string {
+	return strings.ReplaceAll(text, "{{", `{{"{{"}}`)
+}
+
+// RenderTask returns a copy of the task with templates in its name, description,
+// commands and script expanded against the given scope
+func RenderTask(task Task, scope map[string]interface{}) (Task, error) {
+	var err error
+	rendered := task
+
+	if rendered.Name, err = RenderString(task.Name, scope); err != nil {
+		return task, fmt.Errorf("name: %v", err)
+	}
+	if rendered.Description, err = RenderString(task.Description, scope); err != nil {
+		return task, fmt.Errorf("description: %v", err)
+	}
+	if rendered.Script, err = RenderString(task.Script, scope); err != nil {
+		return task, fmt.Errorf("script: %v", err)
+	}
+
+	fields := map[string]*string{
+		"path":    &rendered.Path,
+		"mode":    &rendered.Mode,
+		"owner":   &rendered.Owner,
+		"group":   &rendered.Group,
+		"content": &rendered.Content,
+		"service": &rendered.Service,
+	}
+	for _, name := range []string{"path", "mode", "owner", "group", "content", "service"} {
+		if *fields[name], err = RenderString(*fields[name], scope); err != nil {
+			return task, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+
+	rendered.Commands = make([]string, len(task.Commands))
+	for i, command := range task.Commands {
+		if rendered.Commands[i], err = RenderString(command, scope); err != nil {
+			return task, fmt.Errorf("command %d: %v", i+1, err)
+		}
+	}
+
+	return rendered, nil
+}
+
+// toStrings converts a template list value to a string slice
+func toStrings(items interface{}) []string {
+	switch list := items.(type) {
+	case []string:
+		return list
+	case []interface{}:
+		out := make([]string, 0, len(list))
+		for _, item := range list {
+			out = append(out, fmt.Sprint(item))
+		}
+		return out
+	case nil:
+		return nil
+	default:
+		return []string{fmt.Sprint(list)}
+	}
+}
@@ -0,0 +1,185 @@
+package presets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"base-linux-setup/internal/detector"
+	"base-linux-setup/internal/expr"
+)
+
+// ProvenanceFile records where the presets in a source directory came from
+const ProvenanceFile = ".source.json"
+
+// Provenance describes the remote source a preset was fetched from and the exact
+// version pinned
+type Provenance struct {
+	Source    string            `json:"source"`        // name of the source directory
+	URL       string            `json:"url"`           // git repository or HTTPS URL
+	Kind      string            `json:"kind"`          // "git" or "https"
+	Ref       string            `json:"ref,omitempty"` // git branch or tag followed by updates
+	Pin       string            `json:"pin"`           // git commit, or "sha256:<hex>" of an HTTPS download
+	Locked    bool              `json:"locked,omitempty"`
+	Files     map[string]string `json:"files"` // preset file name → sha256 of its content
+	FetchedAt time.Time         `json:"fetched_at"`
+}
+
+// String summarizes the provenance on one line
+func (p Provenance) String() string {
+	pin := p.Pin
+	if p.Kind == "git" && len(pin) > 12 {
+		pin = pin[:12]
+	}
+	description := fmt.Sprintf("%s (%s @ %s", p.Source, p.URL, pin)
+	if p.Locked {
+		description += ", locked"
+	}
+	return description + ")"
+}
+
+// ConfigDir returns the base-linux-setup configuration directory
+func ConfigDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate the configuration directory: %v", err)
+	}
+	return filepath.Join(dir, "base-linux-setup"), nil
+}
+
+// UserPresetDir returns the directory holding user presets. Preset files placed
+// directly in it are local presets; each subdirectory holds a fetched source.
+func UserPresetDir() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "presets"), nil
+}
+
+// IsPresetFile reports whether a file name has a preset extension
+func IsPresetFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".yaml", ".yml":
+		return !strings.HasPrefix(name, ".")
+	}
+	return false
+}
+
+// FileDigest returns the hex sha256 of data
+func FileDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadUserPresets loads local presets and fetched sources from the user preset
+// directory. Presets that fail to load are reported as errors and skipped.
+func LoadUserPresets() ([]*Preset, []error) {
+	dir, err := UserPresetDir()
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, []error{fmt.Errorf("failed to read %s: %v", dir, err)}
+	}
+
+	loaded := make([]*Preset, 0)
+	errs := make([]error, 0)
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if entry.IsDir() {
+			sourcePresets, sourceErrs := loadSource(path)
+			loaded = append(loaded, sourcePresets...)
+			errs = append(errs, sourceErrs...)
+			continue
+		}
+		if !IsPresetFile(entry.Name()) {
+			continue
+		}
+		preset, err := LoadPresetFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		preset.Path = path
+		loaded = append(loaded, preset)
+	}
+	return loaded, errs
+}
+
+// ReadProvenance reads the provenance record of a source directory
+func ReadProvenance(dir string) (*Provenance, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ProvenanceFile))
+	if err != nil {
+		return nil, fmt.Errorf("source %s has no provenance record: %v", filepath.Base(dir), err)
+	}
+	var provenance Provenance
+	if err := json.Unmarshal(data, &provenance); err != nil {
+		return nil, fmt.Errorf("source %s has an invalid provenance record: %v", filepath.Base(dir), err)
+	}
+	return &provenance, nil
+}
+
+// loadSource loads the presets of a fetched source, refusing files whose content
+// no longer matches the digest recorded when they were fetched
+func loadSource(dir string) ([]*Preset, []error) {
+	provenance, err := ReadProvenance(dir)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	names := make([]string, 0, len(provenance.Files))
+	for name := range provenance.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	loaded := make([]*Preset, 0, len(names))
+	errs := make([]error, 0)
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("source %s: %v", provenance.Source, err))
+			continue
+		}
+		if FileDigest(data) != provenance.Files[name] {
+			errs = append(errs, fmt.Errorf("source %s: %s was modified after it was fetched; run 'preset update %s'", provenance.Source, name, provenance.Source))
+			continue
+		}
+
+		preset, err := LoadPresetFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("source %s: %v", provenance.Source, err))
+			continue
+		}
+		preset.Path = path
+		preset.Source = provenance
+		loaded = append(loaded, preset)
+	}
+	return loaded, errs
+}
+
+// Matches reports whether the preset's match expression selects the environment.
+// Presets without one never match automatically.
+func (p *Preset) Matches(env *detector.Environment) bool {
+	if p.Match == "" {
+		return false
+	}
+	matched, err := expr.EvalBool(p.Match, env.Facts())
+	return err == nil && matched
+}
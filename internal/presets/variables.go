@@ -0,0 +1,367 @@
+package presets
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"base-linux-setup/internal/detector"
+)
+
+// Variable declares a typed preset variable that tasks reference via templates
+type Variable struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Type        string      `json:"type,omitempty"` // see variableTypes
+	Default     interface{} `json:"default,omitempty"`
+	Prompt      bool        `json:"prompt,omitempty"`  // ask interactively even when a default exists
+	Choices     []string    `json:"choices,omitempty"` // allowed values for enum variables
+	Pattern     string      `json:"pattern,omitempty"` // optional regular expression the value must match
+}
+
+// variableTypes lists the supported variable types
+var variableTypes = []string{"string", "int", "bool", "list", "ip", "cidr", "hostname", "port", "enum", "secret"}
+
+// hostnamePattern matches RFC 1123 host names
+var hostnamePattern = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*$`)
+
+// variableNamePattern restricts names to identifiers usable as {{ .name }}
+var variableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validateVariables checks variable declarations for a preset
+func validateVariables(vars []Variable) error {
+	seen := make(map[string]bool)
+	for _, v := range vars {
+		if !variableNamePattern.MatchString(v.Name) {
+			return fmt.Errorf("invalid variable name %q", v.Name)
+		}
+		if seen[v.Name] {
+			return fmt.Errorf("duplicate variable %q", v.Name)
+		}
+		seen[v.Name] = true
+
+		for _, fact := range detector.FactNames {
+			if v.Name == fact {
+				return fmt.Errorf("variable %q shadows the detected fact of the same name", v.Name)
+			}
+		}
+
+		if !contains(variableTypes, v.typeName()) {
+			return fmt.Errorf("variable %q has unknown type %q", v.Name, v.Type)
+		}
+		if v.Type == "enum" && len(v.Choices) == 0 {
+			return fmt.Errorf("enum variable %q declares no choices", v.Name)
+		}
+		if v.Pattern != "" {
+			if _, err := regexp.Compile(v.Pattern); err != nil {
+				return fmt.Errorf("variable %q has an invalid pattern: %v", v.Name, err)
+			}
+		}
+
+		if v.Default != nil {
+			if _, err := v.Convert(v.Default); err != nil {
+				return fmt.Errorf("invalid default for variable %q: %v", v.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateRegister checks that a task's register name is usable and does not
+// hide a declared variable or detected fact
+func (p *Preset) validateRegister(task Task) error {
+	if !variableNamePattern.MatchString(task.Register) {
+		return fmt.Errorf("task %q has an invalid register name %q", task.Name, task.Register)
+	}
+	if _, ok := p.FindVariable(task.Register); ok || contains(detector.FactNames, task.Register) || task.Register == FailedTaskVariable {
+		return fmt.Errorf("task %q registers %q, which is already a variable or fact", task.Name, task.Register)
+	}
+	return nil
+}
+
+// Convert coerces a raw value (from JSON, a vars file, --set or a prompt) to the
+// variable's type and validates it
+func (v Variable) Convert(raw interface{}) (interface{}, error) {
+	value, err := v.convert(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if v.Pattern != "" {
+		if matched, _ := regexp.MatchString(v.Pattern, FormatValue(value)); !matched {
+			return nil, fmt.Errorf("value does not match pattern %s", v.Pattern)
+		}
+	}
+
+	return value, nil
+}
+
+// convert performs the type-specific conversion for Convert
+func (v Variable) convert(raw interface{}) (interface{}, error) {
+	switch v.Type {
+	case "ip", "cidr", "hostname", "enum":
+		text, ok := raw.(string)
+		if !ok {
+			break
+		}
+		text = strings.TrimSpace(text)
+		return text, v.validateText(text)
+	case "port":
+		port, err := Variable{Type: "int"}.convert(raw)
+		if err != nil {
+			return nil, err
+		}
+		if n := port.(int); n < 1 || n > 65535 {
+			return nil, fmt.Errorf("port must be between 1 and 65535, got %d", n)
+		}
+		return port, nil
+	case "", "string", "secret":
+		switch value := raw.(type) {
+		case string:
+			return value, nil
+		case float64, bool:
+			return fmt.Sprint(value), nil
+		}
+	case "int":
+		switch value := raw.(type) {
+		case float64:
+			if value != float64(int(value)) {
+				return nil, fmt.Errorf("expected an integer, got %v", value)
+			}
+			return int(value), nil
+		case int:
+			return value, nil
+		case string:
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("expected an integer, got %q", value)
+			}
+			return n, nil
+		}
+	case "bool":
+		switch value := raw.(type) {
+		case bool:
+			return value, nil
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("expected true or false, got %q", value)
+			}
+			return b, nil
+		}
+	case "list":
+		switch value := raw.(type) {
+		case []interface{}:
+			items := make([]interface{}, 0, len(value))
+			for _, item := range value {
+				items = append(items, fmt.Sprint(item))
+			}
+			return items, nil
+		case string:
+			items := make([]interface{}, 0)
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			return items, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown variable type: %s", v.Type)
+	}
+
+	return nil, fmt.Errorf("cannot use %v as %s", raw, v.typeName())
+}
+
+// validateText checks string values of the network and enum types
+func (v Variable) validateText(text string) error {
+	switch v.Type {
+	case "ip":
+		if net.ParseIP(text) == nil {
+			return fmt.Errorf("%q is not a valid IP address", text)
+		}
+	case "cidr":
+		if _, _, err := net.ParseCIDR(text); err != nil {
+			return fmt.Errorf("%q is not a valid CIDR (e.g. 192.168.1.0/24)", text)
+		}
+	case "hostname":
+		if len(text) > 253 || !hostnamePattern.MatchString(text) {
+			return fmt.Errorf("%q is not a valid host name", text)
+		}
+	case "enum":
+		if !contains(v.Choices, text) {
+			return fmt.Errorf("%q is not one of %s", text, strings.Join(v.Choices, ", "))
+		}
+	}
+	return nil
+}
+
+// IsSecret reports whether the variable's value must not be displayed
+func (v Variable) IsSecret() bool {
+	return v.Type == "secret"
+}
+
+// DisplayValue formats a resolved value for output, masking secrets
+func (v Variable) DisplayValue(value interface{}) string {
+	if v.IsSecret() {
+		return "********"
+	}
+	return FormatValue(value)
+}
+
+// typeName returns the variable type with the implicit default applied
+func (v Variable) typeName() string {
+	if v.Type == "" {
+		return "string"
+	}
+	return v.Type
+}
+
+// FormatValue renders a resolved value the way a user would type it
+func FormatValue(value interface{}) string {
+	if items, ok := value.([]interface{}); ok {
+		parts := make([]string, 0, len(items))
+		for _, item := range items {
+			parts = append(parts, fmt.Sprint(item))
+		}
+		return strings.Join(parts, ",")
+	}
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// FindVariable returns the declared variable with the given name
+func (p *Preset) FindVariable(name string) (Variable, bool) {
+	for _, v := range p.Variables {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return Variable{}, false
+}
+
+// PromptableVariables returns the variables that still need a value from the user:
+// those without a value or default, and those marked for prompting.
+func (p *Preset) PromptableVariables(values map[string]interface{}) []Variable {
+	pending := make([]Variable, 0)
+	for _, v := range p.Variables {
+		if _, ok := values[v.Name]; ok {
+			continue
+		}
+		if v.Default == nil || v.Prompt {
+			pending = append(pending, v)
+		}
+	}
+	return pending
+}
+
+// ResolveVariables merges provided values with defaults and converts them to their declared types
+func (p *Preset) ResolveVariables(values map[string]interface{}) (map[string]interface{}, error) {
+	for name := range values {
+		if _, ok := p.FindVariable(name); !ok {
+			return nil, fmt.Errorf("unknown variable %q for preset %s", name, p.Name)
+		}
+	}
+
+	resolved := make(map[string]interface{}, len(p.Variables))
+	for _, v := range p.Variables {
+		raw, ok := values[v.Name]
+		if !ok {
+			raw = v.Default
+		}
+		if raw == nil {
+			return nil, fmt.Errorf("variable %q has no value", v.Name)
+		}
+
+		value, err := v.Convert(raw)
+		if err != nil {
+			return nil, fmt.Errorf("variable %q: %v", v.Name, err)
+		}
+		resolved[v.Name] = value
+	}
+
+	return resolved, nil
+}
+
+// ParseSetValues parses --set key=value arguments into a value map
+func ParseSetValues(args []string) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(args))
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --set value %q, expected key=value", arg)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// LoadVarsFile reads variable values from a JSON object file
+func LoadVarsFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vars file: %v", err)
+	}
+
+	values := make(map[string]interface{})
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse vars file %s: %v", path, err)
+	}
+
+	return values, nil
+}
+
+// MissingVariables returns the names of variables that have neither a value nor a default
+func (p *Preset) MissingVariables(values map[string]interface{}) []string {
+	missing := make([]string, 0)
+	for _, v := range p.Variables {
+		if _, ok := values[v.Name]; !ok && v.Default == nil {
+			missing = append(missing, v.Name)
+		}
+	}
+	return missing
+}
+
+// SecretValues returns the resolved values of secret variables so output can be redacted
+func (p *Preset) SecretValues(values map[string]interface{}) []string {
+	secrets := make([]string, 0)
+	for _, v := range p.Variables {
+		if value, ok := values[v.Name]; ok && v.IsSecret() {
+			if text := FormatValue(value); text != "" {
+				secrets = append(secrets, text)
+			}
+		}
+	}
+	return secrets
+}
+
+// contains checks if a slice contains a string
+func contains(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
+
+// NewScope builds the data available to templates from detected facts and resolved variables
+func NewScope(env *detector.Environment, vars map[string]interface{}) map[string]interface{} {
+	scope := make(map[string]interface{})
+	if env != nil {
+		for key, value := range env.Facts() {
+			scope[key] = value
+		}
+	}
+	for key, value := range vars {
+		scope[key] = value
+	}
+	return scope
+}
@@ -0,0 +1,428 @@
+// Package sources fetches shared preset bundles from git repositories and HTTPS
+// URLs into the user preset directory, pinning each to the exact commit or
+// content digest fetched.
+package sources
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"base-linux-setup/internal/presets"
+)
+
+// Source kinds
+const (
+	KindGit   = "git"
+	KindHTTPS = "https"
+)
+
+// namePattern restricts source names to safe directory names
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// httpClient fetches HTTPS sources
+var httpClient = &http.Client{Timeout: 60 * time.Second}
+
+// AddOptions configures a new source
+type AddOptions struct {
+	Name   string // directory name, derived from the URL when empty
+	Ref    string // git branch or tag to follow
+	Commit string // git commit to lock the source to
+	SHA256 string // expected digest of an HTTPS download, locking the source to it
+}
+
+// bundle is the set of preset files fetched from a source
+type bundle struct {
+	pin        string
+	files      map[string][]byte
+	signatures map[string][]byte // detached signatures by preset file name
+}
+
+// KindOf returns how a source URL is fetched: single preset files over HTTPS
+// are downloaded, anything else is cloned with git
+func KindOf(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err == nil && parsed.Scheme == "https" && presets.IsPresetFile(path.Base(parsed.Path)) {
+		return KindHTTPS
+	}
+	return KindGit
+}
+
+// checkSource rejects source URLs and git refs that are unsafe to fetch: plain
+// http, which anyone on the path can tamper with, and values git would take for
+// options
+func checkSource(rawURL, ref, commit string) error {
+	if parsed, err := url.Parse(rawURL); err == nil && strings.EqualFold(parsed.Scheme, "http") {
+		return fmt.Errorf("%s is served over plain http; use https", rawURL)
+	}
+	if strings.HasPrefix(ref, "-") {
+		return fmt.Errorf("invalid git ref %q", ref)
+	}
+	if strings.HasPrefix(commit, "-") {
+		return fmt.Errorf("invalid git commit %q", commit)
+	}
+	return nil
+}
+
+// Add fetches a new source into the user preset directory
+func Add(rawURL string, opts AddOptions) (*presets.Provenance, error) {
+	name := opts.Name
+	if name == "" {
+		name = nameFromURL(rawURL)
+	}
+	if !namePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid source name %q; choose one with --name", name)
+	}
+	if err := checkSource(rawURL, opts.Ref, opts.Commit); err != nil {
+		return nil, err
+	}
+
+	dir, err := sourceDir(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return nil, fmt.Errorf("source %s already exists; use 'preset update %s' or choose another --name", name, name)
+	}
+
+	provenance := &presets.Provenance{
+		Source: name,
+		URL:    rawURL,
+		Kind:   KindOf(rawURL),
+		Ref:    opts.Ref,
+	}
+	switch provenance.Kind {
+	case KindHTTPS:
+		if opts.Ref != "" || opts.Commit != "" {
+			return nil, fmt.Errorf("--ref and --commit only apply to git sources")
+		}
+		if opts.SHA256 != "" {
+			provenance.Pin = "sha256:" + strings.ToLower(strings.TrimPrefix(opts.SHA256, "sha256:"))
+			provenance.Locked = true
+		}
+	case KindGit:
+		if opts.SHA256 != "" {
+			return nil, fmt.Errorf("--sha256 only applies to HTTPS preset files; pin git sources with --commit")
+		}
+		if opts.Commit != "" {
+			provenance.Pin = opts.Commit
+			provenance.Locked = true
+		}
+	}
+
+	fetched, err := fetch(provenance)
+	if err != nil {
+		return nil, err
+	}
+	if err := install(dir, provenance, fetched); err != nil {
+		return nil, err
+	}
+	return provenance, nil
+}
+
+// Update fetches a source again. Sources following a branch or URL move their pin
+// to the new version; locked sources are verified against their pin instead. When
+// the source cannot be reached the cached copy stays in place.
+func Update(name string) (before, after *presets.Provenance, err error) {
+	dir, err := sourceDir(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	before, err = presets.ReadProvenance(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	updated := *before
+	if !updated.Locked {
+		updated.Pin = ""
+	}
+
+	fetched, err := fetch(&updated)
+	if err != nil {
+		return before, nil, fmt.Errorf("%v; keeping the cached copy fetched %s", err, before.FetchedAt.Format(time.RFC822))
+	}
+	if err := install(dir, &updated, fetched); err != nil {
+		return before, nil, err
+	}
+	return before, &updated, nil
+}
+
+// Remove deletes a source and its cached presets
+func Remove(name string) error {
+	dir, err := sourceDir(name)
+	if err != nil {
+		return err
+	}
+	if _, err := presets.ReadProvenance(dir); err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// List returns the provenance of every installed source, sorted by name
+func List() ([]*presets.Provenance, error) {
+	dir, err := presets.UserPresetDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*presets.Provenance, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if provenance, err := presets.ReadProvenance(filepath.Join(dir, entry.Name())); err == nil {
+			list = append(list, provenance)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Source < list[j].Source })
+	return list, nil
+}
+
+// sourceDir returns the cache directory of a named source
+func sourceDir(name string) (string, error) {
+	if !namePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid source name %q", name)
+	}
+	dir, err := presets.UserPresetDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// nameFromURL derives a source name from the last element of its URL
+func nameFromURL(rawURL string) string {
+	base := strings.TrimSuffix(rawURL, "/")
+	if parsed, err := url.Parse(base); err == nil && parsed.Path != "" {
+		base = parsed.Path
+	}
+	base = path.Base(filepath.ToSlash(base))
+	for _, suffix := range []string{".git", ".json", ".yaml", ".yml"} {
+		base = strings.TrimSuffix(base, suffix)
+	}
+	return base
+}
+
+// fetch retrieves a source's preset files, filling in its pin and checking it
+// against the existing pin when there is one
+func fetch(provenance *presets.Provenance) (*bundle, error) {
+	if err := checkSource(provenance.URL, provenance.Ref, provenance.Pin); err != nil {
+		return nil, err
+	}
+
+	var fetched *bundle
+	var err error
+	if provenance.Kind == KindHTTPS {
+		fetched, err = fetchHTTPS(provenance.URL)
+	} else {
+		fetched, err = fetchGit(provenance.URL, provenance.Ref, provenance.Pin)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// git commits may be pinned by an abbreviated hash; digests must match in full
+	matches := fetched.pin == provenance.Pin
+	if provenance.Kind == KindGit {
+		matches = strings.HasPrefix(fetched.pin, provenance.Pin)
+	}
+	if provenance.Pin != "" && !matches {
+		return nil, fmt.Errorf("fetched %s but the source is pinned to %s", fetched.pin, provenance.Pin)
+	}
+	provenance.Pin = fetched.pin
+	return fetched, nil
+}
+
+// fetchHTTPS downloads a single preset file
+func fetchHTTPS(rawURL string) (*bundle, error) {
+	response, err := httpClient.Get(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %v", rawURL, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", rawURL, response.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(response.Body, 10<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %v", rawURL, err)
+	}
+
+	parsed, _ := url.Parse(rawURL)
+	name := path.Base(parsed.Path)
+	fetched := &bundle{
+		pin:        "sha256:" + presets.FileDigest(data),
+		files:      map[string][]byte{name: data},
+		signatures: make(map[string][]byte),
+	}
+
+	// The signature is optional and served next to the preset
+	signature, err := httpClient.Get(rawURL + presets.SignatureExt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download signature: %v", err)
+	}
+	defer signature.Body.Close()
+	switch signature.StatusCode {
+	case http.StatusOK:
+		sig, err := io.ReadAll(io.LimitReader(signature.Body, 64<<10))
+		if err != nil {
+			return nil, fmt.Errorf("failed to download signature: %v", err)
+		}
+		fetched.signatures[name] = sig
+	case http.StatusNotFound:
+	default:
+		return nil, fmt.Errorf("failed to download signature: %s", signature.Status)
+	}
+	return fetched, nil
+}
+
+// fetchGit clones a repository and collects the preset files at its root and in
+// its presets/ directory. A commit, when given, is checked out instead of the ref.
+func fetchGit(repository, ref, commit string) (*bundle, error) {
+	tmpDir, err := os.MkdirTemp("", "preset-source-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	args := []string{"clone", "--quiet"}
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	if err := runGit("", append(args, "--", repository, tmpDir)...); err != nil {
+		return nil, fmt.Errorf("failed to clone %s: %v", repository, err)
+	}
+	if commit != "" {
+		if err := runGit(tmpDir, "checkout", "--quiet", commit); err != nil {
+			return nil, fmt.Errorf("failed to check out %s: %v", commit, err)
+		}
+	}
+
+	head, err := exec.Command("git", "-C", tmpDir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve commit: %v", err)
+	}
+
+	files := make(map[string][]byte)
+	signatures := make(map[string][]byte)
+	for _, sub := range []string{".", "presets"} {
+		entries, err := os.ReadDir(filepath.Join(tmpDir, sub))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !presets.IsPresetFile(entry.Name()) {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(tmpDir, sub, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := files[entry.Name()]; exists {
+				return nil, fmt.Errorf("preset file %s appears more than once in %s", entry.Name(), repository)
+			}
+			files[entry.Name()] = data
+
+			signature, err := os.ReadFile(filepath.Join(tmpDir, sub, entry.Name()+presets.SignatureExt))
+			if err == nil {
+				signatures[entry.Name()] = signature
+			}
+		}
+	}
+
+	return &bundle{pin: strings.TrimSpace(string(head)), files: files, signatures: signatures}, nil
+}
+
+// runGit runs a git command, including its error output in the returned error
+func runGit(dir string, args ...string) error {
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	output, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		if message := strings.TrimSpace(string(output)); message != "" {
+			return fmt.Errorf("%v: %s", err, message)
+		}
+		return err
+	}
+	return nil
+}
+
+// install validates fetched presets and replaces the source directory with them,
+// leaving the previous copy untouched if anything fails
+func install(dir string, provenance *presets.Provenance, fetched *bundle) error {
+	if len(fetched.files) == 0 {
+		return fmt.Errorf("no preset files found in %s", provenance.URL)
+	}
+
+	provenance.Files = make(map[string]string, len(fetched.files))
+	for name, data := range fetched.files {
+		if _, err := presets.VerifyPreset(data, fetched.signatures[name]); err != nil {
+			return fmt.Errorf("refusing preset %s: %v", name, err)
+		}
+		preset, err := presets.DecodePreset(data)
+		if err == nil {
+			err = preset.Validate()
+		}
+		if err != nil {
+			return fmt.Errorf("invalid preset %s: %v", name, err)
+		}
+		provenance.Files[name] = presets.FileDigest(data)
+	}
+	provenance.FetchedAt = time.Now().UTC()
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return fmt.Errorf("failed to create preset directory: %v", err)
+	}
+	staging, err := os.MkdirTemp(filepath.Dir(dir), "."+filepath.Base(dir)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory: %v", err)
+	}
+	defer os.RemoveAll(staging)
+
+	for name, data := range fetched.files {
+		if err := os.WriteFile(filepath.Join(staging, name), data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", name, err)
+		}
+	}
+	for name, signature := range fetched.signatures {
+		if err := os.WriteFile(filepath.Join(staging, name+presets.SignatureExt), signature, 0644); err != nil {
+			return fmt.Errorf("failed to write signature of %s: %v", name, err)
+		}
+	}
+	record, err := json.MarshalIndent(provenance, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(staging, presets.ProvenanceFile), append(record, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write provenance: %v", err)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to replace %s: %v", dir, err)
+	}
+	if err := os.Rename(staging, dir); err != nil {
+		return fmt.Errorf("failed to install source: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,379 @@
+package sources
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"base-linux-setup/internal/presets"
+)
+
+// presetJSON returns a minimal valid preset with the given description
+func presetJSON(description string) []byte {
+	return []byte(`{
+  "schema_version": 3,
+  "name": "Shared",
+  "description": "` + description + `",
+  "tasks": [{"name": "Noop", "type": "command", "commands": ["true"]}]
+}
+`)
+}
+
+// isolate points the user configuration directory at a temporary directory
+func isolate(t *testing.T, allowUnsigned bool) {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	presets.SetAllowUnsigned(allowUnsigned)
+	t.Cleanup(func() { presets.SetAllowUnsigned(false) })
+}
+
+// bundleServer serves a single preset file and, when set, its signature
+type bundleServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	preset    []byte
+	signature []byte
+}
+
+func newBundleServer(t *testing.T, preset []byte) *bundleServer {
+	t.Helper()
+	s := &bundleServer{preset: preset}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch {
+		case r.URL.Path == "/shared.json":
+			w.Write(s.preset)
+		case r.URL.Path == "/shared.json"+presets.SignatureExt && s.signature != nil:
+			w.Write(s.signature)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	// Trust the server's self-signed certificate
+	previous := httpClient
+	httpClient = s.Client()
+	t.Cleanup(func() { httpClient = previous })
+	return s
+}
+
+func (s *bundleServer) set(preset, signature []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.preset, s.signature = preset, signature
+}
+
+// gitFixture is a bare repository with a working clone used to push commits
+type gitFixture struct {
+	t    *testing.T
+	bare string
+	work string
+}
+
+func newGitFixture(t *testing.T) *gitFixture {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	root := t.TempDir()
+	g := &gitFixture{t: t, bare: filepath.Join(root, "shared.git"), work: filepath.Join(root, "work")}
+	g.git("", "init", "--quiet", "--bare", g.bare)
+	g.git("", "--git-dir", g.bare, "symbolic-ref", "HEAD", "refs/heads/main")
+	g.git("", "init", "--quiet", g.work)
+	return g
+}
+
+func (g *gitFixture) git(dir string, args ...string) string {
+	g.t.Helper()
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	args = append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)
+	output, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		g.t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// commit writes a preset into presets/ and pushes it, returning the commit hash
+func (g *gitFixture) commit(preset []byte) string {
+	g.t.Helper()
+	if err := os.MkdirAll(filepath.Join(g.work, "presets"), 0755); err != nil {
+		g.t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(g.work, "presets", "shared.json"), preset, 0644); err != nil {
+		g.t.Fatal(err)
+	}
+	g.git(g.work, "add", "-A")
+	g.git(g.work, "commit", "--quiet", "-m", "update preset")
+	g.git(g.work, "push", "--quiet", g.bare, "HEAD:refs/heads/main")
+	return g.git(g.work, "rev-parse", "HEAD")
+}
+
+// cachedPreset reads the preset file installed for a source
+func cachedPreset(t *testing.T, source string) string {
+	t.Helper()
+	dir, err := sourceDir(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "shared.json"))
+	if err != nil {
+		t.Fatalf("reading cached preset: %v", err)
+	}
+	return string(data)
+}
+
+func TestKindOf(t *testing.T) {
+	tests := map[string]string{
+		"https://example.com/presets/shared.json": KindHTTPS,
+		"http://example.com/shared.yaml":          KindGit,
+		"https://github.com/example/presets.git":  KindGit,
+		"https://github.com/example/presets":      KindGit,
+		"git@github.com:example/presets.git":      KindGit,
+		"/srv/git/presets.git":                    KindGit,
+	}
+	for url, want := range tests {
+		if got := KindOf(url); got != want {
+			t.Errorf("KindOf(%q) = %s, want %s", url, got, want)
+		}
+	}
+}
+
+func TestAddRejectsUnsafeSources(t *testing.T) {
+	isolate(t, true)
+
+	tests := []struct {
+		url  string
+		opts AddOptions
+		want string
+	}{
+		{"http://example.com/shared.json", AddOptions{}, "plain http"},
+		{"HTTP://example.com/presets.git", AddOptions{}, "plain http"},
+		{"https://example.com/presets.git", AddOptions{Ref: "--upload-pack=touch /tmp/x"}, "invalid git ref"},
+		{"https://example.com/presets.git", AddOptions{Commit: "-p"}, "invalid git commit"},
+	}
+	for _, tt := range tests {
+		if _, err := Add(tt.url, tt.opts); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Add(%q, %+v): error = %v, want it to contain %q", tt.url, tt.opts, err, tt.want)
+		}
+	}
+}
+
+func TestFetchGitTreatsRepositoryAsOperand(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	_, err := fetchGit("--upload-pack=true", "", "")
+	if err == nil || !strings.Contains(err.Error(), "repository '--upload-pack=true'") {
+		t.Errorf("error = %v, want git to report the argument as a missing repository", err)
+	}
+}
+
+func TestNameFromURL(t *testing.T) {
+	tests := map[string]string{
+		"https://example.com/presets/shared.json": "shared",
+		"https://github.com/example/presets.git":  "presets",
+		"https://github.com/example/presets/":     "presets",
+		"/srv/git/team.git":                       "team",
+	}
+	for url, want := range tests {
+		if got := nameFromURL(url); got != want {
+			t.Errorf("nameFromURL(%q) = %s, want %s", url, got, want)
+		}
+	}
+}
+
+func TestAddAndUpdateHTTPS(t *testing.T) {
+	isolate(t, false)
+	server := newBundleServer(t, presetJSON("v1"))
+
+	// Unsigned presets are refused unless allowed
+	if _, err := Add(server.URL+"/shared.json", AddOptions{}); err == nil || !strings.Contains(err.Error(), "not signed") {
+		t.Fatalf("Add of an unsigned preset: error = %v, want a refusal", err)
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := presets.TrustKey(key.Public().(ed25519.PublicKey), "test"); err != nil {
+		t.Fatal(err)
+	}
+	server.set(presetJSON("v1"), presets.SignPreset(key, presetJSON("v1")))
+
+	added, err := Add(server.URL+"/shared.json", AddOptions{})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if added.Source != "shared" || added.Kind != KindHTTPS || added.Locked {
+		t.Errorf("Add provenance = %+v", added)
+	}
+	if want := "sha256:" + presets.FileDigest(presetJSON("v1")); added.Pin != want {
+		t.Errorf("pin = %s, want %s", added.Pin, want)
+	}
+	if _, err := Add(server.URL+"/shared.json", AddOptions{}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("second Add: error = %v, want already exists", err)
+	}
+
+	server.set(presetJSON("v2"), presets.SignPreset(key, presetJSON("v2")))
+	before, after, err := Update("shared")
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if before.Pin == after.Pin {
+		t.Errorf("Update kept pin %s after the preset changed", after.Pin)
+	}
+	if !strings.Contains(cachedPreset(t, "shared"), `"v2"`) {
+		t.Error("Update did not install the new preset")
+	}
+
+	list, err := List()
+	if err != nil || len(list) != 1 || list[0].Pin != after.Pin {
+		t.Errorf("List() = %v, %v", list, err)
+	}
+	if err := Remove("shared"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if list, _ := List(); len(list) != 0 {
+		t.Errorf("List() after Remove = %v", list)
+	}
+}
+
+func TestHTTPSDigestPin(t *testing.T) {
+	isolate(t, true)
+	server := newBundleServer(t, presetJSON("v1"))
+	digest := presets.FileDigest(presetJSON("v1"))
+
+	if _, err := Add(server.URL+"/shared.json", AddOptions{SHA256: strings.Repeat("0", 64)}); err == nil || !strings.Contains(err.Error(), "pinned to") {
+		t.Fatalf("Add with a wrong digest: error = %v, want a pin mismatch", err)
+	}
+	if list, _ := List(); len(list) != 0 {
+		t.Fatalf("a refused source was installed: %v", list)
+	}
+
+	added, err := Add(server.URL+"/shared.json", AddOptions{SHA256: "sha256:" + strings.ToUpper(digest)})
+	if err != nil {
+		t.Fatalf("Add with the right digest: %v", err)
+	}
+	if !added.Locked || added.Pin != "sha256:"+digest {
+		t.Errorf("Add provenance = %+v", added)
+	}
+
+	// A locked source refuses changed content and keeps the cached copy
+	server.set(presetJSON("v2"), nil)
+	if _, _, err := Update("shared"); err == nil || !strings.Contains(err.Error(), "keeping the cached copy") {
+		t.Errorf("Update of changed locked source: error = %v", err)
+	}
+	if !strings.Contains(cachedPreset(t, "shared"), `"v1"`) {
+		t.Error("the cached preset was replaced")
+	}
+}
+
+func TestUpdateOfflineKeepsCache(t *testing.T) {
+	isolate(t, true)
+	server := newBundleServer(t, presetJSON("v1"))
+
+	added, err := Add(server.URL+"/shared.json", AddOptions{})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	server.Close()
+
+	before, after, err := Update("shared")
+	if err == nil || !strings.Contains(err.Error(), "keeping the cached copy") {
+		t.Fatalf("offline Update: error = %v, want the cached copy kept", err)
+	}
+	if after != nil || before.Pin != added.Pin {
+		t.Errorf("offline Update returned before=%v after=%v", before, after)
+	}
+	if !strings.Contains(cachedPreset(t, "shared"), `"v1"`) {
+		t.Error("the cached preset was removed")
+	}
+
+	// The cached presets still load while offline
+	loaded, errs := presets.LoadUserPresets()
+	if len(errs) > 0 || len(loaded) != 1 || loaded[0].Description != "v1" {
+		t.Errorf("LoadUserPresets() = %v, %v", loaded, errs)
+	}
+}
+
+func TestAddAndUpdateGit(t *testing.T) {
+	isolate(t, true)
+	repo := newGitFixture(t)
+	first := repo.commit(presetJSON("v1"))
+
+	added, err := Add(repo.bare, AddOptions{})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if added.Source != "shared" || added.Kind != KindGit || added.Pin != first || added.Locked {
+		t.Errorf("Add provenance = %+v", added)
+	}
+
+	second := repo.commit(presetJSON("v2"))
+	before, after, err := Update("shared")
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if before.Pin != first || after.Pin != second {
+		t.Errorf("Update moved %s → %s, want %s → %s", before.Pin, after.Pin, first, second)
+	}
+	if !strings.Contains(cachedPreset(t, "shared"), `"v2"`) {
+		t.Error("Update did not install the new commit")
+	}
+}
+
+func TestGitCommitPin(t *testing.T) {
+	isolate(t, true)
+	repo := newGitFixture(t)
+	first := repo.commit(presetJSON("v1"))
+	repo.git(repo.work, "tag", "v1")
+	repo.git(repo.work, "push", "--quiet", repo.bare, "v1")
+	repo.commit(presetJSON("v2"))
+
+	// A pin that resolves to a different commit is a mismatch
+	if _, err := Add(repo.bare, AddOptions{Name: "tagged", Commit: "v1"}); err == nil || !strings.Contains(err.Error(), "pinned to v1") {
+		t.Errorf("Add pinned to a tag name: error = %v, want a pin mismatch", err)
+	}
+	if _, err := Add(repo.bare, AddOptions{Name: "missing", Commit: strings.Repeat("f", 40)}); err == nil {
+		t.Error("Add pinned to a missing commit succeeded")
+	}
+
+	added, err := Add(repo.bare, AddOptions{Commit: first[:10]})
+	if err != nil {
+		t.Fatalf("Add pinned to an abbreviated commit: %v", err)
+	}
+	if !added.Locked || added.Pin != first {
+		t.Errorf("Add provenance = %+v", added)
+	}
+	if !strings.Contains(cachedPreset(t, "shared"), `"v1"`) {
+		t.Error("Add did not check out the pinned commit")
+	}
+
+	// Updating a locked source re-fetches the pinned commit, not the branch head
+	_, after, err := Update("shared")
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if after.Pin != first {
+		t.Errorf("Update moved the locked source to %s", after.Pin)
+	}
+	if !strings.Contains(cachedPreset(t, "shared"), `"v1"`) {
+		t.Error("Update replaced the pinned preset")
+	}
+
+	if _, err := Add(repo.bare, AddOptions{Name: "other", SHA256: strings.Repeat("0", 64)}); err == nil {
+		t.Error("Add of a git source accepted --sha256")
+	}
+}
@@ -42,18 +42,30 @@ func CustomizePreset(preset *presets.Preset) (*presets.Preset, error) {
 
 // customizeTasks allows detailed task customization
 func customizeTasks(preset *presets.Preset) (*presets.Preset, error) {
-	customizedPreset := &presets.Preset{
-		Name:        preset.Name + " (Customized)",
-		Environment: preset.Environment,
-		Description: preset.Description,
-		Tasks:       make([]presets.Task, 0),
-	}
+	customized := *preset
+	customized.Name = preset.Name + " (Customized)"
+	customized.Tasks = make([]presets.Task, 0)
+	customizedPreset := &customized
 
 	color.Cyan("Customizing tasks for: %s", preset.Name)
 	fmt.Println()
 
+	// Walk tasks in dependency order so skips can cascade to later dependents
+	tasks, err := presets.OrderTasks(preset.Tasks)
+	if err != nil {
+		return nil, err
+	}
+	skipped := make(map[string]bool)
+
 	// Go through each task and ask user
-	for i, task := range preset.Tasks {
+	for i, task := range tasks {
+		if dep := skippedDependency(task, skipped); dep != "" {
+			color.Yellow("Task %d: %s skipped (depends on skipped task %s)", i+1, task.Name, dep)
+			skipped[task.ID] = true
+			fmt.Println()
+			continue
+		}
+
 		color.White("Task %d: %s", i+1, task.Name)
 		if task.Description != "" {
 			color.HiBlack("  Description: %s", task.Description)
@@ -78,7 +90,11 @@ func customizeTasks(preset *presets.Preset) (*presets.Preset, error) {
 		case "Include this task":
 			customizedPreset.Tasks = append(customizedPreset.Tasks, task)
 		case "Skip this task":
-			// Skip this task
+			if !confirmSkip(task, presets.Dependents(tasks, task.ID)) {
+				customizedPreset.Tasks = append(customizedPreset.Tasks, task)
+				break
+			}
+			skipped[task.ID] = true
 			continue
 		case "Mark as optional":
 			task.Optional = true
@@ -104,6 +120,42 @@ func customizeTasks(preset *presets.Preset) (*presets.Preset, error) {
 	return customizedPreset, nil
 }
 
+// skippedDependency returns the first dependency of task that the user skipped
+func skippedDependency(task presets.Task, skipped map[string]bool) string {
+	for _, dep := range task.DependsOn {
+		if skipped[dep] {
+			return dep
+		}
+	}
+	return ""
+}
+
+// confirmSkip warns when other tasks depend on a task being skipped and asks
+// whether to skip them as well or keep the task
+func confirmSkip(task presets.Task, dependents []presets.Task) bool {
+	if len(dependents) == 0 {
+		return true
+	}
+
+	names := make([]string, 0, len(dependents))
+	for _, dependent := range dependents {
+		names = append(names, dependent.Name)
+	}
+	color.Yellow("Warning: %d task(s) depend on '%s': %s", len(dependents), task.Name, strings.Join(names, ", "))
+
+	prompt := promptui.Select{
+		Label: "Skipping this task will also skip its dependents",
+		Items: []string{"Keep this task", "Skip this task and its dependents"},
+	}
+
+	_, result, err := prompt.Run()
+	if err != nil {
+		return false
+	}
+
+	return result == "Skip this task and its dependents"
+}
+
 // addCustomTasks allows adding custom tasks
 func addCustomTasks(preset *presets.Preset) error {
 	for {
@@ -171,6 +223,178 @@ func addCustomTasks(preset *presets.Preset) error {
 	return nil
 }
 
+// SelectProfile asks which of the preset's profiles to use, returning "" for the
+// full preset
+func SelectProfile(preset *presets.Preset) (string, error) {
+	items := []string{"All tasks (no profile)"}
+	for _, profile := range preset.Profiles {
+		item := profile.Name
+		if profile.Description != "" {
+			item += " - " + profile.Description
+		}
+		items = append(items, item)
+	}
+
+	prompt := promptui.Select{
+		Label: "Select a profile",
+		Items: items,
+	}
+
+	index, _, err := prompt.Run()
+	if err != nil {
+		return "", err
+	}
+	if index == 0 {
+		return "", nil
+	}
+	return preset.Profiles[index-1].Name, nil
+}
+
+// SelectModules lets the user toggle add-on modules on and off, returning the IDs
+// of the selected ones
+func SelectModules(modules []presets.Module) ([]string, error) {
+	selected := make([]bool, len(modules))
+
+	for {
+		items := []string{"Continue"}
+		for i, module := range modules {
+			mark := "[ ]"
+			if selected[i] {
+				mark = "[x]"
+			}
+			items = append(items, fmt.Sprintf("%s %s - %s", mark, module.Name, module.Description))
+		}
+
+		prompt := promptui.Select{
+			Label: "Add-on modules (select to toggle)",
+			Items: items,
+			Size:  len(items),
+		}
+
+		index, _, err := prompt.Run()
+		if err != nil {
+			return nil, err
+		}
+		if index == 0 {
+			break
+		}
+		selected[index-1] = !selected[index-1]
+	}
+
+	ids := make([]string, 0)
+	for i, module := range modules {
+		if selected[i] {
+			ids = append(ids, module.ID)
+		}
+	}
+	return ids, nil
+}
+
+// PromptVariables asks the user for the values of the given preset variables
+func PromptVariables(variables []presets.Variable) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(variables))
+	if len(variables) == 0 {
+		return values, nil
+	}
+
+	color.Cyan("Preset Variables:")
+	for _, variable := range variables {
+		if variable.Description != "" {
+			color.HiBlack("  %s", variable.Description)
+		}
+
+		result, err := promptVariable(variable)
+		if err != nil {
+			return nil, err
+		}
+		values[variable.Name] = result
+	}
+	fmt.Println()
+
+	return values, nil
+}
+
+// promptVariable asks for a single variable using a prompt suited to its type
+func promptVariable(v presets.Variable) (string, error) {
+	switch v.Type {
+	case "enum", "bool":
+		items := v.Choices
+		if v.Type == "bool" {
+			items = []string{"true", "false"}
+		}
+
+		cursor := 0
+		for i, item := range items {
+			if item == presets.FormatValue(v.Default) {
+				cursor = i
+			}
+		}
+
+		prompt := promptui.Select{
+			Label:     v.Name,
+			Items:     items,
+			CursorPos: cursor,
+		}
+		_, result, err := prompt.Run()
+		return result, err
+	}
+
+	prompt := promptui.Prompt{
+		Label:     fmt.Sprintf("%s (%s)", v.Name, typeLabel(v)),
+		Default:   presets.FormatValue(v.Default),
+		AllowEdit: v.Default != nil && !v.IsSecret(),
+		Validate: func(input string) error {
+			if input == "" && v.IsSecret() && v.Default != nil {
+				return nil
+			}
+			_, err := v.Convert(input)
+			return err
+		},
+	}
+	if v.IsSecret() {
+		prompt.Mask = '*'
+		prompt.Default = ""
+	}
+
+	result, err := prompt.Run()
+	if err != nil {
+		return "", err
+	}
+	if result == "" && v.IsSecret() && v.Default != nil {
+		return presets.FormatValue(v.Default), nil
+	}
+	return result, nil
+}
+
+// typeLabel describes the expected input format for a variable
+func typeLabel(v presets.Variable) string {
+	switch v.Type {
+	case "", "string":
+		return "text"
+	case "list":
+		return "comma-separated"
+	case "cidr":
+		return "CIDR, e.g. 192.168.1.0/24"
+	case "port":
+		return "1-65535"
+	default:
+		return v.Type
+	}
+}
+
+// ShowVariables prints the resolved variable values, masking secrets
+func ShowVariables(preset *presets.Preset, values map[string]interface{}) {
+	if len(preset.Variables) == 0 {
+		return
+	}
+
+	color.Cyan("Variables:")
+	for _, variable := range preset.Variables {
+		color.White("  %s = %s", variable.Name, variable.DisplayValue(values[variable.Name]))
+	}
+	fmt.Println()
+}
+
 // ConfirmExecution asks user to confirm execution of the preset
 func ConfirmExecution(preset *presets.Preset) bool {
 	color.Cyan("Final Task List:")
@@ -181,6 +405,12 @@ func ConfirmExecution(preset *presets.Preset) bool {
 		}
 		color.White("  %s %d. %s", status, i+1, task.Name)
 	}
+	if preset.EstimatedDuration != "" {
+		color.HiBlack("  Estimated duration: %s", preset.EstimatedDuration)
+	}
+	if preset.RebootRequired {
+		color.Yellow("  A reboot will be required afterwards")
+	}
 	fmt.Println()
 
 	prompt := promptui.Select{
@@ -196,6 +426,47 @@ func ConfirmExecution(preset *presets.Preset) bool {
 	return result == "Yes"
 }
 
+// ShowPresetMetadata displays the preset's version, authorship and compatibility
+// details, skipping fields the preset does not declare
+func ShowPresetMetadata(preset *presets.Preset, indent string) {
+	if preset.Version != "" {
+		color.White("%sVersion: %s", indent, preset.Version)
+	}
+	if len(preset.Authors) > 0 {
+		color.White("%sAuthors: %s", indent, strings.Join(preset.Authors, ", "))
+	}
+	if preset.Homepage != "" {
+		color.White("%sHomepage: %s", indent, preset.Homepage)
+	}
+	if preset.License != "" {
+		color.White("%sLicense: %s", indent, preset.License)
+	}
+	if preset.MinToolVersion != "" {
+		color.White("%sRequires: base-linux-setup %s or newer", indent, preset.MinToolVersion)
+	}
+	if len(preset.Architectures) > 0 {
+		color.White("%sArchitectures: %s", indent, strings.Join(preset.Architectures, ", "))
+	}
+	if preset.EstimatedDuration != "" {
+		color.White("%sEstimated duration: %s", indent, preset.EstimatedDuration)
+	}
+	if preset.RebootRequired {
+		color.White("%sReboot required: yes", indent)
+	}
+	switch {
+	case preset.Source != nil:
+		color.White("%sSource: %s", indent, preset.Source)
+	case preset.Path != "":
+		color.White("%sSource: %s", indent, preset.Path)
+	}
+	if preset.SignedBy != "" {
+		color.White("%sSigned by: %s", indent, preset.SignedBy)
+	}
+	if preset.Match != "" {
+		color.White("%sMatch: %s", indent, preset.Match)
+	}
+}
+
 // ContinueOnError asks user whether to continue when an error occurs
 func ContinueOnError() bool {
 	color.Yellow("An error occurred during task execution.")
@@ -259,6 +530,32 @@ func SelectFromList(label string, items []string) ([]string, error) {
 	return selected, nil
 }
 
+// PromptText asks for a line of text, offering a default. A nil validate accepts
+// anything.
+func PromptText(label, defaultValue string, validate func(string) error) (string, error) {
+	prompt := promptui.Prompt{
+		Label:     label,
+		Default:   defaultValue,
+		AllowEdit: true,
+		Validate:  validate,
+	}
+	result, err := prompt.Run()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(result), nil
+}
+
+// Confirm asks a yes/no question
+func Confirm(label string) bool {
+	prompt := promptui.Select{
+		Label: label,
+		Items: []string{"Yes", "No"},
+	}
+	_, result, err := prompt.Run()
+	return err == nil && result == "Yes"
+}
+
 // GetNumberInput gets a number input from user
 func GetNumberInput(label string, min, max int) (int, error) {
 	prompt := promptui.Prompt{
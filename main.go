@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"base-linux-setup/cmd"
 	"base-linux-setup/internal/detector"
@@ -21,9 +22,23 @@ var (
 	commit    = "unknown"
 )
 
+// Setup flags
+var (
+	setValues      []string
+	varsFile       string
+	presetFile     string
+	nonInteractive bool
+	dryRun         bool
+	profileName    string
+	withModules    []string
+	taskFilter     presets.TaskFilter
+	allowUnsigned  bool
+)
+
 func main() {
 	// Set the embedded JSON getter for presets
 	presets.SetEmbeddedJSONGetter(GetEmbeddedJSON)
+	presets.SetToolVersion(version)
 	
 	rootCmd := &cobra.Command{
 		Use:     "base-linux-setup",
@@ -31,10 +46,31 @@ func main() {
 		Long:    `Base Linux Setup detects your environment and provides customizable presets for system configuration.`,
 		Run:     runSetup,
 		Version: fmt.Sprintf("%s (built %s, commit %s)", version, buildTime, commit),
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			presets.SetAllowUnsigned(allowUnsigned)
+		},
 	}
 
+	rootCmd.PersistentFlags().BoolVar(&allowUnsigned, "allow-unsigned", false, "Load preset files that have no signature")
+
+	rootCmd.Flags().StringArrayVar(&setValues, "set", nil, "Set a preset variable (key=value, repeatable)")
+	rootCmd.Flags().StringVar(&varsFile, "vars-file", "", "Read preset variable values from a JSON file")
+	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be executed without running anything")
+	rootCmd.Flags().StringSliceVar(&taskFilter.Tags, "tags", nil, "Only run tasks with any of these tags")
+	rootCmd.Flags().StringSliceVar(&taskFilter.SkipTags, "skip-tags", nil, "Skip tasks with any of these tags")
+	rootCmd.Flags().StringSliceVar(&taskFilter.Only, "only", nil, "Only run the given tasks (by ID or name)")
+	rootCmd.Flags().StringVar(&presetFile, "preset-file", "", "Run the preset in this file instead of the detected one")
+	rootCmd.Flags().StringVar(&profileName, "profile", "", "Use a named profile of the preset")
+	rootCmd.Flags().StringSliceVar(&withModules, "with", nil, "Add add-on modules to the preset, e.g. docker,go")
+	rootCmd.Flags().BoolVar(&nonInteractive, "non-interactive", false, "Run the preset as-is without prompts, failing if input is missing")
+
 	rootCmd.AddCommand(cmd.NewDetectCommand())
 	rootCmd.AddCommand(cmd.NewListPresetsCommand())
+	rootCmd.AddCommand(cmd.NewMigratePresetCommand())
+	rootCmd.AddCommand(cmd.NewLintPresetCommand())
+	rootCmd.AddCommand(cmd.NewPresetCommand())
+	rootCmd.AddCommand(cmd.NewCaptureCommand())
+	rootCmd.AddCommand(cmd.NewExportCommand())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -61,16 +97,93 @@ func runSetup(cmd *cobra.Command, args []string) {
 	color.White("  Hardware: %s", env.Hardware)
 	fmt.Println()
 
-	// Get preset for environment
-	preset := presets.GetPreset(env)
+	// Get preset from the given file or for the environment
+	var preset *presets.Preset
+	if presetFile != "" {
+		preset, err = presets.LoadPresetFile(presetFile)
+		if err != nil {
+			color.Red("Error loading preset: %v", err)
+			os.Exit(1)
+		}
+		preset.Path = presetFile
+	} else {
+		var loadErrs []error
+		preset, loadErrs = presets.GetPreset(env)
+		for _, err := range loadErrs {
+			color.Yellow("⚠ Skipping user preset: %v", err)
+		}
+	}
 	if preset == nil {
 		color.Yellow("No preset found for your environment. Creating a basic preset...")
 		preset = presets.GetDefaultPreset()
 	}
+	for _, warning := range preset.Warnings {
+		color.Yellow("Warning: %s", warning)
+	}
+
+	// Choose a profile, asking when the preset has some and none was given
+	if profileName == "" && len(preset.Profiles) > 0 && !nonInteractive {
+		profileName, err = ui.SelectProfile(preset)
+		if err != nil {
+			color.Red("Error selecting profile: %v", err)
+			os.Exit(1)
+		}
+	}
+	if profileName != "" {
+		var warnings []string
+		preset, warnings, err = preset.ApplyProfile(profileName)
+		if err != nil {
+			color.Red("Error applying profile: %v", err)
+			os.Exit(1)
+		}
+		for _, warning := range warnings {
+			color.Yellow("Warning: %s", warning)
+		}
+	}
+
+	// Merge add-on modules, asking when none were given
+	family := presets.Family(env)
+	if len(withModules) == 0 && !nonInteractive && len(presets.ModulesFor(family)) > 0 {
+		withModules, err = ui.SelectModules(presets.ModulesFor(family))
+		if err != nil {
+			color.Red("Error selecting modules: %v", err)
+			os.Exit(1)
+		}
+	}
+	if len(withModules) > 0 {
+		modules, err := presets.FindModules(withModules)
+		if err == nil {
+			preset, err = preset.WithModules(modules, family)
+		}
+		if err != nil {
+			color.Red("Error adding modules: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	// Apply task filters
+	preset, warnings, err := preset.Filter(taskFilter)
+	if err != nil {
+		color.Red("Error filtering tasks: %v", err)
+		os.Exit(1)
+	}
+	for _, warning := range warnings {
+		color.Yellow("Warning: %s", warning)
+	}
+
+	// Refuse presets this binary or machine cannot run
+	if err := preset.CheckCompatibility(env.Architecture); err != nil {
+		color.Red("Error: %v", err)
+		os.Exit(1)
+	}
 
 	// Display preset
 	color.Green("Available Preset: %s", preset.Name)
+	if preset.Profile != "" {
+		color.White("Profile: %s", preset.Profile)
+	}
 	color.White("Description: %s", preset.Description)
+	ui.ShowPresetMetadata(preset, "")
 	fmt.Println()
 
 	// Show tasks
@@ -80,20 +193,43 @@ func runSetup(cmd *cobra.Command, args []string) {
 		if task.Description != "" {
 			color.HiBlack("     %s", task.Description)
 		}
+		if task.When != "" {
+			color.HiBlack("     when: %s", task.When)
+		}
+		if len(task.Tags) > 0 {
+			color.HiBlack("     tags: %s", strings.Join(task.Tags, ", "))
+		}
+		if task.IsBlock() {
+			color.HiBlack("     block: %d tasks, rescue: %d, always: %d", len(task.Block), len(task.Rescue), len(task.Always))
+		}
 	}
 	fmt.Println()
 
-	// Ask user for customization
-	customizedPreset, err := ui.CustomizePreset(preset)
+	// Resolve preset variables
+	vars, err := resolveVariables(preset)
 	if err != nil {
-		color.Red("Error customizing preset: %v", err)
+		color.Red("Error resolving preset variables: %v", err)
 		os.Exit(1)
 	}
+	ui.ShowVariables(preset, vars)
+
+	customizedPreset := preset
+	if !nonInteractive {
+		// Ask user for customization
+		customizedPreset, err = ui.CustomizePreset(preset)
+		if err != nil {
+			color.Red("Error customizing preset: %v", err)
+			os.Exit(1)
+		}
+		if customizedPreset != preset && ui.Confirm("Save the customized preset for later runs?") {
+			saveCustomizedPreset(customizedPreset, vars)
+		}
 
-	// Confirm execution
-	if !ui.ConfirmExecution(customizedPreset) {
-		color.Yellow("Setup cancelled by user.")
-		os.Exit(0)
+		// Confirm execution
+		if !ui.ConfirmExecution(customizedPreset) {
+			color.Yellow("Setup cancelled by user.")
+			os.Exit(0)
+		}
 	}
 
 	// Execute tasks
@@ -101,23 +237,130 @@ func runSetup(cmd *cobra.Command, args []string) {
 	fmt.Println()
 
 	executor := executor.NewExecutor()
-	for i, task := range customizedPreset.Tasks {
-		color.Cyan("Executing task %d/%d: %s", i+1, len(customizedPreset.Tasks), task.Name)
+	executor.SetDryRun(dryRun)
+	executor.SetScope(presets.NewScope(env, vars))
+	executor.SetSecrets(customizedPreset.SecretValues(vars))
+	executor.SetHandlers(customizedPreset.Handlers)
+	if !nonInteractive {
+		executor.SetErrorHandler(func(task presets.Task, err error) bool {
+			return ui.ContinueOnError()
+		})
+	}
+
+	summary, err := executor.Run(customizedPreset.Tasks)
+	if summary != nil {
+		summary.Print()
+	}
+	if err != nil {
+		color.Red("Error: %v", err)
+		color.Yellow("Setup cancelled.")
+		os.Exit(1)
+	}
+
+	if summary.Failed > 0 {
+		color.Yellow("Setup finished with %d failed task(s): %d completed, %d skipped.", summary.Failed, summary.Completed, summary.Skipped)
+		os.Exit(1)
+	}
+	color.Green("Setup completed successfully!")
+	if customizedPreset.RebootRequired && !dryRun {
+		color.Yellow("This preset requires a reboot to finish: sudo reboot")
+	}
+}
 
-		if err := executor.ExecuteTask(task); err != nil {
-			color.Red("Error executing task '%s': %v", task.Name, err)
+// resolveVariables collects variable values from the vars file, --set flags
+// and interactive prompts, in increasing order of precedence
+func resolveVariables(preset *presets.Preset) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
 
-			if !ui.ContinueOnError() {
-				color.Yellow("Setup cancelled.")
-				os.Exit(1)
-			}
-		} else {
-			color.Green("✓ Task completed: %s", task.Name)
+	if varsFile != "" {
+		fileValues, err := presets.LoadVarsFile(varsFile)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range fileValues {
+			values[key] = value
 		}
-		fmt.Println()
 	}
 
-	color.Green("Setup completed successfully!")
+	setFlagValues, err := presets.ParseSetValues(setValues)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range setFlagValues {
+		values[key] = value
+	}
+
+	if nonInteractive {
+		if missing := preset.MissingVariables(values); len(missing) > 0 {
+			return nil, fmt.Errorf("missing values for %s (use --set or --vars-file in non-interactive mode)", strings.Join(missing, ", "))
+		}
+	} else {
+		prompted, err := ui.PromptVariables(preset.PromptableVariables(values))
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range prompted {
+			values[key] = value
+		}
+	}
+
+	return preset.ResolveVariables(values)
+}
+
+// saveCustomizedPreset writes a customized preset to the user preset directory so
+// it can be run again with --preset-file. Failures are reported without stopping
+// the setup.
+func saveCustomizedPreset(preset *presets.Preset, vars map[string]interface{}) {
+	name, err := ui.PromptText("Name for the customized preset", preset.Name, func(input string) error {
+		if presets.Slug(input) == "" {
+			return fmt.Errorf("enter a name with letters or digits")
+		}
+		return nil
+	})
+	if err != nil {
+		color.Yellow("Not saving the customized preset: %v", err)
+		return
+	}
+
+	path, err := presets.UserPresetPath(name, presets.FormatJSON)
+	if err != nil {
+		color.Yellow("Not saving the customized preset: %v", err)
+		return
+	}
+	if _, err := os.Stat(path); err == nil && !ui.Confirm(fmt.Sprintf("%s exists. Overwrite it?", path)) {
+		color.Yellow("Not saving the customized preset.")
+		return
+	}
+
+	snapshot, err := preset.Snapshot(name, vars)
+	if err == nil {
+		err = presets.WritePresetFile(snapshot, path)
+	}
+	if err != nil {
+		color.Yellow("Could not save the customized preset: %v", err)
+		return
+	}
+	color.Green("✓ Saved the customized preset to %s", path)
+
+	rerun := "base-linux-setup --preset-file " + path
+	if ui.Confirm("Sign it with your local key?") {
+		key, _, err := presets.LocalSigningKey("")
+		if err == nil {
+			err = presets.SignPresetFile(key, path)
+		}
+		if err != nil {
+			color.Yellow("Could not sign the customized preset: %v", err)
+			rerun = "base-linux-setup --allow-unsigned --preset-file " + path
+		} else {
+			color.Green("✓ Signed %s", path)
+		}
+	} else {
+		// A stale signature from an earlier save would make the file fail to load
+		os.Remove(path + presets.SignatureExt)
+		rerun = "base-linux-setup --allow-unsigned --preset-file " + path
+	}
+	color.White("  Run it again with: %s", rerun)
+	fmt.Println()
 }
 
 func printBanner() {